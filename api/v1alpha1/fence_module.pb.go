@@ -27,6 +27,8 @@ type Fence struct {
 	// default value is false
 	AutoFence bool `protobuf:"varint,2,opt,name=autoFence,proto3" json:"autoFence,omitempty"`
 	// the namespace list which enable lazyload
+	// items are glob patterns like ns-*, and items prefixed with ! exclude the matched namespaces
+	// empty list means all namespaces
 	Namespace []string `protobuf:"bytes,3,rep,name=namespace,proto3" json:"namespace,omitempty"`
 	// custom outside dispatch traffic rules
 	Dispatches []*Dispatch `protobuf:"bytes,4,rep,name=dispatches,proto3" json:"dispatches,omitempty"`
@@ -34,10 +36,33 @@ type Fence struct {
 	DomainAliases []*DomainAlias `protobuf:"bytes,5,rep,name=domainAliases,proto3" json:"domainAliases,omitempty"`
 	// default behavior of create fence or not when autoFence is true
 	// default value is false
-	DefaultFence         bool     `protobuf:"varint,6,opt,name=defaultFence,proto3" json:"defaultFence,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	DefaultFence bool `protobuf:"varint,6,opt,name=defaultFence,proto3" json:"defaultFence,omitempty"`
+	// derive wormhole ports from the ports of services in mesh,
+	// the ports in wormholePort are always included
+	AutoPort *AutoPort `protobuf:"bytes,7,opt,name=autoPort,proto3" json:"autoPort,omitempty"`
+	// source of service dependencies, replaces global.misc.metricSourceType and global.misc.logSourcePort
+	MetricSource *MetricSource `protobuf:"bytes,8,opt,name=metricSource,proto3" json:"metricSource,omitempty"`
+	// mode of global-sidecar, cluster or namespace, replaces global.misc.globalSidecarMode
+	GlobalSidecarMode string `protobuf:"bytes,9,opt,name=globalSidecarMode,proto3" json:"globalSidecarMode,omitempty"`
+	// caps of the status of servicefences, which keep them below the size limit of etcd
+	StatusLimit *StatusLimit `protobuf:"bytes,10,opt,name=statusLimit,proto3" json:"statusLimit,omitempty"`
+	// collapse the egress hosts of a namespace in sidecars to ns/* when a fence uses most services of it
+	EgressAggregation *EgressAggregation `protobuf:"bytes,11,opt,name=egressAggregation,proto3" json:"egressAggregation,omitempty"`
+	// debounce and rate limit of sidecar writes, sidecars are written at once if unset
+	SidecarUpdate *SidecarUpdate `protobuf:"bytes,12,opt,name=sidecarUpdate,proto3" json:"sidecarUpdate,omitempty"`
+	// how the generated sidecar is written, replace or merge
+	// replace overwrites the egress listeners, merge only updates the egress hosts written by lazyload,
+	// and keeps the other egress listeners and hosts of the sidecar
+	// default value is replace
+	SidecarWriteMode string `protobuf:"bytes,13,opt,name=sidecarWriteMode,proto3" json:"sidecarWriteMode,omitempty"`
+	// domain suffix of the cluster, used to complete short names of services
+	// default value is cluster.local
+	ClusterDomain string `protobuf:"bytes,14,opt,name=clusterDomain,proto3" json:"clusterDomain,omitempty"`
+	// global-sidecar rendered by the module, the chart renders it if unset
+	GlobalSidecar        *GlobalSidecar `protobuf:"bytes,15,opt,name=globalSidecar,proto3" json:"globalSidecar,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
 }
 
 func (m *Fence) Reset()         { *m = Fence{} }
@@ -106,6 +131,128 @@ func (m *Fence) GetDefaultFence() bool {
 	return false
 }
 
+func (m *Fence) GetAutoPort() *AutoPort {
+	if m != nil {
+		return m.AutoPort
+	}
+	return nil
+}
+
+func (m *Fence) GetMetricSource() *MetricSource {
+	if m != nil {
+		return m.MetricSource
+	}
+	return nil
+}
+
+func (m *Fence) GetGlobalSidecarMode() string {
+	if m != nil {
+		return m.GlobalSidecarMode
+	}
+	return ""
+}
+
+func (m *Fence) GetStatusLimit() *StatusLimit {
+	if m != nil {
+		return m.StatusLimit
+	}
+	return nil
+}
+
+func (m *Fence) GetEgressAggregation() *EgressAggregation {
+	if m != nil {
+		return m.EgressAggregation
+	}
+	return nil
+}
+
+func (m *Fence) GetSidecarUpdate() *SidecarUpdate {
+	if m != nil {
+		return m.SidecarUpdate
+	}
+	return nil
+}
+
+func (m *Fence) GetSidecarWriteMode() string {
+	if m != nil {
+		return m.SidecarWriteMode
+	}
+	return ""
+}
+
+func (m *Fence) GetClusterDomain() string {
+	if m != nil {
+		return m.ClusterDomain
+	}
+	return ""
+}
+
+func (m *Fence) GetGlobalSidecar() *GlobalSidecar {
+	if m != nil {
+		return m.GlobalSidecar
+	}
+	return nil
+}
+
+type AutoPort struct {
+	// whether derive wormhole ports from service ports
+	Enable bool `protobuf:"varint,1,opt,name=enable,proto3" json:"enable,omitempty"`
+	// only services in these namespaces are considered, empty means all namespaces
+	Namespaces []string `protobuf:"bytes,2,rep,name=namespaces,proto3" json:"namespaces,omitempty"`
+	// only ports of these protocols are considered, the protocol is parsed from port name like http-web,
+	// and "unknown" stands for ports whose protocol can not be parsed
+	// default value is [http, http2, grpc]
+	Protocols            []string `protobuf:"bytes,3,rep,name=protocols,proto3" json:"protocols,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AutoPort) Reset()         { *m = AutoPort{} }
+func (m *AutoPort) String() string { return proto.CompactTextString(m) }
+func (*AutoPort) ProtoMessage()    {}
+func (*AutoPort) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{1}
+}
+func (m *AutoPort) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AutoPort.Unmarshal(m, b)
+}
+func (m *AutoPort) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AutoPort.Marshal(b, m, deterministic)
+}
+func (m *AutoPort) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AutoPort.Merge(m, src)
+}
+func (m *AutoPort) XXX_Size() int {
+	return xxx_messageInfo_AutoPort.Size(m)
+}
+func (m *AutoPort) XXX_DiscardUnknown() {
+	xxx_messageInfo_AutoPort.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AutoPort proto.InternalMessageInfo
+
+func (m *AutoPort) GetEnable() bool {
+	if m != nil {
+		return m.Enable
+	}
+	return false
+}
+
+func (m *AutoPort) GetNamespaces() []string {
+	if m != nil {
+		return m.Namespaces
+	}
+	return nil
+}
+
+func (m *AutoPort) GetProtocols() []string {
+	if m != nil {
+		return m.Protocols
+	}
+	return nil
+}
+
 // The general idea is to assign different default traffic to different targets
 // for correct processing by means of domain matching.
 type Dispatch struct {
@@ -124,7 +271,7 @@ func (m *Dispatch) Reset()         { *m = Dispatch{} }
 func (m *Dispatch) String() string { return proto.CompactTextString(m) }
 func (*Dispatch) ProtoMessage()    {}
 func (*Dispatch) Descriptor() ([]byte, []int) {
-	return fileDescriptor_8eebc4b237a55c9b, []int{1}
+	return fileDescriptor_8eebc4b237a55c9b, []int{2}
 }
 func (m *Dispatch) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Dispatch.Unmarshal(m, b)
@@ -184,7 +331,7 @@ func (m *DomainAlias) Reset()         { *m = DomainAlias{} }
 func (m *DomainAlias) String() string { return proto.CompactTextString(m) }
 func (*DomainAlias) ProtoMessage()    {}
 func (*DomainAlias) Descriptor() ([]byte, []int) {
-	return fileDescriptor_8eebc4b237a55c9b, []int{2}
+	return fileDescriptor_8eebc4b237a55c9b, []int{3}
 }
 func (m *DomainAlias) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DomainAlias.Unmarshal(m, b)
@@ -218,34 +365,919 @@ func (m *DomainAlias) GetTemplates() []string {
 	return nil
 }
 
+type MetricSource struct {
+	// enabled metric sources, prometheus or accesslog, and more than one source can be enabled at once
+	Types []string `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`
+	// listen address of accesslog source, like ":8082", required by accesslog source
+	LogSourcePort string `protobuf:"bytes,2,opt,name=logSourcePort,proto3" json:"logSourcePort,omitempty"`
+	// interval of refreshing metric of fences, like "30s"
+	// default value is 30s
+	RefreshInterval string `protobuf:"bytes,3,opt,name=refreshInterval,proto3" json:"refreshInterval,omitempty"`
+	// refresh recently changed fences more often and idle fences less
+	AdaptiveRefresh *AdaptiveRefresh `protobuf:"bytes,4,opt,name=adaptiveRefresh,proto3" json:"adaptiveRefresh,omitempty"`
+	// query each prometheus handler once for all fences instead of once per fence
+	PrometheusBatch *PrometheusBatch `protobuf:"bytes,5,opt,name=prometheusBatch,proto3" json:"prometheusBatch,omitempty"`
+	// authentication, tls and timeout of the client of metric.prometheus.address
+	PrometheusClient     *PrometheusClient `protobuf:"bytes,6,opt,name=prometheusClient,proto3" json:"prometheusClient,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *MetricSource) Reset()         { *m = MetricSource{} }
+func (m *MetricSource) String() string { return proto.CompactTextString(m) }
+func (*MetricSource) ProtoMessage()    {}
+func (*MetricSource) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{4}
+}
+func (m *MetricSource) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetricSource.Unmarshal(m, b)
+}
+func (m *MetricSource) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetricSource.Marshal(b, m, deterministic)
+}
+func (m *MetricSource) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetricSource.Merge(m, src)
+}
+func (m *MetricSource) XXX_Size() int {
+	return xxx_messageInfo_MetricSource.Size(m)
+}
+func (m *MetricSource) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetricSource.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetricSource proto.InternalMessageInfo
+
+func (m *MetricSource) GetTypes() []string {
+	if m != nil {
+		return m.Types
+	}
+	return nil
+}
+
+func (m *MetricSource) GetLogSourcePort() string {
+	if m != nil {
+		return m.LogSourcePort
+	}
+	return ""
+}
+
+func (m *MetricSource) GetRefreshInterval() string {
+	if m != nil {
+		return m.RefreshInterval
+	}
+	return ""
+}
+
+func (m *MetricSource) GetAdaptiveRefresh() *AdaptiveRefresh {
+	if m != nil {
+		return m.AdaptiveRefresh
+	}
+	return nil
+}
+
+func (m *MetricSource) GetPrometheusBatch() *PrometheusBatch {
+	if m != nil {
+		return m.PrometheusBatch
+	}
+	return nil
+}
+
+func (m *MetricSource) GetPrometheusClient() *PrometheusClient {
+	if m != nil {
+		return m.PrometheusClient
+	}
+	return nil
+}
+
+// AdaptiveRefresh starts each fence at refreshInterval, doubles its interval after each refresh
+// that does not change its metric, and resets it to refreshInterval once the metric changes
+type AdaptiveRefresh struct {
+	Enable bool `protobuf:"varint,1,opt,name=enable,proto3" json:"enable,omitempty"`
+	// max interval of idle fences, like "5m"
+	// default value is 10 times of refreshInterval
+	MaxInterval          string   `protobuf:"bytes,2,opt,name=maxInterval,proto3" json:"maxInterval,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AdaptiveRefresh) Reset()         { *m = AdaptiveRefresh{} }
+func (m *AdaptiveRefresh) String() string { return proto.CompactTextString(m) }
+func (*AdaptiveRefresh) ProtoMessage()    {}
+func (*AdaptiveRefresh) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{5}
+}
+func (m *AdaptiveRefresh) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AdaptiveRefresh.Unmarshal(m, b)
+}
+func (m *AdaptiveRefresh) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AdaptiveRefresh.Marshal(b, m, deterministic)
+}
+func (m *AdaptiveRefresh) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AdaptiveRefresh.Merge(m, src)
+}
+func (m *AdaptiveRefresh) XXX_Size() int {
+	return xxx_messageInfo_AdaptiveRefresh.Size(m)
+}
+func (m *AdaptiveRefresh) XXX_DiscardUnknown() {
+	xxx_messageInfo_AdaptiveRefresh.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AdaptiveRefresh proto.InternalMessageInfo
+
+func (m *AdaptiveRefresh) GetEnable() bool {
+	if m != nil {
+		return m.Enable
+	}
+	return false
+}
+
+func (m *AdaptiveRefresh) GetMaxInterval() string {
+	if m != nil {
+		return m.MaxInterval
+	}
+	return ""
+}
+
+// PrometheusBatch queries each prometheus handler with a grouped query once for all fences, and fans
+// the result out to fences by the source_app and source_namespace labels.
+// The default handler query is batched automatically, other handlers need a batch query in queries,
+// or they are queried per fence as before.
+type PrometheusBatch struct {
+	Enable bool `protobuf:"varint,1,opt,name=enable,proto3" json:"enable,omitempty"`
+	// batch queries of custom handlers
+	Queries              []*PrometheusBatchQuery `protobuf:"bytes,2,rep,name=queries,proto3" json:"queries,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                `json:"-"`
+	XXX_unrecognized     []byte                  `json:"-"`
+	XXX_sizecache        int32                   `json:"-"`
+}
+
+func (m *PrometheusBatch) Reset()         { *m = PrometheusBatch{} }
+func (m *PrometheusBatch) String() string { return proto.CompactTextString(m) }
+func (*PrometheusBatch) ProtoMessage()    {}
+func (*PrometheusBatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{6}
+}
+func (m *PrometheusBatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrometheusBatch.Unmarshal(m, b)
+}
+func (m *PrometheusBatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrometheusBatch.Marshal(b, m, deterministic)
+}
+func (m *PrometheusBatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrometheusBatch.Merge(m, src)
+}
+func (m *PrometheusBatch) XXX_Size() int {
+	return xxx_messageInfo_PrometheusBatch.Size(m)
+}
+func (m *PrometheusBatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrometheusBatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrometheusBatch proto.InternalMessageInfo
+
+func (m *PrometheusBatch) GetEnable() bool {
+	if m != nil {
+		return m.Enable
+	}
+	return false
+}
+
+func (m *PrometheusBatch) GetQueries() []*PrometheusBatchQuery {
+	if m != nil {
+		return m.Queries
+	}
+	return nil
+}
+
+type PrometheusBatchQuery struct {
+	// name of the prometheus handler
+	Handler string `protobuf:"bytes,1,opt,name=handler,proto3" json:"handler,omitempty"`
+	// query for all fences, its result should be grouped by source_app, and by source_namespace
+	// if the handler query contains $namespace, like
+	// sum(istio_requests_total{reporter="destination"})by(source_app, source_namespace, destination_service)
+	Query                string   `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PrometheusBatchQuery) Reset()         { *m = PrometheusBatchQuery{} }
+func (m *PrometheusBatchQuery) String() string { return proto.CompactTextString(m) }
+func (*PrometheusBatchQuery) ProtoMessage()    {}
+func (*PrometheusBatchQuery) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{7}
+}
+func (m *PrometheusBatchQuery) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrometheusBatchQuery.Unmarshal(m, b)
+}
+func (m *PrometheusBatchQuery) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrometheusBatchQuery.Marshal(b, m, deterministic)
+}
+func (m *PrometheusBatchQuery) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrometheusBatchQuery.Merge(m, src)
+}
+func (m *PrometheusBatchQuery) XXX_Size() int {
+	return xxx_messageInfo_PrometheusBatchQuery.Size(m)
+}
+func (m *PrometheusBatchQuery) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrometheusBatchQuery.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrometheusBatchQuery proto.InternalMessageInfo
+
+func (m *PrometheusBatchQuery) GetHandler() string {
+	if m != nil {
+		return m.Handler
+	}
+	return ""
+}
+
+func (m *PrometheusBatchQuery) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+type PrometheusClient struct {
+	// timeout of each query, like "10s", no timeout if unset
+	Timeout string `protobuf:"bytes,1,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	// bearer token sent in the Authorization header
+	BearerToken string `protobuf:"bytes,2,opt,name=bearerToken,proto3" json:"bearerToken,omitempty"`
+	// file of the bearer token, which is read on each query so that rotated tokens are used,
+	// takes precedence over bearerToken
+	BearerTokenFile      string               `protobuf:"bytes,3,opt,name=bearerTokenFile,proto3" json:"bearerTokenFile,omitempty"`
+	BasicAuth            *PrometheusBasicAuth `protobuf:"bytes,4,opt,name=basicAuth,proto3" json:"basicAuth,omitempty"`
+	Tls                  *PrometheusTLS       `protobuf:"bytes,5,opt,name=tls,proto3" json:"tls,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *PrometheusClient) Reset()         { *m = PrometheusClient{} }
+func (m *PrometheusClient) String() string { return proto.CompactTextString(m) }
+func (*PrometheusClient) ProtoMessage()    {}
+func (*PrometheusClient) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{8}
+}
+func (m *PrometheusClient) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrometheusClient.Unmarshal(m, b)
+}
+func (m *PrometheusClient) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrometheusClient.Marshal(b, m, deterministic)
+}
+func (m *PrometheusClient) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrometheusClient.Merge(m, src)
+}
+func (m *PrometheusClient) XXX_Size() int {
+	return xxx_messageInfo_PrometheusClient.Size(m)
+}
+func (m *PrometheusClient) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrometheusClient.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrometheusClient proto.InternalMessageInfo
+
+func (m *PrometheusClient) GetTimeout() string {
+	if m != nil {
+		return m.Timeout
+	}
+	return ""
+}
+
+func (m *PrometheusClient) GetBearerToken() string {
+	if m != nil {
+		return m.BearerToken
+	}
+	return ""
+}
+
+func (m *PrometheusClient) GetBearerTokenFile() string {
+	if m != nil {
+		return m.BearerTokenFile
+	}
+	return ""
+}
+
+func (m *PrometheusClient) GetBasicAuth() *PrometheusBasicAuth {
+	if m != nil {
+		return m.BasicAuth
+	}
+	return nil
+}
+
+func (m *PrometheusClient) GetTls() *PrometheusTLS {
+	if m != nil {
+		return m.Tls
+	}
+	return nil
+}
+
+type PrometheusBasicAuth struct {
+	Username string `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Password string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	// file of the password, takes precedence over password
+	PasswordFile         string   `protobuf:"bytes,3,opt,name=passwordFile,proto3" json:"passwordFile,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PrometheusBasicAuth) Reset()         { *m = PrometheusBasicAuth{} }
+func (m *PrometheusBasicAuth) String() string { return proto.CompactTextString(m) }
+func (*PrometheusBasicAuth) ProtoMessage()    {}
+func (*PrometheusBasicAuth) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{9}
+}
+func (m *PrometheusBasicAuth) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrometheusBasicAuth.Unmarshal(m, b)
+}
+func (m *PrometheusBasicAuth) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrometheusBasicAuth.Marshal(b, m, deterministic)
+}
+func (m *PrometheusBasicAuth) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrometheusBasicAuth.Merge(m, src)
+}
+func (m *PrometheusBasicAuth) XXX_Size() int {
+	return xxx_messageInfo_PrometheusBasicAuth.Size(m)
+}
+func (m *PrometheusBasicAuth) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrometheusBasicAuth.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrometheusBasicAuth proto.InternalMessageInfo
+
+func (m *PrometheusBasicAuth) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *PrometheusBasicAuth) GetPassword() string {
+	if m != nil {
+		return m.Password
+	}
+	return ""
+}
+
+func (m *PrometheusBasicAuth) GetPasswordFile() string {
+	if m != nil {
+		return m.PasswordFile
+	}
+	return ""
+}
+
+type PrometheusTLS struct {
+	// file of the CA certificates to verify the server, system CAs are used if unset
+	CaFile string `protobuf:"bytes,1,opt,name=caFile,proto3" json:"caFile,omitempty"`
+	// files of the client certificate and key for mutual tls
+	CertFile string `protobuf:"bytes,2,opt,name=certFile,proto3" json:"certFile,omitempty"`
+	KeyFile  string `protobuf:"bytes,3,opt,name=keyFile,proto3" json:"keyFile,omitempty"`
+	// server name to verify the certificate of the server
+	ServerName           string   `protobuf:"bytes,4,opt,name=serverName,proto3" json:"serverName,omitempty"`
+	InsecureSkipVerify   bool     `protobuf:"varint,5,opt,name=insecureSkipVerify,proto3" json:"insecureSkipVerify,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PrometheusTLS) Reset()         { *m = PrometheusTLS{} }
+func (m *PrometheusTLS) String() string { return proto.CompactTextString(m) }
+func (*PrometheusTLS) ProtoMessage()    {}
+func (*PrometheusTLS) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{10}
+}
+func (m *PrometheusTLS) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrometheusTLS.Unmarshal(m, b)
+}
+func (m *PrometheusTLS) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrometheusTLS.Marshal(b, m, deterministic)
+}
+func (m *PrometheusTLS) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrometheusTLS.Merge(m, src)
+}
+func (m *PrometheusTLS) XXX_Size() int {
+	return xxx_messageInfo_PrometheusTLS.Size(m)
+}
+func (m *PrometheusTLS) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrometheusTLS.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrometheusTLS proto.InternalMessageInfo
+
+func (m *PrometheusTLS) GetCaFile() string {
+	if m != nil {
+		return m.CaFile
+	}
+	return ""
+}
+
+func (m *PrometheusTLS) GetCertFile() string {
+	if m != nil {
+		return m.CertFile
+	}
+	return ""
+}
+
+func (m *PrometheusTLS) GetKeyFile() string {
+	if m != nil {
+		return m.KeyFile
+	}
+	return ""
+}
+
+func (m *PrometheusTLS) GetServerName() string {
+	if m != nil {
+		return m.ServerName
+	}
+	return ""
+}
+
+func (m *PrometheusTLS) GetInsecureSkipVerify() bool {
+	if m != nil {
+		return m.InsecureSkipVerify
+	}
+	return false
+}
+
+// StatusLimit caps the entries in status of a servicefence. The metric dependencies of the same host
+// are aggregated first, and then the ones with the smallest counts are dropped. Expired domains are
+// dropped before active ones. An event is recorded on the servicefence when its status is truncated.
+type StatusLimit struct {
+	// max number of status.metricDependencies
+	// default value is 1000
+	MaxMetricDependencies uint32 `protobuf:"varint,1,opt,name=maxMetricDependencies,proto3" json:"maxMetricDependencies,omitempty"`
+	// max number of status.domains
+	// default value is 1000
+	MaxDomains uint32 `protobuf:"varint,2,opt,name=maxDomains,proto3" json:"maxDomains,omitempty"`
+	// max number of status.visitor
+	// default value is 1000
+	MaxVisitors          uint32   `protobuf:"varint,3,opt,name=maxVisitors,proto3" json:"maxVisitors,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StatusLimit) Reset()         { *m = StatusLimit{} }
+func (m *StatusLimit) String() string { return proto.CompactTextString(m) }
+func (*StatusLimit) ProtoMessage()    {}
+func (*StatusLimit) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{11}
+}
+func (m *StatusLimit) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StatusLimit.Unmarshal(m, b)
+}
+func (m *StatusLimit) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StatusLimit.Marshal(b, m, deterministic)
+}
+func (m *StatusLimit) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StatusLimit.Merge(m, src)
+}
+func (m *StatusLimit) XXX_Size() int {
+	return xxx_messageInfo_StatusLimit.Size(m)
+}
+func (m *StatusLimit) XXX_DiscardUnknown() {
+	xxx_messageInfo_StatusLimit.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StatusLimit proto.InternalMessageInfo
+
+func (m *StatusLimit) GetMaxMetricDependencies() uint32 {
+	if m != nil {
+		return m.MaxMetricDependencies
+	}
+	return 0
+}
+
+func (m *StatusLimit) GetMaxDomains() uint32 {
+	if m != nil {
+		return m.MaxDomains
+	}
+	return 0
+}
+
+func (m *StatusLimit) GetMaxVisitors() uint32 {
+	if m != nil {
+		return m.MaxVisitors
+	}
+	return 0
+}
+
+// EgressAggregation replaces the hosts of services in a namespace with ns/* in the sidecar of a fence,
+// when the fraction of services of the namespace used by the fence reaches threshold. The hosts are
+// expanded back once the fraction drops below threshold. As ns/* only imports the config of the namespace,
+// VirtualServices and ServiceEntries of the services defined in other namespaces are not imported then.
+type EgressAggregation struct {
+	Enable bool `protobuf:"varint,1,opt,name=enable,proto3" json:"enable,omitempty"`
+	// fraction of services of a namespace, like 0.5
+	// default value is 0.5
+	Threshold float64 `protobuf:"fixed64,2,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	// namespaces with fewer services are never collapsed
+	// default value is 5
+	MinServices          uint32   `protobuf:"varint,3,opt,name=minServices,proto3" json:"minServices,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *EgressAggregation) Reset()         { *m = EgressAggregation{} }
+func (m *EgressAggregation) String() string { return proto.CompactTextString(m) }
+func (*EgressAggregation) ProtoMessage()    {}
+func (*EgressAggregation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{12}
+}
+func (m *EgressAggregation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_EgressAggregation.Unmarshal(m, b)
+}
+func (m *EgressAggregation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_EgressAggregation.Marshal(b, m, deterministic)
+}
+func (m *EgressAggregation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_EgressAggregation.Merge(m, src)
+}
+func (m *EgressAggregation) XXX_Size() int {
+	return xxx_messageInfo_EgressAggregation.Size(m)
+}
+func (m *EgressAggregation) XXX_DiscardUnknown() {
+	xxx_messageInfo_EgressAggregation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_EgressAggregation proto.InternalMessageInfo
+
+func (m *EgressAggregation) GetEnable() bool {
+	if m != nil {
+		return m.Enable
+	}
+	return false
+}
+
+func (m *EgressAggregation) GetThreshold() float64 {
+	if m != nil {
+		return m.Threshold
+	}
+	return 0
+}
+
+func (m *EgressAggregation) GetMinServices() uint32 {
+	if m != nil {
+		return m.MinServices
+	}
+	return 0
+}
+
+// SidecarUpdate delays the sidecar write of a fence until its status stops changing for debounce,
+// so that changes in a short time are batched into one write. Writes are also limited per fence by
+// minInterval and globally by qps and burst.
+type SidecarUpdate struct {
+	// quiet period before writing the sidecar of a fence, like "1s"
+	Debounce string `protobuf:"bytes,1,opt,name=debounce,proto3" json:"debounce,omitempty"`
+	// max delay of a write since the first change, like "10s"
+	// default value is 10 times of debounce
+	MaxDelay string `protobuf:"bytes,2,opt,name=maxDelay,proto3" json:"maxDelay,omitempty"`
+	// min interval between two writes of the sidecar of a fence, like "5s"
+	MinInterval string `protobuf:"bytes,3,opt,name=minInterval,proto3" json:"minInterval,omitempty"`
+	// max sidecar writes per second of all fences, no limit if unset
+	Qps float64 `protobuf:"fixed64,4,opt,name=qps,proto3" json:"qps,omitempty"`
+	// burst of qps
+	// default value is 1
+	Burst                uint32   `protobuf:"varint,5,opt,name=burst,proto3" json:"burst,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SidecarUpdate) Reset()         { *m = SidecarUpdate{} }
+func (m *SidecarUpdate) String() string { return proto.CompactTextString(m) }
+func (*SidecarUpdate) ProtoMessage()    {}
+func (*SidecarUpdate) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{13}
+}
+func (m *SidecarUpdate) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SidecarUpdate.Unmarshal(m, b)
+}
+func (m *SidecarUpdate) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SidecarUpdate.Marshal(b, m, deterministic)
+}
+func (m *SidecarUpdate) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SidecarUpdate.Merge(m, src)
+}
+func (m *SidecarUpdate) XXX_Size() int {
+	return xxx_messageInfo_SidecarUpdate.Size(m)
+}
+func (m *SidecarUpdate) XXX_DiscardUnknown() {
+	xxx_messageInfo_SidecarUpdate.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SidecarUpdate proto.InternalMessageInfo
+
+func (m *SidecarUpdate) GetDebounce() string {
+	if m != nil {
+		return m.Debounce
+	}
+	return ""
+}
+
+func (m *SidecarUpdate) GetMaxDelay() string {
+	if m != nil {
+		return m.MaxDelay
+	}
+	return ""
+}
+
+func (m *SidecarUpdate) GetMinInterval() string {
+	if m != nil {
+		return m.MinInterval
+	}
+	return ""
+}
+
+func (m *SidecarUpdate) GetQps() float64 {
+	if m != nil {
+		return m.Qps
+	}
+	return 0
+}
+
+func (m *SidecarUpdate) GetBurst() uint32 {
+	if m != nil {
+		return m.Burst
+	}
+	return 0
+}
+
+// GlobalSidecar makes the module render the global-sidecar ServiceAccount, Deployment, Service, Sidecar and
+// to-global-sidecar EnvoyFilter from the Fence config instead of the chart, so that changes of wormholePort
+// or dispatches take effect without reinstalling the chart. Rendered objects are labeled
+// app.kubernetes.io/created-by=fence-controller and removed once they are no longer rendered.
+type GlobalSidecar struct {
+	// whether render global-sidecar by the module
+	// default value is false
+	Render bool `protobuf:"varint,1,opt,name=render,proto3" json:"render,omitempty"`
+	// namespace of global-sidecar in cluster mode
+	// default value is the namespace of lazyload module
+	Namespace string `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	// image of global-sidecar, like slimeio/slime-global-sidecar:v0.5.0_linux_amd64
+	Image string `protobuf:"bytes,3,opt,name=image,proto3" json:"image,omitempty"`
+	// default value is 1
+	Replicas int32 `protobuf:"varint,4,opt,name=replicas,proto3" json:"replicas,omitempty"`
+	// port of health checks
+	// default value is 18181
+	ProbePort int32 `protobuf:"varint,5,opt,name=probePort,proto3" json:"probePort,omitempty"`
+	// compute resources of global-sidecar container
+	Resources *GlobalSidecarResources `protobuf:"bytes,6,opt,name=resources,proto3" json:"resources,omitempty"`
+	// extra labels of global-sidecar pods, like sidecar.istio.io/inject: "true"
+	Labels map[string]string `protobuf:"bytes,7,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// address of the dependency report endpoint of lazyload module, like lazyload.mesh-operator:8080
+	DependencyReportAddr string `protobuf:"bytes,8,opt,name=dependencyReportAddr,proto3" json:"dependencyReportAddr,omitempty"`
+	// access log format of global-sidecar, access log is disabled if unset
+	AccessLog            string   `protobuf:"bytes,9,opt,name=accessLog,proto3" json:"accessLog,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GlobalSidecar) Reset()         { *m = GlobalSidecar{} }
+func (m *GlobalSidecar) String() string { return proto.CompactTextString(m) }
+func (*GlobalSidecar) ProtoMessage()    {}
+func (*GlobalSidecar) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{14}
+}
+func (m *GlobalSidecar) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GlobalSidecar.Unmarshal(m, b)
+}
+func (m *GlobalSidecar) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GlobalSidecar.Marshal(b, m, deterministic)
+}
+func (m *GlobalSidecar) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GlobalSidecar.Merge(m, src)
+}
+func (m *GlobalSidecar) XXX_Size() int {
+	return xxx_messageInfo_GlobalSidecar.Size(m)
+}
+func (m *GlobalSidecar) XXX_DiscardUnknown() {
+	xxx_messageInfo_GlobalSidecar.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GlobalSidecar proto.InternalMessageInfo
+
+func (m *GlobalSidecar) GetRender() bool {
+	if m != nil {
+		return m.Render
+	}
+	return false
+}
+
+func (m *GlobalSidecar) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *GlobalSidecar) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *GlobalSidecar) GetReplicas() int32 {
+	if m != nil {
+		return m.Replicas
+	}
+	return 0
+}
+
+func (m *GlobalSidecar) GetProbePort() int32 {
+	if m != nil {
+		return m.ProbePort
+	}
+	return 0
+}
+
+func (m *GlobalSidecar) GetResources() *GlobalSidecarResources {
+	if m != nil {
+		return m.Resources
+	}
+	return nil
+}
+
+func (m *GlobalSidecar) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *GlobalSidecar) GetDependencyReportAddr() string {
+	if m != nil {
+		return m.DependencyReportAddr
+	}
+	return ""
+}
+
+func (m *GlobalSidecar) GetAccessLog() string {
+	if m != nil {
+		return m.AccessLog
+	}
+	return ""
+}
+
+// GlobalSidecarResources are quantities like corev1.ResourceRequirements, e.g. cpu: 200m
+type GlobalSidecarResources struct {
+	Requests             map[string]string `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Limits               map[string]string `protobuf:"bytes,2,rep,name=limits,proto3" json:"limits,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *GlobalSidecarResources) Reset()         { *m = GlobalSidecarResources{} }
+func (m *GlobalSidecarResources) String() string { return proto.CompactTextString(m) }
+func (*GlobalSidecarResources) ProtoMessage()    {}
+func (*GlobalSidecarResources) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8eebc4b237a55c9b, []int{15}
+}
+func (m *GlobalSidecarResources) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GlobalSidecarResources.Unmarshal(m, b)
+}
+func (m *GlobalSidecarResources) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GlobalSidecarResources.Marshal(b, m, deterministic)
+}
+func (m *GlobalSidecarResources) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GlobalSidecarResources.Merge(m, src)
+}
+func (m *GlobalSidecarResources) XXX_Size() int {
+	return xxx_messageInfo_GlobalSidecarResources.Size(m)
+}
+func (m *GlobalSidecarResources) XXX_DiscardUnknown() {
+	xxx_messageInfo_GlobalSidecarResources.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GlobalSidecarResources proto.InternalMessageInfo
+
+func (m *GlobalSidecarResources) GetRequests() map[string]string {
+	if m != nil {
+		return m.Requests
+	}
+	return nil
+}
+
+func (m *GlobalSidecarResources) GetLimits() map[string]string {
+	if m != nil {
+		return m.Limits
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Fence)(nil), "slime.microservice.lazyload.v1alpha1.Fence")
+	proto.RegisterType((*AutoPort)(nil), "slime.microservice.lazyload.v1alpha1.AutoPort")
 	proto.RegisterType((*Dispatch)(nil), "slime.microservice.lazyload.v1alpha1.Dispatch")
 	proto.RegisterType((*DomainAlias)(nil), "slime.microservice.lazyload.v1alpha1.DomainAlias")
+	proto.RegisterType((*MetricSource)(nil), "slime.microservice.lazyload.v1alpha1.MetricSource")
+	proto.RegisterType((*AdaptiveRefresh)(nil), "slime.microservice.lazyload.v1alpha1.AdaptiveRefresh")
+	proto.RegisterType((*PrometheusBatch)(nil), "slime.microservice.lazyload.v1alpha1.PrometheusBatch")
+	proto.RegisterType((*PrometheusBatchQuery)(nil), "slime.microservice.lazyload.v1alpha1.PrometheusBatchQuery")
+	proto.RegisterType((*PrometheusClient)(nil), "slime.microservice.lazyload.v1alpha1.PrometheusClient")
+	proto.RegisterType((*PrometheusBasicAuth)(nil), "slime.microservice.lazyload.v1alpha1.PrometheusBasicAuth")
+	proto.RegisterType((*PrometheusTLS)(nil), "slime.microservice.lazyload.v1alpha1.PrometheusTLS")
+	proto.RegisterType((*StatusLimit)(nil), "slime.microservice.lazyload.v1alpha1.StatusLimit")
+	proto.RegisterType((*EgressAggregation)(nil), "slime.microservice.lazyload.v1alpha1.EgressAggregation")
+	proto.RegisterType((*SidecarUpdate)(nil), "slime.microservice.lazyload.v1alpha1.SidecarUpdate")
+	proto.RegisterType((*GlobalSidecar)(nil), "slime.microservice.lazyload.v1alpha1.GlobalSidecar")
+	proto.RegisterMapType((map[string]string)(nil), "slime.microservice.lazyload.v1alpha1.GlobalSidecar.LabelsEntry")
+	proto.RegisterType((*GlobalSidecarResources)(nil), "slime.microservice.lazyload.v1alpha1.GlobalSidecarResources")
+	proto.RegisterMapType((map[string]string)(nil), "slime.microservice.lazyload.v1alpha1.GlobalSidecarResources.LimitsEntry")
+	proto.RegisterMapType((map[string]string)(nil), "slime.microservice.lazyload.v1alpha1.GlobalSidecarResources.RequestsEntry")
 }
 
 func init() { proto.RegisterFile("fence_module.proto", fileDescriptor_8eebc4b237a55c9b) }
 
 var fileDescriptor_8eebc4b237a55c9b = []byte{
-	// 319 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0x31, 0x4f, 0xeb, 0x30,
-	0x10, 0xc7, 0x95, 0xa6, 0xed, 0x6b, 0xdd, 0xf7, 0x16, 0x4f, 0x1e, 0xde, 0x10, 0x45, 0x0c, 0x19,
-	0x90, 0xa3, 0xc2, 0x27, 0x00, 0x01, 0x23, 0x42, 0x59, 0x90, 0x58, 0xd0, 0x91, 0x5c, 0x55, 0x4b,
-	0x76, 0x6c, 0xd9, 0x4e, 0x11, 0x7c, 0x2e, 0x3e, 0x20, 0xb2, 0x53, 0x2b, 0xed, 0xd6, 0xcd, 0xf7,
-	0x3f, 0xff, 0x7f, 0xba, 0xfb, 0xeb, 0x08, 0xdd, 0x61, 0xdf, 0xe2, 0xbb, 0xd2, 0xdd, 0x20, 0x91,
-	0x1b, 0xab, 0xbd, 0xa6, 0x57, 0x4e, 0x0a, 0x85, 0x5c, 0x89, 0xd6, 0x6a, 0x87, 0xf6, 0x20, 0x5a,
-	0xe4, 0x12, 0xbe, 0xbf, 0xa4, 0x86, 0x8e, 0x1f, 0xb6, 0x20, 0xcd, 0x1e, 0xb6, 0xe5, 0xcf, 0x8c,
-	0x2c, 0x9e, 0x82, 0x99, 0x96, 0xe4, 0xef, 0xa7, 0xb6, 0x6a, 0xaf, 0x25, 0xbe, 0x68, 0xeb, 0x59,
-	0x56, 0xe4, 0xd5, 0xba, 0x39, 0xd3, 0xe8, 0x7f, 0xb2, 0x86, 0xc1, 0xeb, 0x68, 0x60, 0xb3, 0x22,
-	0xab, 0x56, 0xcd, 0x24, 0x84, 0x6e, 0x0f, 0x0a, 0x9d, 0x81, 0x16, 0x59, 0x1e, 0xed, 0x93, 0x40,
-	0x9f, 0x09, 0xe9, 0x84, 0x33, 0xe0, 0xdb, 0x3d, 0x3a, 0x36, 0x2f, 0xf2, 0x6a, 0x73, 0xc3, 0xf9,
-	0x25, 0x43, 0xf2, 0x87, 0xa3, 0xaf, 0x39, 0x21, 0xd0, 0x57, 0xf2, 0xaf, 0xd3, 0x0a, 0x44, 0x7f,
-	0x27, 0x05, 0x38, 0x74, 0x6c, 0x11, 0x91, 0xdb, 0x0b, 0x91, 0x93, 0xb5, 0x39, 0xe7, 0x84, 0x20,
-	0x3a, 0xdc, 0xc1, 0x20, 0xfd, 0xb8, 0xe7, 0x32, 0xee, 0x79, 0xa6, 0x95, 0x0d, 0x59, 0xa5, 0xa1,
-	0x28, 0x25, 0xf3, 0xb0, 0x25, 0xcb, 0x8a, 0xac, 0x5a, 0x37, 0xf1, 0x4d, 0x19, 0xf9, 0x33, 0x42,
-	0x1d, 0x9b, 0xc5, 0x20, 0x52, 0x19, 0x3a, 0xad, 0x1c, 0x9c, 0x47, 0xcb, 0xf2, 0x68, 0x48, 0x65,
-	0xf9, 0x48, 0x36, 0x27, 0x53, 0x85, 0x8f, 0x06, 0xbc, 0x47, 0xdb, 0x1f, 0xc9, 0xa9, 0x0c, 0x39,
-	0x7b, 0x54, 0x46, 0x82, 0xc7, 0x84, 0x9f, 0x84, 0x7b, 0xfe, 0x76, 0x3d, 0x26, 0x20, 0x74, 0x1d,
-	0x1f, 0xf5, 0x78, 0x16, 0xae, 0x4e, 0x29, 0xd4, 0x60, 0x44, 0x9d, 0x92, 0xf8, 0x58, 0xc6, 0x73,
-	0xb9, 0xfd, 0x0d, 0x00, 0x00, 0xff, 0xff, 0x73, 0xd6, 0x40, 0xbd, 0x44, 0x02, 0x00, 0x00,
+	// 1293 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x57, 0xdb, 0x6e, 0x1b, 0x37,
+	0x13, 0x86, 0x2c, 0xcb, 0x96, 0x46, 0xd6, 0x6f, 0x87, 0x7f, 0x1a, 0x2c, 0x82, 0xa2, 0x10, 0x16,
+	0xb9, 0x30, 0x8a, 0x40, 0x46, 0x9c, 0x9e, 0x92, 0x16, 0x28, 0x9c, 0xc6, 0x69, 0x9b, 0x3a, 0x41,
+	0x4a, 0xa5, 0x31, 0x9a, 0x9b, 0x84, 0xda, 0x1d, 0x4b, 0x84, 0xb9, 0x07, 0x93, 0x5c, 0x27, 0xea,
+	0x4d, 0xaf, 0xfa, 0x00, 0xbd, 0x2b, 0xfa, 0x0e, 0x7d, 0x91, 0xbe, 0x40, 0x81, 0x3e, 0x4d, 0x41,
+	0x72, 0x8f, 0xb2, 0x03, 0x48, 0xce, 0xdd, 0xce, 0xc7, 0x9d, 0x6f, 0x38, 0x1f, 0x67, 0x86, 0xbb,
+	0x40, 0x4e, 0x30, 0x0e, 0xf0, 0x55, 0x94, 0x84, 0x99, 0xc0, 0x51, 0x2a, 0x13, 0x9d, 0x90, 0x5b,
+	0x4a, 0xf0, 0x08, 0x47, 0x11, 0x0f, 0x64, 0xa2, 0x50, 0x9e, 0xf3, 0x00, 0x47, 0x82, 0xfd, 0x32,
+	0x17, 0x09, 0x0b, 0x47, 0xe7, 0x77, 0x98, 0x48, 0x67, 0xec, 0x8e, 0xff, 0xf7, 0x26, 0x74, 0x1e,
+	0x19, 0x67, 0xe2, 0xc3, 0xd6, 0x9b, 0x44, 0x46, 0xb3, 0x44, 0xe0, 0xb3, 0x44, 0x6a, 0xaf, 0x35,
+	0x6c, 0xef, 0xf6, 0x68, 0x03, 0x23, 0x1f, 0x42, 0x8f, 0x65, 0x3a, 0xb1, 0x0e, 0xde, 0xda, 0xb0,
+	0xb5, 0xdb, 0xa5, 0x15, 0x60, 0x56, 0x63, 0x16, 0xa1, 0x4a, 0x59, 0x80, 0x5e, 0xdb, 0xba, 0x57,
+	0x00, 0x79, 0x0a, 0x10, 0x72, 0x95, 0x32, 0x1d, 0xcc, 0x50, 0x79, 0xeb, 0xc3, 0xf6, 0x6e, 0x7f,
+	0x7f, 0x34, 0x5a, 0x66, 0x93, 0xa3, 0x87, 0xb9, 0x1f, 0xad, 0x31, 0x90, 0x63, 0x18, 0x84, 0x49,
+	0xc4, 0x78, 0x7c, 0x20, 0x38, 0x53, 0xa8, 0xbc, 0x8e, 0xa5, 0xbc, 0xb3, 0x24, 0x65, 0xe5, 0x4a,
+	0x9b, 0x3c, 0x46, 0x88, 0x10, 0x4f, 0x58, 0x26, 0xb4, 0xcb, 0x73, 0xc3, 0xe6, 0xd9, 0xc0, 0xc8,
+	0x63, 0xe8, 0x9a, 0xbc, 0xad, 0x50, 0x9b, 0xc3, 0xd6, 0xf2, 0xa9, 0x1c, 0xe4, 0x5e, 0xb4, 0xf4,
+	0x27, 0x2f, 0x60, 0x2b, 0x42, 0x2d, 0x79, 0x30, 0x4e, 0x32, 0x19, 0xa0, 0xd7, 0xb5, 0x7c, 0xfb,
+	0xcb, 0xf1, 0x3d, 0xa9, 0x79, 0xd2, 0x06, 0x0f, 0xb9, 0x0d, 0xd7, 0xa6, 0x22, 0x99, 0x30, 0x31,
+	0xe6, 0x21, 0x06, 0x4c, 0x3e, 0x49, 0x42, 0xf4, 0x7a, 0xc3, 0xd6, 0x6e, 0x8f, 0x5e, 0x5c, 0x20,
+	0x63, 0xe8, 0x2b, 0xcd, 0x74, 0xa6, 0x8e, 0x78, 0xc4, 0xb5, 0x07, 0xc3, 0xd6, 0xf2, 0x62, 0x8e,
+	0x2b, 0x47, 0x5a, 0x67, 0x21, 0x08, 0xd7, 0x70, 0x2a, 0x51, 0xa9, 0x83, 0xe9, 0x54, 0xe2, 0x94,
+	0x69, 0x9e, 0xc4, 0x5e, 0xdf, 0x52, 0x7f, 0xbe, 0x1c, 0xf5, 0xe1, 0xa2, 0x3b, 0xbd, 0xc8, 0x48,
+	0x7e, 0x86, 0x81, 0x72, 0xa9, 0xfc, 0x94, 0x86, 0x4c, 0xa3, 0xb7, 0x65, 0x43, 0xdc, 0x5d, 0x72,
+	0xf7, 0x75, 0x57, 0xda, 0x64, 0x22, 0x1f, 0xc3, 0x4e, 0x0e, 0x1c, 0x4b, 0xae, 0xd1, 0x6a, 0x38,
+	0xb0, 0x1a, 0x5e, 0xc0, 0xc9, 0x2d, 0x18, 0x04, 0x22, 0x53, 0x1a, 0xa5, 0xab, 0x2e, 0xef, 0x7f,
+	0xf6, 0xc5, 0x26, 0x68, 0x36, 0xdb, 0x50, 0xdf, 0xdb, 0x5e, 0x65, 0xb3, 0xdf, 0xd6, 0x5d, 0x69,
+	0x93, 0xc9, 0x7f, 0x0d, 0xdd, 0xa2, 0xbe, 0xc8, 0x0d, 0xd8, 0xc0, 0x98, 0x4d, 0x04, 0x7a, 0x2d,
+	0x5b, 0xbf, 0xb9, 0x45, 0x3e, 0x02, 0x28, 0x7b, 0x52, 0x79, 0x6b, 0xb6, 0x4b, 0x6b, 0x88, 0x69,
+	0x62, 0x3b, 0x3f, 0x82, 0x44, 0xa8, 0xa2, 0x89, 0x4b, 0xc0, 0xa7, 0xd0, 0x2d, 0x9a, 0x91, 0x10,
+	0x58, 0x37, 0x7e, 0x96, 0xbf, 0x47, 0xed, 0x33, 0xf1, 0x60, 0xd3, 0x35, 0x53, 0x41, 0x5d, 0x98,
+	0x66, 0x25, 0xd7, 0xc1, 0x6b, 0x5b, 0x87, 0xc2, 0xf4, 0x0f, 0xa1, 0x5f, 0xeb, 0x46, 0xf3, 0x62,
+	0xca, 0xb4, 0x46, 0x19, 0xe7, 0xcc, 0x85, 0x69, 0xb6, 0xa6, 0x31, 0x4a, 0x05, 0xd3, 0xe5, 0xce,
+	0x2b, 0xc0, 0xff, 0xb3, 0x0d, 0x5b, 0xf5, 0x6e, 0x20, 0xd7, 0xa1, 0xa3, 0xe7, 0x29, 0xaa, 0x7c,
+	0x92, 0x39, 0xc3, 0x1c, 0x92, 0x48, 0xa6, 0xee, 0x15, 0xdb, 0xbe, 0x6b, 0xee, 0x90, 0x1a, 0x20,
+	0xd9, 0x85, 0x6d, 0x89, 0x27, 0x12, 0xd5, 0xec, 0xfb, 0x58, 0xa3, 0x3c, 0x67, 0x22, 0xdf, 0xf5,
+	0x22, 0x4c, 0x5e, 0xc1, 0x36, 0x0b, 0x59, 0xaa, 0xf9, 0x39, 0x52, 0xb7, 0xe4, 0xad, 0xdb, 0x03,
+	0xfd, 0x74, 0xc9, 0x81, 0xd0, 0x74, 0xa6, 0x8b, 0x6c, 0x26, 0x40, 0x2a, 0x93, 0x08, 0xf5, 0x0c,
+	0x33, 0xf5, 0xc0, 0x28, 0xef, 0x75, 0x56, 0x09, 0xf0, 0xac, 0xe9, 0x4c, 0x17, 0xd9, 0xc8, 0x04,
+	0x76, 0x2a, 0xe8, 0x1b, 0xc1, 0x31, 0xd6, 0x76, 0xe6, 0xf5, 0xf7, 0x3f, 0x5b, 0x35, 0x82, 0xf3,
+	0xa6, 0x17, 0xf8, 0xfc, 0x1f, 0x60, 0x7b, 0x21, 0xd1, 0x77, 0x16, 0xe8, 0x10, 0xfa, 0x11, 0x7b,
+	0x5b, 0xca, 0xee, 0x8e, 0xa7, 0x0e, 0xf9, 0xbf, 0xc2, 0xf6, 0x42, 0x52, 0xef, 0x24, 0x7b, 0x0e,
+	0x9b, 0x67, 0x19, 0x4a, 0x9e, 0x17, 0x4c, 0x7f, 0xff, 0xfe, 0x95, 0x44, 0xfb, 0x31, 0x43, 0x39,
+	0xa7, 0x05, 0x95, 0xff, 0x08, 0xae, 0x5f, 0xf6, 0x82, 0x29, 0xdd, 0x19, 0x8b, 0x43, 0x81, 0xb2,
+	0x28, 0xdd, 0xdc, 0x34, 0xb5, 0x68, 0x9c, 0xe7, 0x79, 0x3a, 0xce, 0xf0, 0xff, 0x58, 0x83, 0x9d,
+	0x45, 0xf1, 0x0c, 0x89, 0xe6, 0x11, 0x26, 0x99, 0x2e, 0x48, 0x72, 0xd3, 0x28, 0x33, 0x41, 0x26,
+	0x51, 0x3e, 0x4f, 0x4e, 0x31, 0x2e, 0x94, 0xa9, 0x41, 0xa6, 0x6c, 0x6b, 0xe6, 0x23, 0x2e, 0xb0,
+	0x28, 0xdb, 0x05, 0x98, 0x1c, 0x43, 0x6f, 0xc2, 0x14, 0x0f, 0x0e, 0x32, 0x5d, 0x14, 0xec, 0xbd,
+	0xd5, 0xa5, 0xc9, 0x09, 0x68, 0xc5, 0x45, 0x0e, 0xa1, 0xad, 0x85, 0xf2, 0x3a, 0xab, 0x0c, 0xb5,
+	0x8a, 0xf2, 0xf9, 0xd1, 0x98, 0x1a, 0x7f, 0xff, 0x0c, 0xfe, 0x7f, 0x49, 0x20, 0x72, 0x13, 0xba,
+	0x99, 0x42, 0x59, 0x9b, 0x3b, 0xa5, 0x6d, 0xd6, 0x52, 0xa6, 0xd4, 0x9b, 0x44, 0x86, 0xb9, 0x36,
+	0xa5, 0x6d, 0xee, 0xf4, 0xe2, 0xb9, 0xa6, 0x4a, 0x03, 0xf3, 0xff, 0x6a, 0xc1, 0xa0, 0xb1, 0x13,
+	0x53, 0x55, 0x01, 0xb3, 0xef, 0xbb, 0x58, 0xb9, 0x65, 0x22, 0x05, 0x28, 0xb5, 0x5d, 0xc9, 0x23,
+	0x15, 0xb6, 0x39, 0xbe, 0x53, 0x9c, 0xd7, 0x82, 0x14, 0xa6, 0x99, 0xbc, 0x46, 0x02, 0x94, 0x4f,
+	0xcd, 0xee, 0xd7, 0xed, 0x62, 0x0d, 0x21, 0x23, 0x20, 0x3c, 0x56, 0x18, 0x64, 0x12, 0xc7, 0xa7,
+	0x3c, 0x7d, 0x81, 0x92, 0x9f, 0xcc, 0xad, 0x90, 0x5d, 0x7a, 0xc9, 0x8a, 0xff, 0x5b, 0x0b, 0xfa,
+	0xb5, 0x9b, 0x97, 0x7c, 0x02, 0x1f, 0x44, 0xec, 0xad, 0x1b, 0x81, 0x0f, 0x31, 0xc5, 0x38, 0xc4,
+	0x38, 0xe0, 0x76, 0xfe, 0xb5, 0x76, 0x07, 0xf4, 0xf2, 0x45, 0xb3, 0xab, 0x88, 0xbd, 0x7d, 0x58,
+	0x0e, 0x6d, 0xf3, 0x6a, 0x0d, 0xc9, 0xdb, 0xf1, 0x05, 0x57, 0x5c, 0x27, 0x52, 0xd9, 0x9c, 0x06,
+	0xb4, 0x0e, 0xf9, 0xa7, 0x70, 0xed, 0xc2, 0x2d, 0xfd, 0xce, 0x86, 0x34, 0x33, 0x7c, 0x66, 0xfa,
+	0x3f, 0x11, 0xee, 0x94, 0x5a, 0xb4, 0x02, 0x6c, 0x30, 0x1e, 0x8f, 0x5d, 0xa1, 0x54, 0xc1, 0x2a,
+	0xc8, 0xff, 0xbd, 0x05, 0x83, 0xc6, 0x85, 0x6d, 0x0e, 0x23, 0xc4, 0x49, 0x92, 0xc5, 0x81, 0x8b,
+	0xd5, 0xa3, 0xa5, 0x6d, 0xd6, 0x4c, 0x2a, 0x28, 0x58, 0xd1, 0x79, 0xa5, 0x9d, 0xc7, 0x5a, 0x18,
+	0xef, 0x75, 0x88, 0xec, 0x40, 0xfb, 0x2c, 0x55, 0xf6, 0xa4, 0x5a, 0xd4, 0x3c, 0x9a, 0x36, 0x9e,
+	0x64, 0x52, 0x69, 0x7b, 0x2a, 0x03, 0xea, 0x0c, 0xff, 0x9f, 0x36, 0x0c, 0x1a, 0xf7, 0xb2, 0xc9,
+	0x5e, 0x1a, 0x89, 0x65, 0x91, 0xbd, 0xb3, 0x9a, 0x5f, 0xc8, 0x6e, 0x43, 0x15, 0x60, 0xd8, 0x79,
+	0xc4, 0xa6, 0x45, 0xe1, 0x38, 0xc3, 0xe4, 0x20, 0x31, 0x15, 0x3c, 0x60, 0x6e, 0x2b, 0x1d, 0x5a,
+	0xda, 0xf9, 0x65, 0x3d, 0x71, 0x17, 0x59, 0xc7, 0x2e, 0x56, 0x00, 0x79, 0x09, 0x3d, 0x89, 0xca,
+	0x5e, 0x6a, 0x2a, 0x9f, 0xe8, 0x5f, 0x5d, 0xe5, 0x2b, 0xa3, 0xe0, 0xa0, 0x15, 0x1d, 0x39, 0x86,
+	0x0d, 0xc1, 0x26, 0x28, 0x94, 0xb7, 0x69, 0xe7, 0xea, 0xd7, 0x57, 0x20, 0x1e, 0x1d, 0x59, 0x86,
+	0xc3, 0x58, 0xcb, 0x39, 0xcd, 0xe9, 0xc8, 0x3e, 0x5c, 0x0f, 0x8b, 0xfa, 0x9c, 0x53, 0x4c, 0x13,
+	0xa9, 0x0f, 0xc2, 0x50, 0xda, 0xaf, 0xe2, 0x1e, 0xbd, 0x74, 0xcd, 0xfe, 0x96, 0x04, 0x01, 0x2a,
+	0x75, 0x94, 0x4c, 0xf3, 0x2f, 0xdc, 0x0a, 0xb8, 0x79, 0x0f, 0xfa, 0xb5, 0x40, 0xe6, 0x54, 0x4f,
+	0x71, 0x9e, 0x97, 0x8a, 0x79, 0x34, 0xba, 0x9f, 0x33, 0x91, 0x15, 0x27, 0xe2, 0x8c, 0xfb, 0x6b,
+	0x5f, 0xb4, 0xfc, 0x7f, 0xd7, 0xe0, 0xc6, 0xe5, 0x5a, 0x90, 0x13, 0x73, 0x2c, 0x67, 0x19, 0x2a,
+	0xed, 0x3e, 0x30, 0xfa, 0xfb, 0x8f, 0xdf, 0x47, 0xdb, 0x11, 0xcd, 0xc9, 0x9c, 0x1a, 0x25, 0x37,
+	0x79, 0x0d, 0x1b, 0xc2, 0xb4, 0x77, 0x71, 0x81, 0x7d, 0xf7, 0x5e, 0x51, 0xec, 0xa4, 0x28, 0x15,
+	0xb7, 0xc6, 0xcd, 0x2f, 0x61, 0xd0, 0x08, 0xbe, 0x8a, 0x42, 0x56, 0xdc, 0x8a, 0x73, 0x15, 0xd7,
+	0x07, 0xa3, 0x97, 0xb7, 0x5d, 0x2a, 0x3c, 0xd9, 0xb3, 0x0f, 0x7b, 0xee, 0xff, 0x55, 0xed, 0x15,
+	0xe9, 0xec, 0xb1, 0x94, 0xef, 0x15, 0x29, 0x4d, 0x36, 0xec, 0x67, 0xe8, 0xdd, 0xff, 0x00, 0x00,
+	0x00, 0xff, 0xff, 0x03, 0x00, 0xd9, 0x64, 0x2c, 0x96, 0xed, 0x0e, 0x00, 0x00,
 }
@@ -520,12 +520,16 @@ func (m *Destinations) GetStatus() Destinations_Status {
 }
 
 type ServiceFenceStatus struct {
-	Domains              map[string]*Destinations `protobuf:"bytes,1,rep,name=domains,proto3" json:"domains,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	MetricStatus         map[string]string        `protobuf:"bytes,3,rep,name=metricStatus,proto3" json:"metricStatus,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	Visitor              map[string]bool          `protobuf:"bytes,2,rep,name=visitor,proto3" json:"visitor,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
-	XXX_NoUnkeyedLiteral struct{}                 `json:"-"`
-	XXX_unrecognized     []byte                   `json:"-"`
-	XXX_sizecache        int32                    `json:"-"`
+	Domains map[string]*Destinations `protobuf:"bytes,1,rep,name=domains,proto3" json:"domains,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Deprecated, raw metric like {destination_service="x.ns.svc.cluster.local"}: count,
+	// it is converted to metricDependencies and cleared on the next refresh
+	MetricStatus map[string]string `protobuf:"bytes,3,rep,name=metricStatus,proto3" json:"metricStatus,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Visitor      map[string]bool   `protobuf:"bytes,2,rep,name=visitor,proto3" json:"visitor,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	// destinations found in the metric, sorted by host and port
+	MetricDependencies   []*MetricDependency `protobuf:"bytes,4,rep,name=metricDependencies,proto3" json:"metricDependencies,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
 }
 
 func (m *ServiceFenceStatus) Reset()         { *m = ServiceFenceStatus{} }
@@ -573,6 +577,97 @@ func (m *ServiceFenceStatus) GetVisitor() map[string]bool {
 	return nil
 }
 
+func (m *ServiceFenceStatus) GetMetricDependencies() []*MetricDependency {
+	if m != nil {
+		return m.MetricDependencies
+	}
+	return nil
+}
+
+type MetricDependency struct {
+	// host of the destination, like reviews.default.svc.cluster.local
+	Host string `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	// port of the destination, 0 if unknown
+	Port uint32 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	// protocol of the destination, like http, empty if unknown
+	Protocol string `protobuf:"bytes,3,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	// number of requests to the destination in the metric
+	Count float64 `protobuf:"fixed64,4,opt,name=count,proto3" json:"count,omitempty"`
+	// last time the count of the destination changed
+	LastSeen *Timestamp `protobuf:"bytes,5,opt,name=lastSeen,proto3" json:"lastSeen,omitempty"`
+	// metric sources which found the destination, like prometheus and accesslog
+	Sources              []string `protobuf:"bytes,6,rep,name=sources,proto3" json:"sources,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MetricDependency) Reset()         { *m = MetricDependency{} }
+func (m *MetricDependency) String() string { return proto.CompactTextString(m) }
+func (*MetricDependency) ProtoMessage()    {}
+func (*MetricDependency) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b4b8d9f0db3c7310, []int{7}
+}
+func (m *MetricDependency) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetricDependency.Unmarshal(m, b)
+}
+func (m *MetricDependency) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetricDependency.Marshal(b, m, deterministic)
+}
+func (m *MetricDependency) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetricDependency.Merge(m, src)
+}
+func (m *MetricDependency) XXX_Size() int {
+	return xxx_messageInfo_MetricDependency.Size(m)
+}
+func (m *MetricDependency) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetricDependency.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetricDependency proto.InternalMessageInfo
+
+func (m *MetricDependency) GetHost() string {
+	if m != nil {
+		return m.Host
+	}
+	return ""
+}
+
+func (m *MetricDependency) GetPort() uint32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *MetricDependency) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
+func (m *MetricDependency) GetCount() float64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *MetricDependency) GetLastSeen() *Timestamp {
+	if m != nil {
+		return m.LastSeen
+	}
+	return nil
+}
+
+func (m *MetricDependency) GetSources() []string {
+	if m != nil {
+		return m.Sources
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("slime.microservice.lazyload.v1alpha1.Destinations_Status", Destinations_Status_name, Destinations_Status_value)
 	proto.RegisterType((*Timestamp)(nil), "slime.microservice.lazyload.v1alpha1.Timestamp")
@@ -591,59 +686,66 @@ func init() {
 	proto.RegisterMapType((map[string]*Destinations)(nil), "slime.microservice.lazyload.v1alpha1.ServiceFenceStatus.DomainsEntry")
 	proto.RegisterMapType((map[string]string)(nil), "slime.microservice.lazyload.v1alpha1.ServiceFenceStatus.MetricStatusEntry")
 	proto.RegisterMapType((map[string]bool)(nil), "slime.microservice.lazyload.v1alpha1.ServiceFenceStatus.VisitorEntry")
+	proto.RegisterType((*MetricDependency)(nil), "slime.microservice.lazyload.v1alpha1.MetricDependency")
 }
 
 func init() { proto.RegisterFile("service_fence.proto", fileDescriptor_b4b8d9f0db3c7310) }
 
 var fileDescriptor_b4b8d9f0db3c7310 = []byte{
-	// 775 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x96, 0xcd, 0x6e, 0xe3, 0x36,
-	0x10, 0xc7, 0x2b, 0x7f, 0x45, 0x1e, 0x3b, 0x81, 0xc3, 0x06, 0x85, 0xa1, 0x93, 0x61, 0xf4, 0xe0,
-	0x43, 0x20, 0x37, 0x2e, 0xd0, 0x36, 0x1f, 0x68, 0xf3, 0xe5, 0x36, 0x69, 0x1b, 0x20, 0xa5, 0x8c,
-	0x24, 0x08, 0x0a, 0x04, 0xb4, 0xc4, 0x24, 0x42, 0x24, 0x51, 0x10, 0x29, 0xb7, 0xee, 0xb1, 0x6f,
-	0xb2, 0xb7, 0xbd, 0xef, 0x63, 0xec, 0x1b, 0xec, 0xd3, 0x2c, 0x44, 0x4a, 0x82, 0x6c, 0x07, 0x58,
-	0xdb, 0xbb, 0x37, 0x52, 0xd4, 0xfc, 0x66, 0xfe, 0x33, 0xa3, 0xa1, 0xe0, 0x6b, 0x4e, 0xa3, 0x89,
-	0x6b, 0xd3, 0x87, 0x47, 0x1a, 0xd8, 0xd4, 0x0c, 0x23, 0x26, 0x18, 0xfa, 0x96, 0x7b, 0xae, 0x4f,
-	0x4d, 0xdf, 0xb5, 0x23, 0x96, 0x9e, 0x9b, 0x1e, 0xf9, 0x6f, 0xea, 0x31, 0xe2, 0x98, 0x93, 0x3d,
-	0xe2, 0x85, 0xcf, 0x64, 0xaf, 0x7b, 0x08, 0xf5, 0x91, 0xeb, 0x53, 0x2e, 0x88, 0x1f, 0xa2, 0x36,
-	0x6c, 0x70, 0x6a, 0xb3, 0xc0, 0xe1, 0x6d, 0xad, 0xa3, 0xf5, 0xca, 0x38, 0xdb, 0xa2, 0x1d, 0xa8,
-	0x06, 0x24, 0x60, 0xbc, 0x5d, 0xea, 0x68, 0xbd, 0x2a, 0x56, 0x9b, 0xee, 0x87, 0x32, 0xb4, 0x2c,
-	0x85, 0xfe, 0x35, 0xf1, 0x6c, 0x85, 0xd4, 0x46, 0x23, 0xa8, 0x3c, 0x33, 0x2e, 0xda, 0x5a, 0xa7,
-	0xdc, 0x6b, 0x0c, 0x8e, 0xcd, 0x65, 0xc2, 0x30, 0xe7, 0x29, 0xe6, 0x05, 0xe3, 0x62, 0x18, 0x88,
-	0x68, 0x8a, 0x25, 0x0d, 0x7d, 0x03, 0x35, 0x1a, 0x90, 0xb1, 0x47, 0x65, 0x04, 0x3a, 0x4e, 0x77,
-	0x68, 0x17, 0xb6, 0x03, 0xe2, 0x53, 0x1e, 0x12, 0x9b, 0x5a, 0xd4, 0xa3, 0xb6, 0x60, 0x51, 0xbb,
-	0xdc, 0x29, 0xf7, 0xea, 0x78, 0xf1, 0x00, 0x8d, 0x60, 0xd3, 0x23, 0x63, 0xea, 0xe5, 0x6f, 0x56,
-	0x64, 0x90, 0xe6, 0xb2, 0x41, 0x2a, 0x2b, 0x3c, 0x0b, 0x41, 0x63, 0x68, 0xfd, 0xc3, 0xa2, 0x97,
-	0xe4, 0xe5, 0x1c, 0x5c, 0xed, 0x68, 0xbd, 0xc6, 0xe0, 0x87, 0xe5, 0xc0, 0xb7, 0x73, 0xd6, 0x78,
-	0x81, 0x67, 0x84, 0x50, 0xcf, 0x53, 0x82, 0x5a, 0x50, 0x7e, 0xa1, 0x53, 0x59, 0xa3, 0x3a, 0x4e,
-	0x96, 0xe8, 0x0a, 0xaa, 0x13, 0xe2, 0xc5, 0x2a, 0x3b, 0x8d, 0xc1, 0x8f, 0xcb, 0xf9, 0xc5, 0xd4,
-	0x9e, 0xda, 0x9e, 0x1b, 0x3c, 0x59, 0x22, 0x22, 0x82, 0x3e, 0x4d, 0xb1, 0xa2, 0x1c, 0x94, 0x7e,
-	0xd2, 0xba, 0x6f, 0x34, 0xd0, 0x73, 0x89, 0x77, 0xa0, 0xf3, 0x4c, 0x9a, 0x2a, 0xec, 0xd1, 0x6a,
-	0x39, 0xcb, 0x17, 0xaa, 0xa8, 0x39, 0xcd, 0x38, 0x84, 0xcd, 0x99, 0xa3, 0x57, 0xc4, 0xed, 0x14,
-	0xc5, 0xd5, 0x8b, 0x31, 0xbe, 0xd7, 0xa0, 0x35, 0x9f, 0x3c, 0xd4, 0x81, 0xc6, 0x63, 0xc4, 0xfc,
-	0xb4, 0xa5, 0x24, 0x48, 0xc7, 0xc5, 0x47, 0xe8, 0x1e, 0x6a, 0xb2, 0x82, 0x49, 0x3b, 0x27, 0x5a,
-	0x4e, 0xd7, 0x2b, 0x93, 0xf9, 0xa7, 0x84, 0x28, 0x45, 0x29, 0xd1, 0xd8, 0x87, 0x46, 0xe1, 0xf1,
-	0x4a, 0x6a, 0xde, 0x56, 0x60, 0x7b, 0xa1, 0x24, 0xe8, 0x06, 0x6a, 0x5c, 0xc8, 0xce, 0xd7, 0x64,
-	0x6d, 0x7f, 0x5e, 0xb3, 0xb6, 0xa6, 0x25, 0x29, 0x38, 0xa5, 0xa1, 0xbf, 0x41, 0x77, 0x28, 0x71,
-	0x3c, 0x37, 0xc8, 0xba, 0xe6, 0x78, 0x5d, 0xf2, 0x79, 0xca, 0xc1, 0x39, 0x11, 0x5d, 0x43, 0x85,
-	0xc4, 0x82, 0xb5, 0xcb, 0x92, 0x7c, 0xb4, 0x2e, 0xf9, 0x24, 0x16, 0x0c, 0x4b, 0x12, 0xba, 0x85,
-	0x2d, 0x4c, 0x6d, 0x1a, 0x08, 0x6f, 0x7a, 0x46, 0x3c, 0x8f, 0x3a, 0xed, 0x8a, 0x64, 0xf7, 0x97,
-	0x63, 0xe7, 0x53, 0x0e, 0xcf, 0x61, 0x0c, 0x1d, 0x6a, 0x2a, 0x35, 0x86, 0x05, 0x7a, 0x26, 0x05,
-	0xfd, 0x06, 0x35, 0xfa, 0x6f, 0xe8, 0x46, 0x59, 0xda, 0x57, 0x76, 0x93, 0x9a, 0x1b, 0x16, 0x54,
-	0x12, 0x15, 0xe8, 0x0f, 0xd0, 0x9d, 0x38, 0x22, 0xc2, 0x65, 0xc1, 0xba, 0xc8, 0x1c, 0xd0, 0xfd,
-	0xbf, 0x04, 0xcd, 0x73, 0xca, 0x85, 0x1b, 0xc8, 0x3d, 0x7f, 0x25, 0x3b, 0xda, 0x17, 0xc9, 0x4e,
-	0xd2, 0xae, 0xc9, 0x00, 0x56, 0x9f, 0x4a, 0x1d, 0xab, 0x0d, 0xfa, 0x4b, 0x36, 0xa5, 0x88, 0xb9,
-	0x2c, 0xf0, 0xd6, 0x60, 0x7f, 0x39, 0x37, 0xc5, 0x90, 0x93, 0x7e, 0x14, 0x31, 0xc7, 0x29, 0xa8,
-	0xfb, 0x9d, 0x2c, 0x83, 0x88, 0x39, 0x02, 0xa8, 0x9d, 0x9c, 0x8d, 0x2e, 0x6f, 0x86, 0xad, 0xaf,
-	0x92, 0xf5, 0xf0, 0xee, 0xfa, 0x12, 0x0f, 0x5b, 0x1a, 0xda, 0x02, 0x50, 0xeb, 0xdb, 0x93, 0xcb,
-	0x51, 0xab, 0xd4, 0x7d, 0x57, 0x01, 0x34, 0x73, 0x71, 0x28, 0xf3, 0x07, 0xd8, 0x70, 0x98, 0x4f,
-	0xdc, 0x80, 0xa7, 0xa3, 0x6a, 0xb8, 0xc6, 0x1d, 0x24, 0x51, 0xe6, 0xb9, 0xe2, 0xa8, 0x2f, 0x3c,
-	0xa3, 0xa2, 0x00, 0x9a, 0x3e, 0x15, 0x91, 0x6b, 0x5b, 0x59, 0x0a, 0x12, 0x2f, 0xbf, 0xaf, 0xed,
-	0xe5, 0xaa, 0x00, 0x53, 0xae, 0x66, 0xf8, 0x89, 0xa0, 0x89, 0xcb, 0xdd, 0x64, 0xf6, 0x96, 0x3e,
-	0x53, 0xd0, 0x8d, 0xe2, 0xa4, 0x82, 0x52, 0xaa, 0x11, 0x40, 0xb3, 0xa8, 0xf4, 0x95, 0xa1, 0x75,
-	0x31, 0x7b, 0xbf, 0x0c, 0x56, 0x2f, 0x77, 0x61, 0xd0, 0x19, 0xbf, 0xc0, 0xf6, 0x82, 0xe6, 0x55,
-	0x26, 0xa5, 0x71, 0x00, 0xcd, 0xa2, 0x92, 0x4f, 0xd9, 0xea, 0x05, 0xdb, 0x53, 0xf3, 0x7e, 0x57,
-	0x05, 0xef, 0xb2, 0xbe, 0x5c, 0xf4, 0x7d, 0xe6, 0xc4, 0x1e, 0xe5, 0xfd, 0x4c, 0x40, 0x9f, 0x84,
-	0x6e, 0x3f, 0x13, 0x31, 0xae, 0xc9, 0xdf, 0xa9, 0xef, 0x3f, 0x06, 0x00, 0x00, 0xff, 0xff, 0x6f,
-	0xa9, 0x94, 0x30, 0x65, 0x09, 0x00, 0x00,
+	// 876 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x96, 0xcf, 0x8f, 0xdb, 0x44,
+	0x14, 0xc7, 0x71, 0x7e, 0xd5, 0x79, 0xd9, 0x5d, 0x65, 0x87, 0x0a, 0x59, 0x3e, 0x45, 0x11, 0x87,
+	0x1c, 0x2a, 0x87, 0x06, 0x09, 0x68, 0x8b, 0xa0, 0xdb, 0x6e, 0xa0, 0x0b, 0xac, 0x54, 0xc6, 0xd1,
+	0x6e, 0x55, 0x21, 0x55, 0xb3, 0xf6, 0x6c, 0x6b, 0xed, 0x78, 0xc6, 0xf2, 0x8c, 0x17, 0xc2, 0x91,
+	0x7f, 0x83, 0x13, 0x37, 0xfe, 0x17, 0x8e, 0xdc, 0xf8, 0x6b, 0xd0, 0xcc, 0xd8, 0x96, 0x93, 0xac,
+	0x44, 0x12, 0x7a, 0x9b, 0x67, 0x7b, 0x3e, 0xef, 0xbd, 0xef, 0x7b, 0xf3, 0xc6, 0xf0, 0xa1, 0xa4,
+	0xf9, 0x6d, 0x12, 0xd1, 0x37, 0xd7, 0x94, 0x47, 0x34, 0xc8, 0x72, 0xa1, 0x04, 0xfa, 0x58, 0xb2,
+	0x24, 0xa5, 0x41, 0x9a, 0x44, 0xb9, 0x28, 0xdf, 0x07, 0x8c, 0xfc, 0xba, 0x64, 0x82, 0xc4, 0xc1,
+	0xed, 0x43, 0xc2, 0xb2, 0x77, 0xe4, 0xe1, 0xf8, 0x09, 0xf4, 0x17, 0x49, 0x4a, 0xa5, 0x22, 0x69,
+	0x86, 0x3c, 0xb8, 0x27, 0x69, 0x24, 0x78, 0x2c, 0x3d, 0x67, 0xe4, 0x4c, 0xda, 0xb8, 0x32, 0xd1,
+	0x7d, 0xe8, 0x72, 0xc2, 0x85, 0xf4, 0x5a, 0x23, 0x67, 0xd2, 0xc5, 0xd6, 0x18, 0xff, 0xd3, 0x86,
+	0x61, 0x68, 0xd1, 0xdf, 0x68, 0xcf, 0x61, 0x46, 0x23, 0xb4, 0x80, 0xce, 0x3b, 0x21, 0x95, 0xe7,
+	0x8c, 0xda, 0x93, 0xc1, 0xec, 0x69, 0xb0, 0x4d, 0x18, 0xc1, 0x3a, 0x25, 0x78, 0x21, 0xa4, 0x9a,
+	0x73, 0x95, 0x2f, 0xb1, 0xa1, 0xa1, 0x8f, 0xa0, 0x47, 0x39, 0xb9, 0x62, 0xd4, 0x44, 0xe0, 0xe2,
+	0xd2, 0x42, 0x0f, 0xe0, 0x98, 0x93, 0x94, 0xca, 0x8c, 0x44, 0x34, 0xa4, 0x8c, 0x46, 0x4a, 0xe4,
+	0x5e, 0x7b, 0xd4, 0x9e, 0xf4, 0xf1, 0xe6, 0x0b, 0xb4, 0x80, 0x43, 0x46, 0xae, 0x28, 0xab, 0xbf,
+	0xec, 0x98, 0x20, 0x83, 0x6d, 0x83, 0xb4, 0xbb, 0xf0, 0x2a, 0x04, 0x5d, 0xc1, 0xf0, 0x67, 0x91,
+	0xdf, 0xe8, 0x8f, 0x6b, 0x70, 0x77, 0xe4, 0x4c, 0x06, 0xb3, 0xcf, 0xb6, 0x03, 0x5f, 0xae, 0xed,
+	0xc6, 0x1b, 0x3c, 0x3f, 0x83, 0x7e, 0x2d, 0x09, 0x1a, 0x42, 0xfb, 0x86, 0x2e, 0x4d, 0x8d, 0xfa,
+	0x58, 0x2f, 0xd1, 0x39, 0x74, 0x6f, 0x09, 0x2b, 0xac, 0x3a, 0x83, 0xd9, 0xe7, 0xdb, 0xf9, 0xc5,
+	0x34, 0x5a, 0x46, 0x2c, 0xe1, 0x6f, 0x43, 0x95, 0x13, 0x45, 0xdf, 0x2e, 0xb1, 0xa5, 0x3c, 0x6e,
+	0x7d, 0xe1, 0x8c, 0xff, 0x70, 0xc0, 0xad, 0x53, 0x7c, 0x05, 0xae, 0xac, 0x52, 0xb3, 0x85, 0xfd,
+	0x72, 0x37, 0xcd, 0xea, 0x85, 0x2d, 0x6a, 0x4d, 0xf3, 0x9f, 0xc0, 0xe1, 0xca, 0xab, 0x3b, 0x92,
+	0xbb, 0xdf, 0x4c, 0xae, 0xdf, 0x8c, 0xf1, 0x2f, 0x07, 0x86, 0xeb, 0xe2, 0xa1, 0x11, 0x0c, 0xae,
+	0x73, 0x91, 0x96, 0x2d, 0x65, 0x40, 0x2e, 0x6e, 0x3e, 0x42, 0xaf, 0xa1, 0x67, 0x2a, 0xa8, 0xdb,
+	0x59, 0xe7, 0xf2, 0x6c, 0xbf, 0x32, 0x05, 0x3f, 0x18, 0x88, 0xcd, 0xa8, 0x24, 0xfa, 0x8f, 0x60,
+	0xd0, 0x78, 0xbc, 0x53, 0x36, 0x7f, 0x76, 0xe0, 0x78, 0xa3, 0x24, 0xe8, 0x02, 0x7a, 0x52, 0x99,
+	0xce, 0x77, 0x4c, 0x6d, 0xbf, 0xda, 0xb3, 0xb6, 0x41, 0x68, 0x28, 0xb8, 0xa4, 0xa1, 0x9f, 0xc0,
+	0x8d, 0x29, 0x89, 0x59, 0xc2, 0xab, 0xae, 0x79, 0xba, 0x2f, 0xf9, 0xb4, 0xe4, 0xe0, 0x9a, 0x88,
+	0x5e, 0x42, 0x87, 0x14, 0x4a, 0x78, 0xed, 0x91, 0xb3, 0x7d, 0xb3, 0x6c, 0x92, 0x4f, 0x0a, 0x25,
+	0xb0, 0x21, 0xa1, 0x4b, 0x38, 0xc2, 0x34, 0xa2, 0x5c, 0xb1, 0xe5, 0x73, 0xc2, 0x18, 0x8d, 0xbd,
+	0x8e, 0x61, 0x4f, 0xb7, 0x63, 0xd7, 0x53, 0x0e, 0xaf, 0x61, 0x7c, 0x17, 0x7a, 0x56, 0x1a, 0x3f,
+	0x04, 0xb7, 0x4a, 0x05, 0x7d, 0x0b, 0x3d, 0xfa, 0x4b, 0x96, 0xe4, 0x95, 0xec, 0x3b, 0xbb, 0x29,
+	0xb7, 0xfb, 0x21, 0x74, 0x74, 0x16, 0xe8, 0x7b, 0x70, 0xe3, 0x22, 0x27, 0x2a, 0x11, 0x7c, 0x5f,
+	0x64, 0x0d, 0x18, 0xff, 0xd6, 0x82, 0x83, 0x53, 0x2a, 0x55, 0xc2, 0x8d, 0x2d, 0xef, 0x50, 0xc7,
+	0x79, 0x2f, 0xea, 0xe8, 0x76, 0xd5, 0x03, 0xd8, 0x1e, 0x95, 0x3e, 0xb6, 0x06, 0xfa, 0xd1, 0x34,
+	0xa5, 0x2a, 0xa4, 0x29, 0xf0, 0xd1, 0xec, 0xd1, 0x76, 0x6e, 0x9a, 0x21, 0xeb, 0x7e, 0x54, 0x85,
+	0xc4, 0x25, 0x68, 0xfc, 0x89, 0x29, 0x83, 0x2a, 0x24, 0x02, 0xe8, 0x9d, 0x3c, 0x5f, 0x9c, 0x5d,
+	0xcc, 0x87, 0x1f, 0xe8, 0xf5, 0xfc, 0xd5, 0xcb, 0x33, 0x3c, 0x1f, 0x3a, 0xe8, 0x08, 0xc0, 0xae,
+	0x2f, 0x4f, 0xce, 0x16, 0xc3, 0xd6, 0xf8, 0xf7, 0x2e, 0xa0, 0x95, 0x8b, 0xc3, 0x6e, 0x7f, 0x03,
+	0xf7, 0x62, 0x91, 0x92, 0x84, 0xcb, 0x72, 0x54, 0xcd, 0xf7, 0xb8, 0x83, 0x0c, 0x2a, 0x38, 0xb5,
+	0x1c, 0x7b, 0xc2, 0x2b, 0x2a, 0xe2, 0x70, 0x90, 0x52, 0x95, 0x27, 0x51, 0x58, 0x49, 0xa0, 0xbd,
+	0x7c, 0xb7, 0xb7, 0x97, 0xf3, 0x06, 0xcc, 0xba, 0x5a, 0xe1, 0xeb, 0x84, 0x6e, 0x13, 0x99, 0xe8,
+	0xd9, 0xdb, 0xfa, 0x9f, 0x09, 0x5d, 0x58, 0x4e, 0x99, 0x50, 0x49, 0x45, 0xd7, 0x80, 0xac, 0xc3,
+	0x53, 0x9a, 0x51, 0x1e, 0x53, 0x1e, 0x25, 0x54, 0x96, 0x77, 0xe3, 0x96, 0x57, 0xd8, 0xf9, 0xea,
+	0xfe, 0x25, 0xbe, 0x83, 0xe8, 0x73, 0x38, 0x68, 0x2a, 0x7a, 0xc7, 0x70, 0x7c, 0xb1, 0x7a, 0x8f,
+	0xcd, 0x76, 0x6f, 0xab, 0xc6, 0x40, 0xf5, 0xbf, 0x86, 0xe3, 0x0d, 0x6d, 0x77, 0x99, 0xc8, 0xfe,
+	0x63, 0x38, 0x68, 0x2a, 0xf6, 0x5f, 0x7b, 0xdd, 0xe6, 0x34, 0xff, 0xdb, 0x81, 0xe1, 0xba, 0x2a,
+	0x08, 0xd5, 0x3f, 0x47, 0x9a, 0x60, 0xd6, 0xfa, 0x59, 0x26, 0x72, 0x65, 0x08, 0x87, 0xd8, 0xac,
+	0x91, 0x0f, 0xae, 0xf9, 0x8b, 0x8b, 0x04, 0x33, 0x27, 0xac, 0x8f, 0x6b, 0x5b, 0xbb, 0x8c, 0x44,
+	0xc1, 0x95, 0x99, 0x7f, 0x0e, 0xb6, 0x86, 0x1e, 0x2f, 0x8c, 0x48, 0x15, 0x52, 0xca, 0xbd, 0xee,
+	0x7e, 0x47, 0xbf, 0x06, 0x98, 0x1f, 0x41, 0x51, 0xe4, 0x11, 0x95, 0x5e, 0xcf, 0x1c, 0xfb, 0xca,
+	0x7c, 0x16, 0xbc, 0x7e, 0x60, 0xa9, 0x89, 0x98, 0x9a, 0xc5, 0x34, 0x15, 0x71, 0xc1, 0xa8, 0x9c,
+	0x56, 0xe4, 0x29, 0xc9, 0x92, 0x69, 0x45, 0xbf, 0xea, 0x99, 0xb0, 0x3f, 0xfd, 0x17, 0x00, 0x00,
+	0xff, 0xff, 0x03, 0x00, 0xa4, 0x48, 0x88, 0xec, 0xa3, 0x0a, 0x00, 0x00,
 }
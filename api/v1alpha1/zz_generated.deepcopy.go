@@ -9,6 +9,58 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdaptiveRefresh) DeepCopyInto(out *AdaptiveRefresh) {
+	*out = *in
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdaptiveRefresh.
+func (in *AdaptiveRefresh) DeepCopy() *AdaptiveRefresh {
+	if in == nil {
+		return nil
+	}
+	out := new(AdaptiveRefresh)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoPort) DeepCopyInto(out *AutoPort) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Protocols != nil {
+		in, out := &in.Protocols, &out.Protocols
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoPort.
+func (in *AutoPort) DeepCopy() *AutoPort {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoPort)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Destinations) DeepCopyInto(out *Destinations) {
 	*out = *in
@@ -66,6 +118,53 @@ func (in *Dispatch) DeepCopy() *Dispatch {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DomainAlias) DeepCopyInto(out *DomainAlias) {
+	*out = *in
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DomainAlias.
+func (in *DomainAlias) DeepCopy() *DomainAlias {
+	if in == nil {
+		return nil
+	}
+	out := new(DomainAlias)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressAggregation) DeepCopyInto(out *EgressAggregation) {
+	*out = *in
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressAggregation.
+func (in *EgressAggregation) DeepCopy() *EgressAggregation {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressAggregation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Fence) DeepCopyInto(out *Fence) {
 	*out = *in
@@ -90,6 +189,47 @@ func (in *Fence) DeepCopyInto(out *Fence) {
 			}
 		}
 	}
+	if in.DomainAliases != nil {
+		in, out := &in.DomainAliases, &out.DomainAliases
+		*out = make([]*DomainAlias, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(DomainAlias)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.AutoPort != nil {
+		in, out := &in.AutoPort, &out.AutoPort
+		*out = new(AutoPort)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MetricSource != nil {
+		in, out := &in.MetricSource, &out.MetricSource
+		*out = new(MetricSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StatusLimit != nil {
+		in, out := &in.StatusLimit, &out.StatusLimit
+		*out = new(StatusLimit)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EgressAggregation != nil {
+		in, out := &in.EgressAggregation, &out.EgressAggregation
+		*out = new(EgressAggregation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SidecarUpdate != nil {
+		in, out := &in.SidecarUpdate, &out.SidecarUpdate
+		*out = new(SidecarUpdate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GlobalSidecar != nil {
+		in, out := &in.GlobalSidecar, &out.GlobalSidecar
+		*out = new(GlobalSidecar)
+		(*in).DeepCopyInto(*out)
+	}
 	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
 	if in.XXX_unrecognized != nil {
 		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
@@ -108,6 +248,272 @@ func (in *Fence) DeepCopy() *Fence {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GlobalSidecar) DeepCopyInto(out *GlobalSidecar) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(GlobalSidecarResources)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GlobalSidecar.
+func (in *GlobalSidecar) DeepCopy() *GlobalSidecar {
+	if in == nil {
+		return nil
+	}
+	out := new(GlobalSidecar)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GlobalSidecarResources) DeepCopyInto(out *GlobalSidecarResources) {
+	*out = *in
+	if in.Requests != nil {
+		in, out := &in.Requests, &out.Requests
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GlobalSidecarResources.
+func (in *GlobalSidecarResources) DeepCopy() *GlobalSidecarResources {
+	if in == nil {
+		return nil
+	}
+	out := new(GlobalSidecarResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricDependency) DeepCopyInto(out *MetricDependency) {
+	*out = *in
+	if in.LastSeen != nil {
+		in, out := &in.LastSeen, &out.LastSeen
+		*out = new(Timestamp)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricDependency.
+func (in *MetricDependency) DeepCopy() *MetricDependency {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricDependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricSource) DeepCopyInto(out *MetricSource) {
+	*out = *in
+	if in.Types != nil {
+		in, out := &in.Types, &out.Types
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdaptiveRefresh != nil {
+		in, out := &in.AdaptiveRefresh, &out.AdaptiveRefresh
+		*out = new(AdaptiveRefresh)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PrometheusBatch != nil {
+		in, out := &in.PrometheusBatch, &out.PrometheusBatch
+		*out = new(PrometheusBatch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PrometheusClient != nil {
+		in, out := &in.PrometheusClient, &out.PrometheusClient
+		*out = new(PrometheusClient)
+		(*in).DeepCopyInto(*out)
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricSource.
+func (in *MetricSource) DeepCopy() *MetricSource {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusBasicAuth) DeepCopyInto(out *PrometheusBasicAuth) {
+	*out = *in
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusBasicAuth.
+func (in *PrometheusBasicAuth) DeepCopy() *PrometheusBasicAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusBasicAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusBatch) DeepCopyInto(out *PrometheusBatch) {
+	*out = *in
+	if in.Queries != nil {
+		in, out := &in.Queries, &out.Queries
+		*out = make([]*PrometheusBatchQuery, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(PrometheusBatchQuery)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusBatch.
+func (in *PrometheusBatch) DeepCopy() *PrometheusBatch {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusBatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusBatchQuery) DeepCopyInto(out *PrometheusBatchQuery) {
+	*out = *in
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusBatchQuery.
+func (in *PrometheusBatchQuery) DeepCopy() *PrometheusBatchQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusBatchQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusClient) DeepCopyInto(out *PrometheusClient) {
+	*out = *in
+	if in.BasicAuth != nil {
+		in, out := &in.BasicAuth, &out.BasicAuth
+		*out = new(PrometheusBasicAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tls != nil {
+		in, out := &in.Tls, &out.Tls
+		*out = new(PrometheusTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusClient.
+func (in *PrometheusClient) DeepCopy() *PrometheusClient {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusClient)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusTLS) DeepCopyInto(out *PrometheusTLS) {
+	*out = *in
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusTLS.
+func (in *PrometheusTLS) DeepCopy() *PrometheusTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RecyclingStrategy) DeepCopyInto(out *RecyclingStrategy) {
 	*out = *in
@@ -398,6 +804,17 @@ func (in *ServiceFenceStatus) DeepCopyInto(out *ServiceFenceStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.MetricDependencies != nil {
+		in, out := &in.MetricDependencies, &out.MetricDependencies
+		*out = make([]*MetricDependency, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(MetricDependency)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
 	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
 	if in.XXX_unrecognized != nil {
 		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
@@ -416,6 +833,48 @@ func (in *ServiceFenceStatus) DeepCopy() *ServiceFenceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarUpdate) DeepCopyInto(out *SidecarUpdate) {
+	*out = *in
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarUpdate.
+func (in *SidecarUpdate) DeepCopy() *SidecarUpdate {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarUpdate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatusLimit) DeepCopyInto(out *StatusLimit) {
+	*out = *in
+	out.XXX_NoUnkeyedLiteral = in.XXX_NoUnkeyedLiteral
+	if in.XXX_unrecognized != nil {
+		in, out := &in.XXX_unrecognized, &out.XXX_unrecognized
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatusLimit.
+func (in *StatusLimit) DeepCopy() *StatusLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(StatusLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Timestamp) DeepCopyInto(out *Timestamp) {
 	*out = *in
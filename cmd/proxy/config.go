@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"slime.io/slime/modules/lazyload/pkg/proxy"
+)
+
+const (
+	EnvConfigFile = "CONFIG_FILE"
+	// EnvConfigReloadInterval is the interval of polling the config file for changes, like 2s
+	EnvConfigReloadInterval = "CONFIG_RELOAD_INTERVAL"
+	EnvWormholePorts        = "WORMHOLE_PORTS"
+	EnvProbePort            = "PROBE_PORT"
+	EnvLogLevel             = "LOG_LEVEL"
+	EnvLogFormat            = "LOG_FORMAT"
+	// EnvReportAddr is the lazyload controller url which accepts dependency reports,
+	// like http://lazyload.mesh-operator:8081/lazyload/dependency
+	EnvReportAddr = "DEPENDENCY_REPORT_ADDR"
+	// EnvReportTokenFile is the bearer token file of dependency reports, default the service account token
+	EnvReportTokenFile = "DEPENDENCY_REPORT_TOKEN_FILE"
+	// EnvAccessLog enables access log of proxy, only "json" is supported now
+	EnvAccessLog = "ACCESS_LOG"
+	// EnvReadinessDialTarget is dialed on readiness check, like egress.istio-system:80, disabled by default
+	EnvReadinessDialTarget = "READINESS_DIAL_TARGET"
+	// EnvDrainDelay is the duration between failing readiness and closing listeners after SIGTERM, like 5s
+	EnvDrainDelay = "DRAIN_DELAY"
+	// EnvDrainTimeout is the max duration waiting for in-flight requests after listeners are closed, like 30s
+	EnvDrainTimeout = "DRAIN_TIMEOUT"
+	// EnvClusterDomain is the domain suffix of the cluster, like cluster.local
+	EnvClusterDomain = "CLUSTER_DOMAIN"
+	// EnvDispatches are the dispatch rules in json, like Fence.Dispatches
+	// [{"name": "163", "domains": ["www.163.com"], "cluster": "outbound|80||egress1.testns.svc.cluster.local"}]
+	EnvDispatches = "DISPATCHES"
+	// EnvTrustedProxies are the comma separated addresses or cidrs whose X-Forwarded-For is trusted
+	EnvTrustedProxies = "TRUSTED_PROXIES"
+)
+
+// override is a config item which can be set by both environment variable and flag
+type override struct {
+	env   string
+	flag  string
+	usage string
+	apply func(cfg *proxy.Config, v string) error
+	// setInFile returns true if the item is set by the config file. It is only set for the items reloaded from
+	// the file, whose env is ignored then, otherwise the env of a stale deployment shadows the reloaded file.
+	setInFile func(cfg *proxy.Config) bool
+}
+
+var overrides = []override{
+	{EnvWormholePorts, "wormhole-ports", `ports proxy listens on, like "80,9080" or "80/http,443/https"`,
+		func(cfg *proxy.Config, v string) (err error) {
+			cfg.WormholePorts, err = proxy.ParsePorts(v)
+			return
+		},
+		func(cfg *proxy.Config) bool {
+			return len(cfg.WormholePorts) > 0
+		}},
+	{EnvProbePort, "probe-port", "port of health check and metrics",
+		func(cfg *proxy.Config, v string) (err error) {
+			if cfg.ProbePort, err = strconv.Atoi(v); err != nil {
+				err = fmt.Errorf("wrong probePort value %s", v)
+			}
+			return
+		}, nil},
+	{EnvLogLevel, "log-level", "log level",
+		func(cfg *proxy.Config, v string) error {
+			cfg.Log.Level = v
+			return nil
+		}, nil},
+	{EnvLogFormat, "log-format", "log format, text or json",
+		func(cfg *proxy.Config, v string) error {
+			cfg.Log.Format = v
+			return nil
+		}, nil},
+	{EnvAccessLog, "access-log", "access log format, empty means disabled",
+		func(cfg *proxy.Config, v string) error {
+			cfg.Log.AccessLog = v
+			return nil
+		}, nil},
+	{EnvReportAddr, "dependency-report-addr", "lazyload controller url which accepts dependency reports",
+		func(cfg *proxy.Config, v string) error {
+			cfg.DependencyReportAddr = v
+			return nil
+		}, nil},
+	{EnvReportTokenFile, "dependency-report-token-file", "bearer token file of dependency reports",
+		func(cfg *proxy.Config, v string) error {
+			cfg.DependencyReportTokenFile = v
+			return nil
+		}, nil},
+	{EnvReadinessDialTarget, "readiness-dial-target", `address dialed on readiness check, "none" disables it`,
+		func(cfg *proxy.Config, v string) error {
+			cfg.ReadinessDialTarget = v
+			return nil
+		}, nil},
+	{EnvDrainDelay, "drain-delay", "duration between failing readiness and closing listeners after SIGTERM",
+		func(cfg *proxy.Config, v string) (err error) {
+			if cfg.Timeouts.DrainDelay.Duration, err = time.ParseDuration(v); err != nil {
+				err = fmt.Errorf("wrong drainDelay value %s", v)
+			}
+			return
+		}, nil},
+	{EnvDrainTimeout, "drain-timeout", "max duration waiting for in-flight requests after listeners are closed",
+		func(cfg *proxy.Config, v string) (err error) {
+			if cfg.Timeouts.Drain.Duration, err = time.ParseDuration(v); err != nil {
+				err = fmt.Errorf("wrong drainTimeout value %s", v)
+			}
+			return
+		}, nil},
+	{EnvClusterDomain, "cluster-domain", "domain suffix of the cluster used to complete short names",
+		func(cfg *proxy.Config, v string) error {
+			cfg.Resolver.ClusterDomain = v
+			return nil
+		}, nil},
+	{EnvDispatches, "dispatches", "dispatch rules in json, like Fence.Dispatches",
+		func(cfg *proxy.Config, v string) error {
+			cfg.Dispatches = nil
+			if err := json.Unmarshal([]byte(v), &cfg.Dispatches); err != nil {
+				return fmt.Errorf("wrong dispatches value %s, %v", v, err)
+			}
+			return nil
+		},
+		func(cfg *proxy.Config) bool {
+			return len(cfg.Dispatches) > 0
+		}},
+	{EnvTrustedProxies, "trusted-proxies", `addresses or cidrs whose X-Forwarded-For is trusted, like "127.0.0.0/8"`,
+		func(cfg *proxy.Config, v string) error {
+			cfg.TrustedProxies = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					cfg.TrustedProxies = append(cfg.TrustedProxies, item)
+				}
+			}
+			return nil
+		}, nil},
+}
+
+const defaultConfigReloadInterval = 2 * time.Second
+
+type options struct {
+	configFile     string
+	reloadInterval time.Duration
+	flagValues     map[string]*string
+	setFlags       map[string]bool
+}
+
+func parseOptions(args []string) (*options, error) {
+	fs := flag.NewFlagSet("proxy", flag.ContinueOnError)
+	opts := &options{
+		flagValues: map[string]*string{},
+		setFlags:   map[string]bool{},
+	}
+	fs.StringVar(&opts.configFile, "config", os.Getenv(EnvConfigFile), "path of yaml or json config file")
+	reloadInterval := defaultConfigReloadInterval
+	if v := os.Getenv(EnvConfigReloadInterval); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			err = fmt.Errorf("env %s: invalid interval %s", EnvConfigReloadInterval, v)
+			fmt.Fprintln(fs.Output(), err)
+			return nil, err
+		}
+		reloadInterval = d
+	}
+	fs.DurationVar(&opts.reloadInterval, "config-reload-interval", reloadInterval,
+		"interval of polling the config file for changes")
+	for _, o := range overrides {
+		opts.flagValues[o.flag] = fs.String(o.flag, "", fmt.Sprintf("%s, overrides env %s", o.usage, o.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if opts.reloadInterval <= 0 {
+		err := fmt.Errorf("flag -config-reload-interval: invalid interval %s", opts.reloadInterval)
+		fmt.Fprintln(fs.Output(), err)
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		opts.setFlags[f.Name] = true
+	})
+	return opts, nil
+}
+
+// loadConfig builds and validates config in order: defaults, config file, environment variables, flags.
+// The wormhole ports and dispatches set by the config file are not overridden by environment variables.
+func loadConfig(opts *options) (*proxy.Config, error) {
+	cfg := proxy.DefaultConfig()
+	fromFile := map[string]bool{}
+	if opts.configFile != "" {
+		if err := proxy.LoadConfigFile(cfg, opts.configFile); err != nil {
+			return nil, err
+		}
+		for _, o := range overrides {
+			if o.setInFile != nil && o.setInFile(cfg) {
+				fromFile[o.env] = true
+			}
+		}
+	}
+
+	for _, o := range overrides {
+		if v, ok := os.LookupEnv(o.env); ok && v != "" {
+			if fromFile[o.env] {
+				log.Warnf("env %s is ignored as it is set by config file %s", o.env, opts.configFile)
+				continue
+			}
+			if err := o.apply(cfg, v); err != nil {
+				return nil, fmt.Errorf("env %s: %v", o.env, err)
+			}
+		}
+	}
+	for _, o := range overrides {
+		if opts.setFlags[o.flag] {
+			if err := o.apply(cfg, *opts.flagValues[o.flag]); err != nil {
+				return nil, fmt.Errorf("flag -%s: %v", o.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseOptions(t *testing.T) {
+	if _, err := parseOptions([]string{"-h"}); err != flag.ErrHelp {
+		t.Errorf("-h: got err %v, want %v", err, flag.ErrHelp)
+	}
+	if _, err := parseOptions([]string{"-unknown"}); err == nil {
+		t.Errorf("unknown flag is not rejected")
+	}
+	if _, err := parseOptions([]string{"-config-reload-interval", "0s"}); err == nil {
+		t.Errorf("zero reload interval is not rejected")
+	}
+
+	opts, err := parseOptions([]string{"-probe-port", "18182", "-config-reload-interval", "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.setFlags["probe-port"] || opts.setFlags["log-level"] || opts.reloadInterval != 5*time.Second {
+		t.Errorf("got options %+v", opts)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("wormholePorts:\n- port: 9080\nlog:\n  level: debug\n  format: json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// file < env < flag
+	defer os.Unsetenv(EnvLogLevel)
+	defer os.Unsetenv(EnvProbePort)
+	_ = os.Setenv(EnvLogLevel, "warn")
+	_ = os.Setenv(EnvProbePort, "18182")
+	opts, err := parseOptions([]string{"-config", path, "-probe-port", "18183"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.WormholePorts[0].Port != 9080 || cfg.Log.Format != "json" || cfg.Log.Level != "warn" || cfg.ProbePort != 18183 {
+		t.Errorf("got config %+v", cfg)
+	}
+
+	_ = os.Setenv(EnvProbePort, "probe")
+	if opts, err = parseOptions([]string{"-config", path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(opts); err == nil {
+		t.Errorf("invalid env is not rejected")
+	}
+
+	// wormhole ports of the file are not shadowed by env
+	defer os.Unsetenv(EnvWormholePorts)
+	_ = os.Setenv(EnvWormholePorts, "80")
+	_ = os.Unsetenv(EnvProbePort)
+	if opts, err = parseOptions([]string{"-config", path}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = loadConfig(opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.WormholePorts) != 1 || cfg.WormholePorts[0].Port != 9080 {
+		t.Errorf("got wormhole ports %+v, want the ones of file", cfg.WormholePorts)
+	}
+	if opts, err = parseOptions(nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = loadConfig(opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.WormholePorts) != 1 || cfg.WormholePorts[0].Port != 80 {
+		t.Errorf("got wormhole ports %+v, want the ones of env without file", cfg.WormholePorts)
+	}
+
+	if opts, err = parseOptions([]string{"-config", path, "-wormhole-ports", "18181"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(opts); err == nil {
+		t.Errorf("wormhole port conflicting with probe port is not rejected")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"slime.io/slime/modules/lazyload/pkg/proxy"
+)
+
+// listenerSet serves a proxy on each wormhole port. Ports are added or removed on config reload,
+// so that changes of wormhole ports do not need a restart.
+type listenerSet struct {
+	healthz  *proxy.HealthzProxy
+	reporter *proxy.DependencyReporter
+
+	mu        sync.Mutex
+	listeners map[int]*listener
+	wg        sync.WaitGroup
+}
+
+type listener struct {
+	server  *http.Server
+	handler *proxy.Proxy
+}
+
+func newListenerSet(healthz *proxy.HealthzProxy, reporter *proxy.DependencyReporter) *listenerSet {
+	return &listenerSet{
+		healthz:   healthz,
+		reporter:  reporter,
+		listeners: map[int]*listener{},
+	}
+}
+
+// add starts the proxy on port
+func (s *listenerSet) add(port int, cfg *proxy.Config) error {
+	handler, err := proxy.NewProxy(port, cfg, s.reporter)
+	if err != nil {
+		return err
+	}
+	addr := "0.0.0.0" + ":" + strconv.Itoa(port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	l := &listener{server: &http.Server{Handler: handler}, handler: handler}
+
+	s.mu.Lock()
+	s.listeners[port] = l
+	s.mu.Unlock()
+	s.healthz.SetListenerBound(port, true)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		log.Println("Starting proxy on", addr)
+		if err := l.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Proxy on %s exited, %v", addr, err)
+		}
+		s.mu.Lock()
+		if s.listeners[port] == l {
+			// exited unexpectedly, fail readiness
+			s.healthz.SetListenerBound(port, false)
+		}
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+// update applies cfg to the serving proxies, starts the added ports and drains the removed ones
+// within the drain timeout of cfg
+func (s *listenerSet) update(cfg *proxy.Config) {
+	want := make(map[int]bool, len(cfg.WormholePorts))
+	for _, port := range cfg.Ports() {
+		want[port] = true
+	}
+
+	s.mu.Lock()
+	var removed []*listener
+	for port, l := range s.listeners {
+		if want[port] {
+			if err := l.handler.UpdateConfig(cfg); err != nil {
+				log.Errorf("apply config to proxy on port %d failed, keep the previous one, %v", port, err)
+			}
+			continue
+		}
+		delete(s.listeners, port)
+		s.healthz.RemoveListener(port)
+		removed = append(removed, l)
+		log.Infof("Wormhole port %d is removed, closing its listener", port)
+	}
+	var added []int
+	for port := range want {
+		if _, ok := s.listeners[port]; !ok {
+			added = append(added, port)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, port := range added {
+		if err := s.add(port, cfg); err != nil {
+			log.Errorf("start proxy on added wormhole port %d failed, %v", port, err)
+			// keep readiness failed until it is fixed
+			s.healthz.SetListenerBound(port, false)
+		}
+	}
+	for _, l := range removed {
+		go shutdownServer(l.server, cfg.Timeouts.Drain.Duration)
+	}
+}
+
+// shutdown drains all listeners within timeout and waits for them to exit
+func (s *listenerSet) shutdown(timeout time.Duration) {
+	s.mu.Lock()
+	servers := make([]*http.Server, 0, len(s.listeners))
+	for port, l := range s.listeners {
+		servers = append(servers, l.server)
+		delete(s.listeners, port)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			shutdownServer(server, timeout)
+		}(server)
+	}
+	wg.Wait()
+	s.wg.Wait()
+}
+
+func shutdownServer(server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Proxy shutdown error: %v", err)
+		_ = server.Close()
+	}
+}
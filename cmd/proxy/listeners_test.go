@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"slime.io/slime/modules/lazyload/pkg/proxy"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func listening(port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+func TestListenerSetUpdatePorts(t *testing.T) {
+	p1, p2 := freePort(t), freePort(t)
+	cfg := proxy.DefaultConfig()
+	cfg.ReadinessDialTarget = proxy.ReadinessDialTargetNone
+	cfg.WormholePorts = []proxy.PortConfig{{Port: p1}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	healthz := proxy.NewHealthzProxy(cfg.Ports())
+	s := newListenerSet(healthz, nil)
+	if err := s.add(p1, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !listening(p1) || healthz.Ready() != nil {
+		t.Fatalf("proxy on %d is not ready, %v", p1, healthz.Ready())
+	}
+
+	newCfg := proxy.DefaultConfig()
+	newCfg.ReadinessDialTarget = proxy.ReadinessDialTargetNone
+	newCfg.WormholePorts = []proxy.PortConfig{{Port: p2}}
+	if err := newCfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s.update(newCfg)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for listening(p1) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if listening(p1) {
+		t.Errorf("removed port %d is still listening", p1)
+	}
+	if !listening(p2) {
+		t.Errorf("added port %d is not listening", p2)
+	}
+	if err := healthz.Ready(); err != nil {
+		t.Errorf("not ready after ports change, %v", err)
+	}
+
+	s.shutdown(time.Second)
+	if listening(p2) {
+		t.Errorf("port %d is still listening after shutdown", p2)
+	}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
-	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -13,68 +17,145 @@ import (
 	"slime.io/slime/modules/lazyload/pkg/proxy"
 )
 
-const (
-	EnvWormholePorts = "WORMHOLE_PORTS"
-	EnvProbePort     = "PROBE_PORT"
-	EnvLogLevel      = "LOG_LEVEL"
-)
-
 func main() {
-	// set log config
-	logLevel := os.Getenv(EnvLogLevel)
-	if logLevel == "" {
-		logLevel = "info"
+	opts, err := parseOptions(os.Args[1:])
+	if err == flag.ErrHelp {
+		// usage is printed already
+		os.Exit(0)
+	} else if err != nil {
+		// the error and usage are printed already
+		os.Exit(2)
 	}
-	level, err := log.ParseLevel(logLevel)
+	cfg, err := loadConfig(opts)
 	if err != nil {
+		log.Errorf("%v", err)
 		os.Exit(1)
 	}
-	log.SetLevel(level)
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: time.RFC3339,
-	})
+
+	// set log config
+	setLog(cfg)
 
 	// start health check server
-	probePort := ":" + os.Getenv(EnvProbePort)
+	healthz := proxy.NewHealthzProxy(cfg.Ports())
+	healthz.SetDialTarget(cfg.DialTarget())
+	healthzServer := &http.Server{Addr: ":" + strconv.Itoa(cfg.ProbePort), Handler: healthz}
 	go func() {
-		handler := &proxy.HealthzProxy{}
-		log.Println("Starting health check on", probePort)
-		if err := http.ListenAndServe(probePort, handler); err != nil {
+		log.Println("Starting health check on", healthzServer.Addr)
+		if err := healthzServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal("ListenAndServe:", err)
 		}
 	}()
 
+	// start dependency reporter
+	var reporter *proxy.DependencyReporter
+	reporterStop := make(chan struct{})
+	if addr := cfg.DependencyReportAddr; addr != "" {
+		reporter = proxy.NewDependencyReporter(addr, cfg.DependencyReportTokenFile)
+		go reporter.Run(reporterStop)
+		log.Infof("Reporting dependency to %s", addr)
+	}
+
 	// start multi ports defined in WormholePorts
-	wormholePorts := os.Getenv(EnvWormholePorts)
-	wormholePortsArr := strings.Split(wormholePorts, ",")
-	var whPorts []int
-	for _, whp := range wormholePortsArr {
-		if whp == probePort {
-			log.Errorf("wormholePort can not be %s, which is reserved for health check", probePort)
-			os.Exit(1)
+	listeners := newListenerSet(healthz, reporter)
+	for _, whPort := range cfg.Ports() {
+		if err := listeners.add(whPort, cfg); err != nil {
+			log.Fatalf("Start proxy on port %d error: %v", whPort, err)
 		}
+	}
 
-		p, err := strconv.Atoi(whp)
-		if err != nil {
-			log.Errorf("wrong wormholePort value %s", whp)
-			os.Exit(1)
-		}
-		whPorts = append(whPorts, p)
+	// hot reload config file
+	var (
+		cfgMu      sync.Mutex
+		currentCfg = cfg
+	)
+	reloadStop := make(chan struct{})
+	if opts.configFile != "" {
+		go watchConfig(opts, cfg, reloadStop, func(newCfg *proxy.Config) {
+			cfgMu.Lock()
+			currentCfg = newCfg
+			cfgMu.Unlock()
+			setLog(newCfg)
+			healthz.SetDialTarget(newCfg.DialTarget())
+			listeners.update(newCfg)
+		})
 	}
 
-	var wg sync.WaitGroup
-	for _, whPort := range whPorts {
-		wg.Add(1)
-		handler := &proxy.Proxy{WormholePort: whPort}
-		go func(whPort int) {
-			log.Println("Starting proxy on", "0.0.0.0"+":"+strconv.Itoa(whPort))
-			if err := http.ListenAndServe("0.0.0.0"+":"+strconv.Itoa(whPort), handler); err != nil {
-				log.Fatal("Proxy ListenAndServe error:", err)
-			}
-			wg.Done()
-		}(whPort)
+	// graceful shutdown: fail readiness, wait to be removed from endpoints, drain in-flight requests, then exit
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigs
+	close(reloadStop)
+	cfgMu.Lock()
+	cfg = currentCfg
+	cfgMu.Unlock()
+	healthz.SetShuttingDown()
+	if drainDelay := cfg.Timeouts.DrainDelay.Duration; drainDelay > 0 {
+		log.Infof("Received signal %v, keep serving for %s before closing listeners", sig, drainDelay)
+		select {
+		case <-time.After(drainDelay):
+		case sig = <-sigs:
+			log.Infof("Received signal %v again, skip the drain delay", sig)
+		}
 	}
+	drainTimeout := cfg.Timeouts.Drain.Duration
+	log.Infof("Closing listeners, draining in-flight requests within %s", drainTimeout)
 
-	wg.Wait()
+	listeners.shutdown(drainTimeout)
+	close(reporterStop)
+	_ = healthzServer.Close()
 	log.Infof("All servers exited.")
 }
+
+func setLog(cfg *proxy.Config) {
+	// level is validated already
+	level, _ := log.ParseLevel(cfg.Log.Level)
+	log.SetLevel(level)
+	if cfg.Log.Format == proxy.LogFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{
+			TimestampFormat: time.RFC3339,
+		})
+	} else {
+		log.SetFormatter(&log.TextFormatter{
+			TimestampFormat: time.RFC3339,
+		})
+	}
+}
+
+// watchConfig polls the config file every reload interval, and calls onChange with the new config if
+// the content changes and the config is valid. Changes of the probe port need a restart to take effect.
+func watchConfig(opts *options, cfg *proxy.Config, stop <-chan struct{}, onChange func(*proxy.Config)) {
+	last, _ := ioutil.ReadFile(opts.configFile)
+	ticker := time.NewTicker(opts.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		raw, err := ioutil.ReadFile(opts.configFile)
+		if err != nil {
+			log.Warnf("read config file %s failed, %v", opts.configFile, err)
+			continue
+		}
+		if bytes.Equal(raw, last) {
+			continue
+		}
+		last = raw
+
+		newCfg, err := loadConfig(opts)
+		if err != nil {
+			log.Errorf("reload config failed, keep the previous one, %v", err)
+			continue
+		}
+		if newCfg.ProbePort != cfg.ProbePort || newCfg.DependencyReportAddr != cfg.DependencyReportAddr ||
+			newCfg.DependencyReportTokenFile != cfg.DependencyReportTokenFile {
+			log.Warnf("changes of probePort, dependencyReportAddr or dependencyReportTokenFile take effect after restart")
+		}
+		log.Infof("config file %s reloaded", opts.configFile)
+		onChange(newCfg)
+		cfg = newCfg
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slime.io/slime/framework/apis/networking/v1alpha3"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// FieldManager is the field manager of lazyload in server-side apply, which owns the sidecar and
+// servicefence status fields written by lazyload
+const FieldManager = "lazyload"
+
+// applyOptions are the options of the server-side applies of lazyload. Ownership is forced, as the
+// fields applied are generated by lazyload and should not be changed by others.
+var applyOptions = []client.PatchOption{client.FieldOwner(FieldManager), client.ForceOwnership}
+
+// newApplyObject returns an apply configuration of gvk with the name, namespace, labels, annotations
+// and owner references of meta
+func newApplyObject(gvk schema.GroupVersionKind, meta metav1.Object) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	u.SetGroupVersionKind(gvk)
+	u.SetName(meta.GetName())
+	u.SetNamespace(meta.GetNamespace())
+	if labels := meta.GetLabels(); len(labels) > 0 {
+		u.SetLabels(labels)
+	}
+	if annotations := meta.GetAnnotations(); len(annotations) > 0 {
+		u.SetAnnotations(annotations)
+	}
+	if refs := meta.GetOwnerReferences(); len(refs) > 0 {
+		u.SetOwnerReferences(refs)
+	}
+	return u
+}
+
+// sidecarApplyObject returns the apply configuration of sidecar, only the given fields of its spec are included
+func sidecarApplyObject(sidecar *v1alpha3.Sidecar, fields ...string) *unstructured.Unstructured {
+	u := newApplyObject(v1alpha3.SchemeGroupVersion.WithKind("Sidecar"), sidecar)
+	spec := map[string]interface{}{}
+	for _, f := range fields {
+		if v, ok := sidecar.Spec[f]; ok {
+			spec[f] = v
+		}
+	}
+	u.Object["spec"] = spec
+	return u
+}
+
+// fenceStatusApplyObject returns the apply configuration of status of sf
+func fenceStatusApplyObject(sf *lazyloadv1alpha1.ServiceFence) (*unstructured.Unstructured, error) {
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&sf.Status)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+	u.SetGroupVersionKind(lazyloadv1alpha1.GroupVersion.WithKind("ServiceFence"))
+	u.SetName(sf.Name)
+	u.SetNamespace(sf.Namespace)
+	return u, nil
+}
+
+// updateFenceStatus applies status of sf after mutate is applied to the latest sf read from the apiserver,
+// nothing is written if status does not change. The whole status is applied by the field manager lazyload,
+// so it owns all the entries of the maps of status, and the entries dropped by mutate are removed by apply.
+// The entries written by update before are owned by the manager of the update and kept by apply, they are
+// removed by an update of status once.
+func (r *ServicefenceReconciler) updateFenceStatus(ctx context.Context, sf *lazyloadv1alpha1.ServiceFence,
+	mutate func(sf *lazyloadv1alpha1.ServiceFence)) error {
+	nn := types.NamespacedName{Namespace: sf.Namespace, Name: sf.Name}
+	err := r.applyFenceStatus(ctx, nn, sf, mutate)
+	if err != nil {
+		log.Errorf("update status of servicefence %s met err: %v", nn, err)
+	}
+	return err
+}
+
+func (r *ServicefenceReconciler) applyFenceStatus(ctx context.Context, nn types.NamespacedName, sf *lazyloadv1alpha1.ServiceFence,
+	mutate func(sf *lazyloadv1alpha1.ServiceFence)) error {
+	latest := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.apiReader().Get(ctx, nn, latest); err != nil {
+		return err
+	}
+	status := latest.Status.DeepCopy()
+	mutate(latest)
+	if equality.Semantic.DeepEqual(status, &latest.Status) {
+		latest.DeepCopyInto(sf)
+		return nil
+	}
+
+	obj, err := fenceStatusApplyObject(latest)
+	if err != nil {
+		return err
+	}
+	if err = r.Client.Status().Patch(ctx, obj, client.Apply, applyOptions...); err != nil {
+		return err
+	}
+	applied := &lazyloadv1alpha1.ServiceFence{}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, applied); err != nil {
+		return err
+	}
+	if hasStaleEntries(&applied.Status, &latest.Status) {
+		log.Infof("remove status entries of servicefence %s written by update before", nn)
+		latest.Status.DeepCopyInto(&applied.Status)
+		if err = r.Client.Status().Update(ctx, applied); err != nil {
+			return err
+		}
+	}
+	applied.DeepCopyInto(sf)
+	return nil
+}
+
+// hasStaleEntries returns whether the maps of status got have any entry not in want
+func hasStaleEntries(got, want *lazyloadv1alpha1.ServiceFenceStatus) bool {
+	for k := range got.Visitor {
+		if _, ok := want.Visitor[k]; !ok {
+			return true
+		}
+	}
+	for k := range got.Domains {
+		if _, ok := want.Domains[k]; !ok {
+			return true
+		}
+	}
+	for k := range got.MetricStatus {
+		if _, ok := want.MetricStatus[k]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apiReader returns the reader bypassing the cache, which is used to get the latest objects before writing them
+func (r *ServicefenceReconciler) apiReader() client.Reader {
+	if r.reader != nil {
+		return r.reader
+	}
+	return r.Client
+}
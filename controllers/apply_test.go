@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slime.io/slime/framework/apis/networking/v1alpha3"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func TestSidecarApplyObject(t *testing.T) {
+	sidecar := generatedSidecar("*/reviews.default.svc.cluster.local")
+	sidecar.Spec["ingress"] = []interface{}{map[string]interface{}{"defaultEndpoint": "127.0.0.1:9080"}}
+	sidecar.Labels = map[string]string{"istio.io/rev": "canary"}
+	sidecar.OwnerReferences = []metav1.OwnerReference{{APIVersion: "microservice.slime.io/v1alpha1", Kind: "ServiceFence", Name: "reviews"}}
+
+	obj := sidecarApplyObject(sidecar, "workloadSelector", "egress")
+	if obj.GetAPIVersion() != "networking.istio.io/v1alpha3" || obj.GetKind() != "Sidecar" {
+		t.Errorf("got apiVersion %s kind %s", obj.GetAPIVersion(), obj.GetKind())
+	}
+	if obj.GetName() != "reviews" || obj.GetNamespace() != "default" ||
+		!reflect.DeepEqual(obj.GetLabels(), sidecar.Labels) || len(obj.GetOwnerReferences()) != 1 {
+		t.Errorf("got metadata %v", obj.Object["metadata"])
+	}
+	spec := obj.Object["spec"].(map[string]interface{})
+	if _, ok := spec["ingress"]; ok || len(spec) != 2 {
+		t.Errorf("got spec %v, want only workloadSelector and egress", spec)
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"creationTimestamp", "resourceVersion", "annotations"} {
+		if strings.Contains(string(b), field) {
+			t.Errorf("apply configuration %s should not contain %s", b, field)
+		}
+	}
+}
+
+func TestRecordVisitorRemovesUpdatedVisitor(t *testing.T) {
+	reviews := testFence("default", "reviews")
+	reviews.Status.Visitor = map[string]bool{"default/productpage": true, "default/details": true}
+	r := newTestReconciler(t, nil, testService("default", "reviews"), reviews)
+	nn := types.NamespacedName{Namespace: "default", Name: "reviews"}
+
+	// the status written by update before
+	sf := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), nn, sf); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Client.Status().Update(context.TODO(), sf); err != nil {
+		t.Fatal(err)
+	}
+
+	r.recordVisitor(testFence("default", "productpage"), Diff{Deleted: []string{"reviews.default.svc.cluster.local"}})
+	sf = &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), nn, sf); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"default/details": true}; !reflect.DeepEqual(sf.Status.Visitor, want) {
+		t.Errorf("got visitor %v, want %v", sf.Status.Visitor, want)
+	}
+}
+
+func TestUpdateFenceStatusApplies(t *testing.T) {
+	r := newTestReconciler(t, nil, testService("default", "reviews"), testFence("default", "reviews"))
+	c := r.Client.(*applyClient)
+	nn := types.NamespacedName{Namespace: "default", Name: "reviews"}
+	// the cached fence is stale, another fence records its visit in the meantime
+	stale := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), nn, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.updateFenceStatus(context.TODO(), stale.DeepCopy(), func(sf *lazyloadv1alpha1.ServiceFence) {
+		sf.Status.Visitor = map[string]bool{"default/details": true}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.recordVisitor(testFence("default", "productpage"), Diff{Added: []string{"reviews.default.svc.cluster.local"}})
+	getVisitor := func() map[string]bool {
+		sf := &lazyloadv1alpha1.ServiceFence{}
+		if err := r.Client.Get(context.TODO(), nn, sf); err != nil {
+			t.Fatal(err)
+		}
+		return sf.Status.Visitor
+	}
+	if got, want := getVisitor(), map[string]bool{"default/details": true, "default/productpage": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got visitor %v, want %v", got, want)
+	}
+	if len(c.applies) != 2 {
+		t.Fatalf("got %d applies, want 2", len(c.applies))
+	}
+	for _, opts := range c.applies {
+		if opts.FieldManager != FieldManager || opts.Force == nil || !*opts.Force {
+			t.Errorf("status is applied with field manager %q force %v", opts.FieldManager, opts.Force)
+		}
+	}
+
+	// the entry removed is removed by apply
+	r.recordVisitor(testFence("default", "details"), Diff{Deleted: []string{"reviews.default.svc.cluster.local"}})
+	if got, want := getVisitor(), map[string]bool{"default/productpage": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got visitor %v, want %v", got, want)
+	}
+	if c.statusUpdates != 0 {
+		t.Errorf("status applied by lazyload is updated %d times", c.statusUpdates)
+	}
+
+	// nothing is written without changes
+	if err := r.updateFenceStatus(context.TODO(), stale, func(sf *lazyloadv1alpha1.ServiceFence) {
+		sf.Status.Visitor["default/productpage"] = true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.applies) != 3 {
+		t.Errorf("got %d applies, want no apply of unchanged status", len(c.applies))
+	}
+	if !stale.Status.Visitor["default/productpage"] {
+		t.Errorf("fence is not refreshed to the latest, got %v", stale.Status)
+	}
+}
+
+// staleClient returns the sidecars in stale on Get, like a cache not synced yet
+type staleClient struct {
+	client.Client
+	stale map[types.NamespacedName]*v1alpha3.Sidecar
+}
+
+func (c *staleClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if sidecar, ok := obj.(*v1alpha3.Sidecar); ok && c.stale[key] != nil {
+		c.stale[key].DeepCopyInto(sidecar)
+		return nil
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestApplySidecarInMergeMode(t *testing.T) {
+	sf := testFence("default", "reviews")
+	sf.Spec.Enable = true
+	sf.Status.Domains = map[string]*lazyloadv1alpha1.Destinations{
+		"details.default.svc.cluster.local": {
+			Hosts: []string{"details.default.svc.cluster.local"}, Status: lazyloadv1alpha1.Destinations_ACTIVE,
+		},
+	}
+	userListener := map[string]interface{}{
+		"port":  map[string]interface{}{"number": int64(3306), "protocol": "TCP", "name": "mysql"},
+		"hosts": []interface{}{"db/*"},
+	}
+	stale := generatedSidecar("istio-system/*")
+	latest := stale.DeepCopy()
+	latest.Spec["egress"] = append(latest.Spec["egress"].([]interface{}), userListener)
+
+	cases := []struct {
+		mode          string
+		wantForce     bool
+		wantListeners int
+	}{
+		{mode: SidecarWriteModeMerge, wantListeners: 2},
+		// egress is owned by lazyload as a whole in replace mode
+		{mode: SidecarWriteModeReplace, wantForce: true, wantListeners: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			r := newTestReconciler(t, &lazyloadv1alpha1.Fence{SidecarWriteMode: c.mode}, testService("default", "reviews"),
+				sf.DeepCopy(), latest.DeepCopy())
+			ac := r.Client.(*applyClient)
+			r.reader = ac
+			r.Client = &staleClient{Client: ac, stale: map[types.NamespacedName]*v1alpha3.Sidecar{
+				{Namespace: "default", Name: "reviews"}: stale,
+			}}
+			if err := r.applySidecar(sf); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ac.applies) != 1 {
+				t.Fatalf("got %d applies, want 1", len(ac.applies))
+			}
+			opts := ac.applies[0]
+			if force := opts.Force != nil && *opts.Force; opts.FieldManager != FieldManager || force != c.wantForce {
+				t.Errorf("sidecar is applied with field manager %q force %v, want force %v", opts.FieldManager, force, c.wantForce)
+			}
+			got := &v1alpha3.Sidecar{}
+			if err := ac.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "reviews"}, got); err != nil {
+				t.Fatal(err)
+			}
+			egress, _ := got.Spec["egress"].([]interface{})
+			if len(egress) != c.wantListeners {
+				t.Errorf("got egress %v, want %d listeners", egress, c.wantListeners)
+			}
+			want := []string{"*/details.default.svc.cluster.local", "*/global-sidecar.default.svc.cluster.local",
+				"istio-system/*", "mesh-operator/*"}
+			if hosts, _ := sidecarEgressHosts(got.Spec); !reflect.DeepEqual(hosts, want) {
+				t.Errorf("got hosts %v, want %v", hosts, want)
+			}
+		})
+	}
+}
+
+func TestApplyGlobalSidecarSidecar(t *testing.T) {
+	r := newTestReconciler(t, nil)
+	c := r.Client.(*applyClient)
+	for i := 0; i < 2; i++ {
+		sidecar, err := newGlobalSidecarSidecar("default", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.applyGlobalSidecarObject(context.TODO(), sidecar); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := &v1alpha3.Sidecar{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: GlobalSidecarName}, got); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := newGlobalSidecarSidecar("default", "")
+	if !reflect.DeepEqual(got.Spec, want.Spec) || got.Labels[LabelCreatedBy] != CreatedByFenceController {
+		t.Errorf("got sidecar %+v, want spec %v", got, want.Spec)
+	}
+	if len(c.applies) != 2 || c.applies[0].FieldManager != FieldManager {
+		t.Errorf("sidecar of global-sidecar is not applied by %s, got %v", FieldManager, c.applies)
+	}
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"slime.io/slime/framework/apis/config/v1alpha1"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod of lazyload module
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// defaults of the deprecated global.misc keys, which are always patched into global.misc by the framework.
+// A key holding its default can not be told from an unset one.
+var deprecatedMiscDefaults = map[string]string{
+	"metricSourceType":  MetricSourceTypePrometheus,
+	"logSourcePort":     ":8082",
+	"globalSidecarMode": GlobalSidecarModeNamespace,
+}
+
+// deprecatedMisc returns the value of global.misc[key] to fill the typed field replacing it, and false if
+// the typed field is set or the key is unset without a default. It warns whenever the key is set.
+func deprecatedMisc(misc map[string]string, key, replacement string, typedSet bool) (string, bool) {
+	v, ok := misc[key]
+	if def, patched := deprecatedMiscDefaults[key]; patched && v == def {
+		// patched by the framework
+		ok = false
+	}
+	if ok {
+		if typedSet {
+			log.Warningf("global.misc.%s is deprecated and ignored as %s of lazyload module is set", key, replacement)
+		} else {
+			log.Warningf("global.misc.%s is deprecated, use %s of lazyload module instead", key, replacement)
+		}
+	}
+	if typedSet {
+		return "", false
+	}
+	if !ok {
+		def, patched := deprecatedMiscDefaults[key]
+		return def, patched
+	}
+	return v, true
+}
+
+// ResolveFenceConfig fills the typed fields of cfg with the deprecated global.misc keys
+// metricSourceType, logSourcePort, globalSidecarMode, renderGlobalSidecar, globalSidecarImage,
+// globalSidecarReplicas and globalSidecarProbePort if they are unset, then validates them.
+// It should be called before NewReconciler.
+func ResolveFenceConfig(cfg *lazyloadv1alpha1.Fence, config *v1alpha1.Config) error {
+	var misc map[string]string
+	if config != nil && config.Global != nil {
+		misc = config.Global.Misc
+	}
+
+	if cfg.MetricSource == nil {
+		cfg.MetricSource = &lazyloadv1alpha1.MetricSource{}
+	}
+	ms := cfg.MetricSource
+	if v, ok := deprecatedMisc(misc, "metricSourceType", "metricSource.types", len(ms.Types) > 0); ok {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				ms.Types = append(ms.Types, t)
+			}
+		}
+	}
+	if v, ok := deprecatedMisc(misc, "logSourcePort", "metricSource.logSourcePort", ms.LogSourcePort != ""); ok {
+		ms.LogSourcePort = v
+	}
+	if ms.RefreshInterval == "" {
+		ms.RefreshInterval = defaultRefreshInterval.String()
+	}
+	if v, ok := deprecatedMisc(misc, "globalSidecarMode", "globalSidecarMode", cfg.GlobalSidecarMode != ""); ok {
+		cfg.GlobalSidecarMode = v
+	}
+	if cfg.SidecarWriteMode == "" {
+		cfg.SidecarWriteMode = SidecarWriteModeReplace
+	}
+	if cfg.ClusterDomain == "" {
+		cfg.ClusterDomain = defaultClusterDomain
+	}
+	if cfg.GlobalSidecar == nil {
+		cfg.GlobalSidecar = &lazyloadv1alpha1.GlobalSidecar{}
+	}
+	gs := cfg.GlobalSidecar
+	if gs.Namespace == "" {
+		gs.Namespace = moduleNamespace(config)
+	}
+
+	var errs []string
+	if v, ok := deprecatedMisc(misc, "renderGlobalSidecar", "globalSidecar.render", gs.Render); ok {
+		if render, err := strconv.ParseBool(v); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid global.misc.renderGlobalSidecar %q, should be a bool", v))
+		} else {
+			gs.Render = render
+		}
+	}
+	if v, ok := deprecatedMisc(misc, "globalSidecarImage", "globalSidecar.image", gs.Image != ""); ok {
+		gs.Image = v
+	}
+	for _, item := range []struct {
+		key, replacement string
+		field            *int32
+	}{
+		{"globalSidecarReplicas", "globalSidecar.replicas", &gs.Replicas},
+		{"globalSidecarProbePort", "globalSidecar.probePort", &gs.ProbePort},
+	} {
+		if v, ok := deprecatedMisc(misc, item.key, item.replacement, *item.field != 0); ok {
+			if n, err := strconv.ParseInt(v, 10, 32); err != nil {
+				errs = append(errs, fmt.Sprintf("invalid global.misc.%s %q, should be an integer", item.key, v))
+			} else {
+				*item.field = int32(n)
+			}
+		}
+	}
+
+	if len(ms.Types) == 0 {
+		errs = append(errs, "metricSource.types is empty")
+	}
+	seen := map[string]bool{}
+	for _, t := range ms.Types {
+		switch t {
+		case MetricSourceTypePrometheus:
+			if config == nil || config.Metric == nil || config.Metric.Prometheus == nil {
+				errs = append(errs, "metric source prometheus needs metric.prometheus config")
+			} else {
+				if _, err := newQueryTemplates(config.Metric.Prometheus.Handlers); err != nil {
+					errs = append(errs, err.Error())
+				}
+				if _, err := newPrometheusRoundTripper(ms.PrometheusClient); err != nil {
+					errs = append(errs, fmt.Sprintf("invalid metricSource.prometheusClient, %v", err))
+				}
+				for _, q := range ms.GetPrometheusBatch().GetQueries() {
+					h, ok := config.Metric.Prometheus.Handlers[q.Handler]
+					if !ok || q.Query == "" {
+						errs = append(errs, fmt.Sprintf("invalid metricSource.prometheusBatch query of handler %q, "+
+							"the handler should exist and the query should not be empty", q.Handler))
+						continue
+					}
+					if !ms.GetPrometheusBatch().GetEnable() {
+						continue
+					}
+					if err := checkBatchable(h.Query); err != nil {
+						errs = append(errs, fmt.Sprintf("prometheus handler %q can not be batched, %v", q.Handler, err))
+					}
+					if err := checkBatchQuery(q.Query, isNamespacedQuery(h.Query)); err != nil {
+						errs = append(errs, fmt.Sprintf("invalid metricSource.prometheusBatch query of handler %q, %v", q.Handler, err))
+					}
+				}
+			}
+		case MetricSourceTypeAccesslog:
+			if _, _, err := net.SplitHostPort(ms.LogSourcePort); err != nil {
+				errs = append(errs, fmt.Sprintf("invalid metricSource.logSourcePort %q for accesslog source, %v", ms.LogSourcePort, err))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("unknown metric source type %q, should be %s or %s",
+				t, MetricSourceTypePrometheus, MetricSourceTypeAccesslog))
+		}
+		if seen[t] {
+			errs = append(errs, fmt.Sprintf("duplicated metric source type %q", t))
+		}
+		seen[t] = true
+	}
+
+	if interval, err := time.ParseDuration(ms.RefreshInterval); err != nil || interval <= 0 {
+		errs = append(errs, fmt.Sprintf("invalid metricSource.refreshInterval %q, should be a positive duration", ms.RefreshInterval))
+	} else if ar := ms.AdaptiveRefresh; ar.GetEnable() {
+		if ar.MaxInterval == "" {
+			ar.MaxInterval = (interval * defaultMaxRefreshIntervalTimes).String()
+		}
+		if max, err := time.ParseDuration(ar.MaxInterval); err != nil || max < interval {
+			errs = append(errs, fmt.Sprintf("invalid metricSource.adaptiveRefresh.maxInterval %q, should be a duration not less than refreshInterval", ar.MaxInterval))
+		}
+	}
+
+	if t := cfg.GetEgressAggregation().GetThreshold(); t < 0 || t > 1 {
+		errs = append(errs, fmt.Sprintf("invalid egressAggregation.threshold %v, should be in (0, 1]", t))
+	}
+
+	if su := cfg.SidecarUpdate; su != nil {
+		for _, item := range []struct{ name, value string }{
+			{"debounce", su.Debounce}, {"maxDelay", su.MaxDelay}, {"minInterval", su.MinInterval},
+		} {
+			if d, err := time.ParseDuration(item.value); item.value != "" && (err != nil || d < 0) {
+				errs = append(errs, fmt.Sprintf("invalid sidecarUpdate.%s %q, should be a non-negative duration", item.name, item.value))
+			}
+		}
+		if su.Qps < 0 {
+			errs = append(errs, fmt.Sprintf("invalid sidecarUpdate.qps %v, should not be negative", su.Qps))
+		}
+	}
+
+	switch cfg.GlobalSidecarMode {
+	case "", GlobalSidecarModeCluster, GlobalSidecarModeNamespace:
+	default:
+		errs = append(errs, fmt.Sprintf("unknown globalSidecarMode %q, should be %s or %s",
+			cfg.GlobalSidecarMode, GlobalSidecarModeCluster, GlobalSidecarModeNamespace))
+	}
+
+	if gs.Render {
+		if gs.Image == "" {
+			errs = append(errs, "globalSidecar.image is required to render global-sidecar")
+		}
+		if gs.Namespace == "" && cfg.GlobalSidecarMode == GlobalSidecarModeCluster {
+			errs = append(errs, "globalSidecar.namespace is required to render global-sidecar in cluster mode")
+		}
+	} else if cfg.GetAutoPort().GetEnable() {
+		// ports derived from services only reach global-sidecar and to-global-sidecar rendered by the module
+		errs = append(errs, "autoPort needs globalSidecar.render to apply the derived ports to global-sidecar")
+	}
+	if gs.Replicas < 0 {
+		errs = append(errs, fmt.Sprintf("invalid globalSidecar.replicas %d, should not be negative", gs.Replicas))
+	}
+	if gs.ProbePort < 0 || gs.ProbePort > 65535 {
+		errs = append(errs, fmt.Sprintf("invalid globalSidecar.probePort %d", gs.ProbePort))
+	}
+	for _, item := range []struct {
+		name string
+		list map[string]string
+	}{
+		{"requests", gs.GetResources().GetRequests()}, {"limits", gs.GetResources().GetLimits()},
+	} {
+		for k, v := range item.list {
+			if _, err := resource.ParseQuantity(v); err != nil {
+				errs = append(errs, fmt.Sprintf("invalid globalSidecar.resources.%s.%s %q, %v", item.name, k, v, err))
+			}
+		}
+	}
+
+	for _, item := range cfg.Namespace {
+		if _, _, err := parseNamespacePattern(item); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if strings.HasPrefix(cfg.ClusterDomain, ".") || strings.HasSuffix(cfg.ClusterDomain, ".") {
+		errs = append(errs, fmt.Sprintf("invalid clusterDomain %q", cfg.ClusterDomain))
+	}
+
+	switch cfg.SidecarWriteMode {
+	case SidecarWriteModeReplace, SidecarWriteModeMerge:
+	default:
+		errs = append(errs, fmt.Sprintf("unknown sidecarWriteMode %q, should be %s or %s",
+			cfg.SidecarWriteMode, SidecarWriteModeReplace, SidecarWriteModeMerge))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid lazyload config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// moduleNamespace returns the namespace of lazyload module, which is the namespace of the chart
+func moduleNamespace(config *v1alpha1.Config) string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if b, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(b)); ns != "" {
+			return ns
+		}
+	}
+	if config != nil && config.Global != nil {
+		return config.Global.SlimeNamespace
+	}
+	return ""
+}
+
+// hasMetricSource returns whether metric source of type t is enabled
+func hasMetricSource(cfg *lazyloadv1alpha1.Fence, t string) bool {
+	for _, item := range cfg.GetMetricSource().GetTypes() {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"slime.io/slime/framework/apis/config/v1alpha1"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// frameworkMisc returns global.misc patched by the framework with extra keys
+func frameworkMisc(kv ...string) map[string]string {
+	misc := map[string]string{}
+	for k, v := range deprecatedMiscDefaults {
+		misc[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		misc[kv[i]] = kv[i+1]
+	}
+	return misc
+}
+
+func TestResolveFenceConfigMiscFallback(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	cfg := &lazyloadv1alpha1.Fence{}
+	config := &v1alpha1.Config{Global: &v1alpha1.Global{Misc: frameworkMisc(
+		"metricSourceType", "accesslog",
+		"logSourcePort", ":9000",
+		"globalSidecarMode", "cluster",
+		"renderGlobalSidecar", "true",
+		"globalSidecarImage", "global-sidecar:v1",
+		"globalSidecarReplicas", "2",
+		"globalSidecarProbePort", "18000",
+	), SlimeNamespace: "mesh-operator"}}
+	if err := ResolveFenceConfig(cfg, config); err != nil {
+		t.Fatal(err)
+	}
+
+	ms, gs := cfg.MetricSource, cfg.GlobalSidecar
+	if !reflect.DeepEqual(ms.Types, []string{MetricSourceTypeAccesslog}) || ms.LogSourcePort != ":9000" {
+		t.Errorf("metric source is not filled from misc, got %+v", ms)
+	}
+	if cfg.GlobalSidecarMode != GlobalSidecarModeCluster {
+		t.Errorf("globalSidecarMode = %q, want cluster", cfg.GlobalSidecarMode)
+	}
+	if !gs.Render || gs.Image != "global-sidecar:v1" || gs.Replicas != 2 || gs.ProbePort != 18000 {
+		t.Errorf("global sidecar is not filled from misc, got %+v", gs)
+	}
+	if n := len(hook.AllEntries()); n != 7 {
+		t.Errorf("%d deprecation warnings, want 7", n)
+	}
+}
+
+func TestResolveFenceConfigTypedWins(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	cfg := &lazyloadv1alpha1.Fence{
+		MetricSource:      &lazyloadv1alpha1.MetricSource{Types: []string{MetricSourceTypeAccesslog}, LogSourcePort: ":8000"},
+		GlobalSidecarMode: GlobalSidecarModeNamespace,
+		GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{
+			Render: true, Image: "typed:v1", Replicas: 3, ProbePort: 20000,
+		},
+	}
+	config := &v1alpha1.Config{Global: &v1alpha1.Global{Misc: frameworkMisc(
+		"logSourcePort", ":9000",
+		"globalSidecarImage", "misc:v1",
+		"globalSidecarReplicas", "2",
+		// invalid values are not parsed as the typed fields are set
+		"renderGlobalSidecar", "yes",
+		"globalSidecarProbePort", "port",
+	)}}
+	if err := ResolveFenceConfig(cfg, config); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &lazyloadv1alpha1.GlobalSidecar{Render: true, Namespace: cfg.GlobalSidecar.Namespace, Image: "typed:v1", Replicas: 3, ProbePort: 20000}
+	if !reflect.DeepEqual(cfg.GlobalSidecar, want) || cfg.MetricSource.LogSourcePort != ":8000" {
+		t.Errorf("typed fields are overridden by misc, got %+v, %+v", cfg.GlobalSidecar, cfg.MetricSource)
+	}
+	entries := hook.AllEntries()
+	if len(entries) != 5 {
+		t.Fatalf("%d deprecation warnings, want 5", len(entries))
+	}
+	for _, e := range entries {
+		if !strings.Contains(e.Message, "ignored") {
+			t.Errorf("warning %q should tell misc is ignored", e.Message)
+		}
+	}
+}
+
+func TestResolveFenceConfigFrameworkDefaults(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	cfg := &lazyloadv1alpha1.Fence{}
+	config := &v1alpha1.Config{
+		Global: &v1alpha1.Global{Misc: frameworkMisc()},
+		Metric: &v1alpha1.Metric{Prometheus: &v1alpha1.Prometheus_Source{}},
+	}
+	if err := ResolveFenceConfig(cfg, config); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.MetricSource.Types, []string{MetricSourceTypePrometheus}) ||
+		cfg.MetricSource.LogSourcePort != ":8082" || cfg.GlobalSidecarMode != GlobalSidecarModeNamespace {
+		t.Errorf("framework defaults are not applied, got %+v", cfg)
+	}
+	if n := len(hook.AllEntries()); n != 0 {
+		t.Errorf("framework defaults should not warn, got %d warnings", n)
+	}
+}
+
+func TestResolveFenceConfigErrors(t *testing.T) {
+	accesslog := func() *lazyloadv1alpha1.MetricSource {
+		return &lazyloadv1alpha1.MetricSource{Types: []string{MetricSourceTypeAccesslog}}
+	}
+	prometheus := &v1alpha1.Config{Metric: &v1alpha1.Metric{Prometheus: &v1alpha1.Prometheus_Source{
+		Handlers: map[string]*v1alpha1.Prometheus_Source_Handler{
+			"destination": {Query: `sum(istio_requests_total{source_app="$source_app"})by(destination_service)`},
+		},
+	}}}
+	cases := []struct {
+		name    string
+		cfg     *lazyloadv1alpha1.Fence
+		config  *v1alpha1.Config
+		wantErr string
+	}{
+		{
+			name:    "empty types",
+			cfg:     &lazyloadv1alpha1.Fence{},
+			config:  &v1alpha1.Config{Global: &v1alpha1.Global{Misc: frameworkMisc("metricSourceType", " , ")}},
+			wantErr: "metricSource.types is empty",
+		},
+		{
+			name:    "prometheus without metric config",
+			cfg:     &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{Types: []string{MetricSourceTypePrometheus}}},
+			wantErr: "needs metric.prometheus config",
+		},
+		{
+			name: "invalid query template",
+			cfg:  &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{Types: []string{MetricSourceTypePrometheus}}},
+			config: &v1alpha1.Config{Metric: &v1alpha1.Metric{Prometheus: &v1alpha1.Prometheus_Source{
+				Handlers: map[string]*v1alpha1.Prometheus_Source_Handler{"destination": {Query: "{{ .Window"}},
+			}}},
+			wantErr: "destination",
+		},
+		{
+			name: "batch query of unknown handler",
+			cfg: &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+				Types: []string{MetricSourceTypePrometheus},
+				PrometheusBatch: &lazyloadv1alpha1.PrometheusBatch{Enable: true, Queries: []*lazyloadv1alpha1.PrometheusBatchQuery{
+					{Handler: "unknown", Query: "sum(istio_requests_total)by(source_app)"},
+				}},
+			}},
+			config:  prometheus,
+			wantErr: `prometheusBatch query of handler "unknown"`,
+		},
+		{
+			name: "batch query without source_app",
+			cfg: &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+				Types: []string{MetricSourceTypePrometheus},
+				PrometheusBatch: &lazyloadv1alpha1.PrometheusBatch{Enable: true, Queries: []*lazyloadv1alpha1.PrometheusBatchQuery{
+					{Handler: "destination", Query: "sum(istio_requests_total)by(destination_service)"},
+				}},
+			}},
+			config:  prometheus,
+			wantErr: "drops label source_app",
+		},
+		{
+			name: "invalid prometheus client",
+			cfg: &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+				Types:            []string{MetricSourceTypePrometheus},
+				PrometheusClient: &lazyloadv1alpha1.PrometheusClient{Timeout: "soon"},
+			}},
+			config:  prometheus,
+			wantErr: "invalid metricSource.prometheusClient",
+		},
+		{
+			name:    "invalid logSourcePort",
+			cfg:     &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{Types: []string{MetricSourceTypeAccesslog}, LogSourcePort: "8082"}},
+			wantErr: "invalid metricSource.logSourcePort",
+		},
+		{
+			name:    "unknown type",
+			cfg:     &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{Types: []string{"k8s"}}},
+			wantErr: `unknown metric source type "k8s"`,
+		},
+		{
+			name: "duplicated type",
+			cfg: &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+				Types: []string{MetricSourceTypeAccesslog, MetricSourceTypeAccesslog}, LogSourcePort: ":8082",
+			}},
+			wantErr: `duplicated metric source type "accesslog"`,
+		},
+		{
+			name: "invalid refreshInterval",
+			cfg: &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+				Types: []string{MetricSourceTypeAccesslog}, RefreshInterval: "-1s",
+			}},
+			wantErr: "invalid metricSource.refreshInterval",
+		},
+		{
+			name: "maxInterval less than refreshInterval",
+			cfg: &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+				Types: []string{MetricSourceTypeAccesslog}, RefreshInterval: "30s",
+				AdaptiveRefresh: &lazyloadv1alpha1.AdaptiveRefresh{Enable: true, MaxInterval: "10s"},
+			}},
+			wantErr: "invalid metricSource.adaptiveRefresh.maxInterval",
+		},
+		{
+			name:    "egressAggregation threshold",
+			cfg:     &lazyloadv1alpha1.Fence{EgressAggregation: &lazyloadv1alpha1.EgressAggregation{Enable: true, Threshold: 1.5}},
+			wantErr: "invalid egressAggregation.threshold",
+		},
+		{
+			name:    "sidecarUpdate debounce",
+			cfg:     &lazyloadv1alpha1.Fence{SidecarUpdate: &lazyloadv1alpha1.SidecarUpdate{Debounce: "-1s"}},
+			wantErr: "invalid sidecarUpdate.debounce",
+		},
+		{
+			name:    "sidecarUpdate qps",
+			cfg:     &lazyloadv1alpha1.Fence{SidecarUpdate: &lazyloadv1alpha1.SidecarUpdate{Qps: -1}},
+			wantErr: "invalid sidecarUpdate.qps",
+		},
+		{
+			name:    "unknown globalSidecarMode",
+			cfg:     &lazyloadv1alpha1.Fence{GlobalSidecarMode: "node"},
+			wantErr: `unknown globalSidecarMode "node"`,
+		},
+		{
+			name:    "render without image",
+			cfg:     &lazyloadv1alpha1.Fence{GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{Render: true, Namespace: "mesh-operator"}},
+			wantErr: "globalSidecar.image is required",
+		},
+		{
+			name:    "autoPort without render",
+			cfg:     &lazyloadv1alpha1.Fence{AutoPort: &lazyloadv1alpha1.AutoPort{Enable: true}},
+			wantErr: "autoPort needs globalSidecar.render",
+		},
+		{
+			name:    "negative replicas",
+			cfg:     &lazyloadv1alpha1.Fence{GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{Replicas: -1}},
+			wantErr: "invalid globalSidecar.replicas",
+		},
+		{
+			name:    "probePort out of range",
+			cfg:     &lazyloadv1alpha1.Fence{GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{ProbePort: 70000}},
+			wantErr: "invalid globalSidecar.probePort",
+		},
+		{
+			name: "invalid resource quantity",
+			cfg: &lazyloadv1alpha1.Fence{GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{
+				Resources: &lazyloadv1alpha1.GlobalSidecarResources{Limits: map[string]string{"cpu": "a lot"}},
+			}},
+			wantErr: "invalid globalSidecar.resources.limits.cpu",
+		},
+		{
+			name:    "invalid namespace pattern",
+			cfg:     &lazyloadv1alpha1.Fence{Namespace: []string{"ns-["}},
+			wantErr: "invalid namespace",
+		},
+		{
+			name:    "invalid clusterDomain",
+			cfg:     &lazyloadv1alpha1.Fence{ClusterDomain: ".cluster.local"},
+			wantErr: "invalid clusterDomain",
+		},
+		{
+			name:    "unknown sidecarWriteMode",
+			cfg:     &lazyloadv1alpha1.Fence{SidecarWriteMode: "append"},
+			wantErr: `unknown sidecarWriteMode "append"`,
+		},
+		{
+			name:    "invalid misc renderGlobalSidecar",
+			cfg:     &lazyloadv1alpha1.Fence{},
+			config:  &v1alpha1.Config{Global: &v1alpha1.Global{Misc: frameworkMisc("renderGlobalSidecar", "yes")}},
+			wantErr: `invalid global.misc.renderGlobalSidecar "yes"`,
+		},
+		{
+			name:    "invalid misc globalSidecarReplicas",
+			cfg:     &lazyloadv1alpha1.Fence{},
+			config:  &v1alpha1.Config{Global: &v1alpha1.Global{Misc: frameworkMisc("globalSidecarReplicas", "two")}},
+			wantErr: `invalid global.misc.globalSidecarReplicas "two"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.cfg.MetricSource == nil && c.config == nil {
+				c.cfg.MetricSource = accesslog()
+			}
+			err := ResolveFenceConfig(c.cfg, c.config)
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("err = %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"slime.io/slime/framework/model"
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+	"slime.io/slime/modules/lazyload/pkg/proxy"
+)
+
+const DependencyReportPath = "dependency"
+
+const (
+	// dependencySourceReport is the source of metric dependencies reported by global-sidecar
+	dependencySourceReport = "report"
+	// reportedDependencyTTL is how long a reported dependency is kept in status without being found by
+	// the metric sources
+	reportedDependencyTTL = time.Hour
+	// reportedDependencyRefresh is how often LastSeen of a reported dependency is refreshed by the reports,
+	// so that each report of a live dependency does not write the status
+	reportedDependencyRefresh = reportedDependencyTTL / 10
+	// reporterTokenTTL is how long a reviewed token of global-sidecar is trusted without another review
+	reporterTokenTTL = time.Minute
+)
+
+const defaultClusterDomain = "cluster.local"
+
+// DependencyReportHandler accepts dependency events reported by global-sidecar,
+// which are recorded into the source ServiceFence without waiting for metric source.
+// Reports must carry the service account token of global-sidecar, which is reviewed by the apiserver.
+func (r *ServicefenceReconciler) DependencyReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		reporterNs, code, err := r.authenticateReporter(req)
+		if err != nil {
+			log.Warnf("reject dependency report from %s, %v", req.RemoteAddr, err)
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		report := &proxy.DependencyReport{}
+		if err := json.NewDecoder(req.Body).Decode(report); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := r.handleDependencyEvents(report.Events, reporterNs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// reporterTokens caches the namespaces of global-sidecar service accounts by their reviewed tokens
+type reporterTokens struct {
+	data map[string]reviewedToken
+	sync.Mutex
+}
+
+type reviewedToken struct {
+	namespace string
+	expire    time.Time
+}
+
+func (c *reporterTokens) get(token string, now time.Time) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	t, ok := c.data[token]
+	if !ok || now.After(t.expire) {
+		return "", false
+	}
+	return t.namespace, true
+}
+
+func (c *reporterTokens) set(token, namespace string, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if c.data == nil {
+		c.data = map[string]reviewedToken{}
+	}
+	for k, t := range c.data {
+		if now.After(t.expire) {
+			delete(c.data, k)
+		}
+	}
+	c.data[token] = reviewedToken{namespace: namespace, expire: now.Add(reporterTokenTTL)}
+}
+
+// authenticateReporter reviews the bearer token of req, and returns the namespace of the global-sidecar
+// service account it belongs to. The returned code is the http status code if it fails.
+func (r *ServicefenceReconciler) authenticateReporter(req *http.Request) (string, int, error) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", http.StatusUnauthorized, fmt.Errorf("bearer token is required")
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	now := time.Now()
+	if ns, ok := r.reporterTokens.get(token, now); ok {
+		return ns, http.StatusOK, nil
+	}
+
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := r.Client.Create(req.Context(), review); err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("review token failed, %v", err)
+	}
+	if !review.Status.Authenticated {
+		return "", http.StatusUnauthorized, fmt.Errorf("token is not authenticated, %s", review.Status.Error)
+	}
+	// system:serviceaccount:<namespace>:<name>
+	parts := strings.Split(review.Status.User.Username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" || parts[3] != GlobalSidecarName {
+		return "", http.StatusForbidden, fmt.Errorf("user %s is not the service account of global-sidecar",
+			review.Status.User.Username)
+	}
+	r.reporterTokens.set(token, parts[2], now)
+	return parts[2], http.StatusOK, nil
+}
+
+// handleDependencyEvents records the events reported by the global-sidecar in reporterNs. In namespace mode,
+// a global-sidecar only serves its own namespace, so events of sources in other namespaces are dropped.
+func (r *ServicefenceReconciler) handleDependencyEvents(events []proxy.DependencyEvent, reporterNs string) error {
+	log := log.WithField("reporter", "ServicefenceReconciler").WithField("function", "handleDependencyEvents")
+
+	ipToSvcCache, _, cacheLock, err := r.getIpToSvcCache()
+	if err != nil {
+		return err
+	}
+
+	// group destination hosts by source service
+	deps := make(map[types.NamespacedName]map[string]struct{})
+	for _, event := range events {
+		cacheLock.RLock()
+		sourceSvc := ipToSvcCache[event.SourceIp]
+		cacheLock.RUnlock()
+
+		parts := strings.Split(sourceSvc, "/")
+		if len(parts) != 2 || (event.SourceNs != "" && parts[0] != event.SourceNs) {
+			log.Debugf("can not find source service of event %+v, skip", event)
+			continue
+		}
+		if r.cfg.GlobalSidecarMode == GlobalSidecarModeNamespace && parts[0] != reporterNs {
+			log.Debugf("source of event %+v is not served by global-sidecar of %s, skip", event, reporterNs)
+			continue
+		}
+		nn := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+
+		host := completeHost(event.Host, parts[0], r.cfg.ClusterDomain, r.nsSvcCache)
+		if !isValidHost(host) {
+			continue
+		}
+		if deps[nn] == nil {
+			deps[nn] = make(map[string]struct{})
+		}
+		deps[nn][host] = struct{}{}
+	}
+
+	for nn, hosts := range deps {
+		if err := r.addDependencies(nn, hosts); err != nil {
+			log.Errorf("add dependencies to %s failed, %v", nn, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// addDependencies adds hosts to the metric dependencies in status of the ServiceFence and refreshes its sidecar.
+// LastSeen of the hosts already reported is refreshed, so they are not expired while still reported.
+func (r *ServicefenceReconciler) addDependencies(nn types.NamespacedName, hosts map[string]struct{}) error {
+	r.reconcileLock.Lock()
+	defer r.reconcileLock.Unlock()
+
+	sf := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), nn, sf); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if rev := model.IstioRevFromLabel(sf.Labels); !r.env.RevInScope(rev) {
+		return nil
+	}
+	if !r.nsScope.contains(nn.Namespace) {
+		log.Debugf("namespace of sf %v is not in scope, skip reported dependencies", nn)
+		return nil
+	}
+
+	now := time.Now()
+	lastSeen := &lazyloadv1alpha1.Timestamp{Seconds: now.Unix()}
+	deps := fenceMetricDependencies(sf)
+	known := map[string]bool{}
+	refreshed := false
+	for i, dep := range deps {
+		known[dep.Host] = true
+		if _, ok := hosts[dep.Host]; !ok || !stringsContains(dep.Sources, dependencySourceReport) {
+			continue
+		}
+		// the reported dependency is still alive, keep it for another ttl
+		if dep.LastSeen == nil || now.Sub(time.Unix(dep.LastSeen.Seconds, 0)) >= reportedDependencyRefresh {
+			deps[i] = dep.DeepCopy()
+			deps[i].LastSeen = lastSeen
+			refreshed = true
+		}
+	}
+	added := false
+	for h := range hosts {
+		if !known[h] {
+			deps = append(deps, &lazyloadv1alpha1.MetricDependency{
+				Host: h, Count: 1, Sources: []string{dependencySourceReport}, LastSeen: lastSeen,
+			})
+			added = true
+		}
+	}
+	if !added && !refreshed {
+		return nil
+	}
+	r.setFenceMetricDependencies(sf, mergeMetricDependencies(deps))
+
+	diff := r.updateVisitedHostStatus(sf)
+	r.recordVisitor(sf, diff)
+	if sf.Spec.Enable {
+		return r.refreshSidecar(sf)
+	}
+	return nil
+}
+
+// completeHost completes short name of k8s service to full host with the cluster domain
+func completeHost(host, sourceNs, clusterDomain string, nsSvcCache *NsSvcCache) string {
+	if clusterDomain == "" {
+		clusterDomain = defaultClusterDomain
+	}
+	parts := strings.Split(host, ".")
+	switch {
+	case len(parts) == 1:
+		return host + "." + sourceNs + ".svc." + clusterDomain
+	case len(parts) == 2, len(parts) == 3 && parts[2] == "svc":
+		nsSvcCache.RLock()
+		_, ok := nsSvcCache.Data[parts[1]][parts[1]+"/"+parts[0]]
+		nsSvcCache.RUnlock()
+		if ok {
+			return parts[0] + "." + parts[1] + ".svc." + clusterDomain
+		}
+	}
+	return host
+}
@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+	"slime.io/slime/modules/lazyload/pkg/proxy"
+)
+
+func TestCompleteHost(t *testing.T) {
+	cache := &NsSvcCache{Data: map[string]map[string]struct{}{
+		"bar": {"bar/foo": {}},
+	}}
+	cases := []struct {
+		host, domain, want string
+	}{
+		{"reviews", "", "reviews.default.svc.cluster.local"},
+		{"reviews", "corp.local", "reviews.default.svc.corp.local"},
+		{"foo.bar", "", "foo.bar.svc.cluster.local"},
+		{"foo.bar.svc", "corp.local", "foo.bar.svc.corp.local"},
+		// not a known service, maybe an external domain
+		{"example.com", "", "example.com"},
+		{"foo.bar.svc.cluster.local", "", "foo.bar.svc.cluster.local"},
+	}
+	for _, c := range cases {
+		if got := completeHost(c.host, "default", c.domain, cache); got != c.want {
+			t.Errorf("completeHost(%s, %q) = %s, want %s", c.host, c.domain, got, c.want)
+		}
+	}
+}
+
+// tokenReviewClient answers token reviews with the users of tokens, like the apiserver
+type tokenReviewClient struct {
+	client.Client
+	users   map[string]string
+	reviews int
+}
+
+func (c *tokenReviewClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authenticationv1.TokenReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	c.reviews++
+	if user, ok := c.users[review.Spec.Token]; ok {
+		review.Status.Authenticated = true
+		review.Status.User.Username = user
+	}
+	return nil
+}
+
+// newReportTestReconciler returns a reconciler of fences in default namespace accepting reports of token,
+// the global-sidecar of default namespace
+func newReportTestReconciler(t *testing.T, objs ...runtime.Object) (*ServicefenceReconciler, *tokenReviewClient) {
+	t.Helper()
+	objs = append(objs, testService("default", "productpage"), testService("default", "reviews"),
+		testFence("default", "productpage"),
+		testService("other", "productpage"), testFence("other", "productpage"))
+	r := newTestReconciler(t, &lazyloadv1alpha1.Fence{Namespace: []string{"default", "other"}}, objs...)
+	c := &tokenReviewClient{Client: r.Client, users: map[string]string{
+		"token":       "system:serviceaccount:default:global-sidecar",
+		"other-token": "system:serviceaccount:other:global-sidecar",
+		"app-token":   "system:serviceaccount:default:productpage",
+	}}
+	r.Client = c
+	r.ipCacheOnce.Do(func() {
+		r.ipToSvcCache = map[string]string{"10.0.0.1": "default/productpage", "10.0.0.2": "other/productpage"}
+		r.ipCacheLock = &sync.RWMutex{}
+	})
+	return r, c
+}
+
+func TestDependencyReportHandler(t *testing.T) {
+	r, c := newReportTestReconciler(t)
+	handler := r.DependencyReportHandler()
+
+	post := func(method, token string, body []byte) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/lazyload/dependency", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post(http.MethodGet, "token", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("get: got code %d", code)
+	}
+	for token, want := range map[string]int{
+		"":          http.StatusUnauthorized,
+		"unknown":   http.StatusUnauthorized,
+		"app-token": http.StatusForbidden,
+	} {
+		if code := post(http.MethodPost, token, []byte(`{"events":[]}`)); code != want {
+			t.Errorf("token %q: got code %d, want %d", token, code, want)
+		}
+	}
+	if code := post(http.MethodPost, "token", []byte("{")); code != http.StatusBadRequest {
+		t.Errorf("invalid body: got code %d", code)
+	}
+
+	body, _ := json.Marshal(proxy.DependencyReport{Events: []proxy.DependencyEvent{
+		{SourceNs: "default", SourceIp: "10.0.0.1", Host: "reviews", Port: 9080},
+		// source namespace mismatches the service of the ip
+		{SourceNs: "bar", SourceIp: "10.0.0.1", Host: "ratings", Port: 9080},
+		// not served by the global-sidecar of default
+		{SourceNs: "other", SourceIp: "10.0.0.2", Host: "reviews", Port: 9080},
+		// unknown source
+		{SourceNs: "default", SourceIp: "10.0.0.9", Host: "details", Port: 9080},
+	}})
+	if code := post(http.MethodPost, "token", body); code != http.StatusOK {
+		t.Fatalf("report: got code %d", code)
+	}
+	if c.reviews != 3 {
+		t.Errorf("got %d token reviews, want the reviewed token cached", c.reviews)
+	}
+
+	sf := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "productpage"}, sf); err != nil {
+		t.Fatal(err)
+	}
+	deps := sf.Status.MetricDependencies
+	if len(deps) != 1 || deps[0].Host != "reviews.default.svc.cluster.local" || deps[0].Sources[0] != dependencySourceReport {
+		t.Errorf("got dependencies %v, want the reported reviews only", deps)
+	}
+	if sf.Status.Domains["reviews.default.svc.cluster.local"] == nil {
+		t.Errorf("got domains %v, want reviews added", sf.Status.Domains)
+	}
+
+	sf = &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "other", Name: "productpage"}, sf); err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.Status.MetricDependencies) != 0 {
+		t.Errorf("got dependencies %v of fence in other namespace", sf.Status.MetricDependencies)
+	}
+}
+
+// TestDependencyReportThroughSidecar reports a request which comes to global-sidecar through the local
+// istio sidecar, with the defaults of the proxy and the headers added by the to-global-sidecar envoyfilter
+func TestDependencyReportThroughSidecar(t *testing.T) {
+	r, _ := newReportTestReconciler(t)
+	controller := httptest.NewServer(r.DependencyReportHandler())
+	defer controller.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := proxy.DefaultConfig()
+	cfg.WormholePorts = []proxy.PortConfig{{Port: 9080}}
+	cfg.Resolver.DisableLookup = true
+	cfg.DependencyReportTokenFile = filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(cfg.DependencyReportTokenFile, []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	reporter := proxy.NewDependencyReporter(controller.URL, cfg.DependencyReportTokenFile)
+	stop := make(chan struct{})
+	defer close(stop)
+	go reporter.Run(stop)
+	p, err := proxy.NewProxy(9080, cfg, reporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://reviews:9080/", nil)
+	// inbound requests are forwarded by the local sidecar from 127.0.0.6
+	req.RemoteAddr = "127.0.0.6:40000"
+	req.Header.Set(proxy.HeaderOrigDest, upstreamURL.Host)
+	req.Header.Set(proxy.HeaderSourceNs, "default")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got code %d from proxy", rec.Code)
+	}
+
+	nn := types.NamespacedName{Namespace: "default", Name: "productpage"}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sf := &lazyloadv1alpha1.ServiceFence{}
+		if err := r.Client.Get(context.TODO(), nn, sf); err != nil {
+			t.Fatal(err)
+		}
+		if deps := sf.Status.MetricDependencies; len(deps) == 1 && deps[0].Host == "reviews.default.svc.cluster.local" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dependency is not reported, got %v", sf.Status.MetricDependencies)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestAddDependenciesRefreshesLastSeen(t *testing.T) {
+	const host = "reviews.default.svc.cluster.local"
+	cases := []struct {
+		name        string
+		age         time.Duration
+		wantRefresh bool
+	}{
+		{name: "recently seen", age: time.Minute},
+		{name: "seen before the refresh interval", age: reportedDependencyRefresh + time.Minute, wantRefresh: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lastSeen := time.Now().Add(-c.age).Unix()
+			sf := testFence("default", "reviews")
+			sf.Status.MetricDependencies = []*lazyloadv1alpha1.MetricDependency{{
+				Host: host, Count: 1, Sources: []string{dependencySourceReport},
+				LastSeen: &lazyloadv1alpha1.Timestamp{Seconds: lastSeen},
+			}}
+			r, _ := newReportTestReconciler(t, sf)
+			nn := types.NamespacedName{Namespace: "default", Name: "reviews"}
+			if err := r.addDependencies(nn, map[string]struct{}{host: {}}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := &lazyloadv1alpha1.ServiceFence{}
+			if err := r.Client.Get(context.TODO(), nn, got); err != nil {
+				t.Fatal(err)
+			}
+			deps := got.Status.MetricDependencies
+			if len(deps) != 1 || deps[0].LastSeen == nil {
+				t.Fatalf("got dependencies %v, want the reported one", deps)
+			}
+			if refreshed := deps[0].LastSeen.Seconds > lastSeen; refreshed != c.wantRefresh {
+				t.Errorf("last seen %d is refreshed %v, want %v", deps[0].LastSeen.Seconds, refreshed, c.wantRefresh)
+			}
+		})
+	}
+}
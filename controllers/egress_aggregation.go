@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"strings"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+const (
+	defaultEgressAggregationThreshold   = 0.5
+	defaultEgressAggregationMinServices = 5
+)
+
+// splitServiceHost returns the name and namespace of a host like svc.ns.svc.<clusterDomain>
+func splitServiceHost(host, clusterDomain string) (string, string, bool) {
+	suffix := ".svc." + clusterDomain
+	if !strings.HasSuffix(host, suffix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(host, suffix), ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// aggregateEgressHosts replaces the */svc.ns.svc.<clusterDomain> hosts of a namespace with ns/*, when the
+// fraction of services of the namespace in hosts reaches the threshold of EgressAggregation.
+// Note that ns/* only imports the config in namespace ns, so the VirtualServices, DestinationRules and
+// ServiceEntries of the collapsed services defined in other namespaces are no longer imported.
+func aggregateEgressHosts(hosts []string, cfg *lazyloadv1alpha1.EgressAggregation, clusterDomain string, nsSvcCache *NsSvcCache) []string {
+	if !cfg.GetEnable() {
+		return hosts
+	}
+	threshold := cfg.GetThreshold()
+	if threshold == 0 {
+		threshold = defaultEgressAggregationThreshold
+	}
+	minServices := int(cfg.GetMinServices())
+	if minServices == 0 {
+		minServices = defaultEgressAggregationMinServices
+	}
+
+	nsSvcCache.RLock()
+	used := map[string]map[string]bool{}
+	for _, h := range hosts {
+		if !strings.HasPrefix(h, "*/") {
+			continue
+		}
+		name, ns, ok := splitServiceHost(h[2:], clusterDomain)
+		if !ok {
+			continue
+		}
+		if _, exist := nsSvcCache.Data[ns][ns+"/"+name]; !exist {
+			continue
+		}
+		if used[ns] == nil {
+			used[ns] = map[string]bool{}
+		}
+		used[ns][name] = true
+	}
+	collapsed := map[string]bool{}
+	for ns, svcs := range used {
+		total := len(nsSvcCache.Data[ns])
+		if total >= minServices && float64(len(svcs)) >= threshold*float64(total) {
+			collapsed[ns] = true
+		}
+	}
+	nsSvcCache.RUnlock()
+
+	if len(collapsed) == 0 {
+		return hosts
+	}
+	ret := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if strings.HasPrefix(h, "*/") {
+			if _, ns, ok := splitServiceHost(h[2:], clusterDomain); ok && collapsed[ns] {
+				continue
+			}
+		}
+		ret = append(ret, h)
+	}
+	for ns := range collapsed {
+		ret = append(ret, ns+"/*")
+	}
+	log.Debugf("egress hosts of namespaces %v are collapsed", collapsed)
+	return ret
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func TestAggregateEgressHosts(t *testing.T) {
+	cache := &NsSvcCache{Data: map[string]map[string]struct{}{}}
+	for _, ns := range []string{"big", "small"} {
+		cache.Data[ns] = map[string]struct{}{}
+	}
+	for i := 0; i < 10; i++ {
+		cache.Data["big"][fmt.Sprintf("big/svc%d", i)] = struct{}{}
+	}
+	cache.Data["small"]["small/a"] = struct{}{}
+
+	hostsOf := func(ns string, n int) []string {
+		var hosts []string
+		for i := 0; i < n; i++ {
+			hosts = append(hosts, fmt.Sprintf("*/svc%d.%s.svc.cluster.local", i, ns))
+		}
+		return hosts
+	}
+	cfg := &lazyloadv1alpha1.EgressAggregation{Enable: true}
+
+	cases := []struct {
+		name  string
+		hosts []string
+		want  []string
+	}{
+		{
+			name:  "below threshold",
+			hosts: append(hostsOf("big", 4), "istio-system/*"),
+			want:  append(hostsOf("big", 4), "istio-system/*"),
+		},
+		{
+			name:  "reach threshold",
+			hosts: append(hostsOf("big", 5), "istio-system/*", "*/a.small.svc.cluster.local", "*/default.details.mailsaas"),
+			want:  []string{"istio-system/*", "*/a.small.svc.cluster.local", "*/default.details.mailsaas", "big/*"},
+		},
+	}
+	for _, c := range cases {
+		got := aggregateEgressHosts(c.hosts, cfg, defaultClusterDomain, cache)
+		sort.Strings(got)
+		sort.Strings(c.want)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	hosts := hostsOf("big", 10)
+	if got := aggregateEgressHosts(hosts, nil, defaultClusterDomain, cache); !reflect.DeepEqual(got, hosts) {
+		t.Errorf("got %v with aggregation disabled, want hosts untouched", got)
+	}
+
+	// hosts of another cluster domain
+	hosts = nil
+	for i := 0; i < 5; i++ {
+		hosts = append(hosts, fmt.Sprintf("*/svc%d.big.svc.example.org", i))
+	}
+	if got := aggregateEgressHosts(hosts, cfg, "example.org", cache); !reflect.DeepEqual(got, []string{"big/*"}) {
+		t.Errorf("got %v with cluster domain example.org, want big/*", got)
+	}
+	if got := aggregateEgressHosts(hosts, cfg, defaultClusterDomain, cache); !reflect.DeepEqual(got, hosts) {
+		t.Errorf("got %v with cluster domain %s, want hosts untouched", got, defaultClusterDomain)
+	}
+}
+
+func TestSplitServiceHost(t *testing.T) {
+	cases := []struct {
+		host, domain string
+		name, ns     string
+		ok           bool
+	}{
+		{host: "reviews.default.svc.cluster.local", domain: "cluster.local", name: "reviews", ns: "default", ok: true},
+		{host: "reviews.default.svc.example.org", domain: "example.org", name: "reviews", ns: "default", ok: true},
+		{host: "reviews.default.svc.cluster.local", domain: "example.org"},
+		{host: "v1.reviews.default.svc.cluster.local", domain: "cluster.local"},
+		{host: ".svc.cluster.local", domain: "cluster.local"},
+	}
+	for _, c := range cases {
+		name, ns, ok := splitServiceHost(c.host, c.domain)
+		if name != c.name || ns != c.ns || ok != c.ok {
+			t.Errorf("splitServiceHost(%s, %s) = %s, %s, %v", c.host, c.domain, name, ns, ok)
+		}
+	}
+}
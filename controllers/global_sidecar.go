@@ -0,0 +1,907 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"slime.io/slime/framework/apis/networking/v1alpha3"
+	"slime.io/slime/framework/model"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+	"slime.io/slime/modules/lazyload/pkg/proxy"
+)
+
+const (
+	GlobalSidecarName          = "global-sidecar"
+	GlobalSidecarModeCluster   = "cluster"
+	GlobalSidecarModeNamespace = "namespace"
+	ToGlobalSidecarEnvoyFilter = "to-global-sidecar"
+
+	accessLogSourceConfigMap      = "lazyload-accesslog-source"
+	defaultGlobalSidecarReplicas  = 1
+	defaultGlobalSidecarProbePort = 18181
+	globalSidecarResyncInterval   = time.Minute
+	// the rendered proxy config holding wormhole ports and dispatches is mounted from the global-sidecar configmap,
+	// global-sidecar reloads it without restart
+	globalSidecarConfigDir  = "/etc/global-sidecar"
+	globalSidecarConfigFile = "config.json"
+	// globalSidecarProxyConfig marks global-sidecar for the envoyfilters matching LAZYLOAD_GLOBAL_SIDECAR
+	globalSidecarProxyConfig = "proxyMetadata:\n" +
+		"  ISTIO_META_SLIME_APP:\n    LAZYLOAD_GLOBAL_SIDECAR\n" +
+		"  ISTIO_META_ISTIO_VERSION:\n    \"999.0.0\"\n"
+)
+
+const (
+	annotationProxyConfig       = "proxy.istio.io/config"
+	annotationBootstrapOverride = "sidecar.istio.io/bootstrapOverride"
+)
+
+// globalSidecarPodAnnotations are the pod annotations rendered by newGlobalSidecarDeployment
+var globalSidecarPodAnnotations = []string{annotationProxyConfig, annotationBootstrapOverride}
+
+// globalSidecarTarget is where the global-sidecar resources are rendered
+type globalSidecarTarget struct {
+	// namespace of global-sidecar deployment, service, serviceaccount and sidecar
+	namespace string
+	// namespace of to-global-sidecar envoyfilter
+	envoyFilterNamespace string
+	// sourceNs is set to Slime-Source-Ns header statically in namespace mode
+	sourceNs string
+}
+
+// globalSidecarRenderEnabled returns true if the module renders global-sidecar resources
+// from Fence instead of the helm chart
+func (r *ServicefenceReconciler) globalSidecarRenderEnabled() bool {
+	return r.cfg.GetGlobalSidecar().GetRender()
+}
+
+func namespaceGlobalSidecarTarget(ns string) globalSidecarTarget {
+	return globalSidecarTarget{namespace: ns, envoyFilterNamespace: ns, sourceNs: ns}
+}
+
+// globalSidecarTargets returns the global-sidecar of cluster mode, or the ones of namespace mode in the fenced
+// namespaces if autoFence is enabled, otherwise in the namespaces in scope.
+// Caller should hold the reconcile lock.
+func (r *ServicefenceReconciler) globalSidecarTargets() []globalSidecarTarget {
+	switch r.cfg.GlobalSidecarMode {
+	case GlobalSidecarModeCluster:
+		return []globalSidecarTarget{{
+			namespace:            r.cfg.GetGlobalSidecar().GetNamespace(),
+			envoyFilterNamespace: r.env.Config.Global.IstioNamespace,
+		}}
+	case GlobalSidecarModeNamespace:
+		var namespaces []string
+		if r.cfg.AutoFence {
+			for ns, fenced := range r.enabledNamespaces {
+				if fenced {
+					namespaces = append(namespaces, ns)
+				}
+			}
+			sort.Strings(namespaces)
+		} else {
+			namespaces = r.scopedNamespaces()
+		}
+		ret := make([]globalSidecarTarget, 0, len(namespaces))
+		for _, ns := range namespaces {
+			ret = append(ret, namespaceGlobalSidecarTarget(ns))
+		}
+		return ret
+	}
+	return nil
+}
+
+// RunGlobalSidecarRender reconciles global-sidecar resources after the cache is synced
+// and repairs drifts periodically or once ports of services change. It is used as a manager runnable.
+// If rendering is disabled, it removes the resources rendered before and exits.
+func (r *ServicefenceReconciler) RunGlobalSidecarRender(cacheSynced func(stop <-chan struct{}) bool) func(stop <-chan struct{}) error {
+	return func(stop <-chan struct{}) error {
+		if !cacheSynced(stop) {
+			return fmt.Errorf("wait for cache sync failed")
+		}
+		if !r.globalSidecarRenderEnabled() {
+			if err := r.ReconcileGlobalSidecar(); err != nil {
+				log.Errorf("remove rendered global-sidecar resources failed, %+v", err)
+			}
+			return nil
+		}
+		ticker := time.NewTicker(globalSidecarResyncInterval)
+		defer ticker.Stop()
+		for {
+			if err := r.ReconcileGlobalSidecar(); err != nil {
+				log.Errorf("reconcile global-sidecar resources failed, %+v", err)
+			}
+			select {
+			case <-stop:
+				return nil
+			case <-ticker.C:
+			case <-r.portSvcCache.Changed:
+			}
+		}
+	}
+}
+
+// ReconcileGlobalSidecar renders the global-sidecar resources of all targets by the effective wormhole ports
+// and Fence.Dispatches, and removes the rendered ones which are no longer targets.
+// The reconcile lock is only held to get the targets, the resources are read and written under globalSidecarLock
+// without blocking fence reconciles. A namespace unfenced meanwhile is cleaned up by the next resync.
+func (r *ServicefenceReconciler) ReconcileGlobalSidecar() error {
+	ctx := context.TODO()
+	var targets []globalSidecarTarget
+	if r.globalSidecarRenderEnabled() {
+		r.reconcileLock.RLock()
+		targets = r.globalSidecarTargets()
+		r.reconcileLock.RUnlock()
+	}
+
+	r.globalSidecarLock.Lock()
+	defer r.globalSidecarLock.Unlock()
+
+	var errs []string
+	globalSidecarWormholePorts.Reset()
+	for _, t := range targets {
+		if err := r.reconcileGlobalSidecarTarget(ctx, t); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	namespaces, envoyFilterNamespaces := map[string]bool{}, map[string]bool{}
+	for _, t := range targets {
+		namespaces[t.namespace] = true
+		envoyFilterNamespaces[t.envoyFilterNamespace] = true
+	}
+	if err := r.removeGlobalSidecar(ctx, func(ns string, envoyFilter bool) bool {
+		if envoyFilter {
+			return envoyFilterNamespaces[ns]
+		}
+		return namespaces[ns]
+	}); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// reconcileGlobalSidecarTarget creates or updates the global-sidecar resources of t
+func (r *ServicefenceReconciler) reconcileGlobalSidecarTarget(ctx context.Context, t globalSidecarTarget) error {
+	wormholePort := r.cfg.WormholePort
+	if t.sourceNs != "" {
+		wormholePort = r.nsSettingsByName(t.sourceNs).wormholePort
+	}
+	ports, err := r.effectiveWormholePorts(wormholePort)
+	if err != nil {
+		return err
+	}
+	for _, p := range ports {
+		globalSidecarWormholePorts.WithLabelValues(t.namespace, strconv.Itoa(int(p))).Set(1)
+	}
+	dispatches := r.renderDispatches()
+
+	objs, err := r.newGlobalSidecarObjects(ctx, t, ports, dispatches)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, obj := range objs {
+		if err = r.applyGlobalSidecarObject(ctx, obj); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// newGlobalSidecarObjects renders the global-sidecar resources of t like the chart
+func (r *ServicefenceReconciler) newGlobalSidecarObjects(ctx context.Context, t globalSidecarTarget, ports []int32,
+	dispatches []*lazyloadv1alpha1.Dispatch) ([]runtime.Object, error) {
+	rev := r.env.IstioRev()
+	cm, err := newGlobalSidecarConfigMap(t.namespace, ports, dispatches)
+	if err != nil {
+		return nil, err
+	}
+	deploy := r.newGlobalSidecarDeployment(ctx, t.namespace)
+	sidecar, err := newGlobalSidecarSidecar(t.namespace, rev)
+	if err != nil {
+		return nil, err
+	}
+	ef, err := newToGlobalSidecarEnvoyFilter(t, ports, dispatches, r.cfg.ClusterDomain, rev)
+	if err != nil {
+		return nil, err
+	}
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GlobalSidecarName,
+			Namespace: t.namespace,
+			Labels:    map[string]string{"account": GlobalSidecarName},
+		},
+	}
+	return []runtime.Object{sa, newGlobalSidecarService(t.namespace, ports), cm, deploy, sidecar, ef}, nil
+}
+
+// applyGlobalSidecarObject creates obj, or copies the rendered fields of obj to the existing one and updates it
+// if anything changes. Existing objects are adopted by the labels of obj, like the ones installed by the chart.
+// The sidecar is written by server-side apply instead.
+func (r *ServicefenceReconciler) applyGlobalSidecarObject(ctx context.Context, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	labels := accessor.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelCreatedBy] = CreatedByFenceController
+	accessor.SetLabels(labels)
+
+	nsName := types.NamespacedName{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}
+	if sidecar, ok := obj.(*v1alpha3.Sidecar); ok {
+		// the sidecar is generated by lazyload as a whole, like the ones of servicefences
+		return r.applyGlobalSidecarSidecar(ctx, sidecar)
+	}
+	found := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err = r.apiReader().Get(ctx, nsName, found); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		log.Infof("Creating %T %s for global-sidecar", obj, nsName)
+		return r.Client.Create(ctx, obj)
+	}
+
+	changed := syncGlobalSidecarObject(found, obj)
+	foundAccessor, err := meta.Accessor(found)
+	if err != nil {
+		return err
+	}
+	foundLabels := foundAccessor.GetLabels()
+	if foundLabels == nil {
+		foundLabels = map[string]string{}
+	}
+	for k, v := range labels {
+		if foundLabels[k] != v {
+			foundLabels[k] = v
+			changed = true
+		}
+	}
+	foundAccessor.SetLabels(foundLabels)
+	if !changed {
+		return nil
+	}
+	log.Infof("Updating %T %s for global-sidecar", obj, nsName)
+	return r.Client.Update(ctx, found)
+}
+
+// applyGlobalSidecarSidecar applies sidecar of global-sidecar by server-side apply
+func (r *ServicefenceReconciler) applyGlobalSidecarSidecar(ctx context.Context, sidecar *v1alpha3.Sidecar) error {
+	fields := make([]string, 0, len(sidecar.Spec))
+	for f := range sidecar.Spec {
+		fields = append(fields, f)
+	}
+	obj := sidecarApplyObject(sidecar, fields...)
+	if err := r.Client.Patch(ctx, obj, client.Apply, applyOptions...); err != nil {
+		return err
+	}
+	log.Debugf("Applied Sidecar %s/%s for global-sidecar", sidecar.Namespace, sidecar.Name)
+	return nil
+}
+
+// syncGlobalSidecarObject copies the fields rendered in desired to found, and returns true if any of them changes.
+// Fields defaulted or managed by others, like the cluster ip of service, are kept.
+func syncGlobalSidecarObject(found, desired runtime.Object) bool {
+	changed := false
+	set := func(dst, src interface{}) {
+		if equality.Semantic.DeepEqual(reflect.ValueOf(dst).Elem().Interface(), reflect.ValueOf(src).Elem().Interface()) {
+			return
+		}
+		reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+		changed = true
+	}
+
+	switch found := found.(type) {
+	case *corev1.ServiceAccount:
+	case *corev1.ConfigMap:
+		set(&found.Data, &desired.(*corev1.ConfigMap).Data)
+	case *corev1.Service:
+		d := desired.(*corev1.Service)
+		set(&found.Spec.Ports, &d.Spec.Ports)
+		set(&found.Spec.Selector, &d.Spec.Selector)
+	case *appsv1.Deployment:
+		d := desired.(*appsv1.Deployment)
+		set(&found.Spec.Replicas, &d.Spec.Replicas)
+		set(&found.Spec.Template.Labels, &d.Spec.Template.Labels)
+		// annotations added by others, like kubectl rollout restart, are kept
+		for _, k := range globalSidecarPodAnnotations {
+			v, ok := d.Spec.Template.Annotations[k]
+			if cur, found := found.Spec.Template.Annotations[k]; ok == found && cur == v {
+				continue
+			}
+			if !ok {
+				delete(found.Spec.Template.Annotations, k)
+			} else {
+				if found.Spec.Template.Annotations == nil {
+					found.Spec.Template.Annotations = map[string]string{}
+				}
+				found.Spec.Template.Annotations[k] = v
+			}
+			changed = true
+		}
+		set(&found.Spec.Template.Spec.ServiceAccountName, &d.Spec.Template.Spec.ServiceAccountName)
+		set(&found.Spec.Template.Spec.TerminationGracePeriodSeconds, &d.Spec.Template.Spec.TerminationGracePeriodSeconds)
+		set(&found.Spec.Template.Spec.Volumes, &d.Spec.Template.Spec.Volumes)
+
+		dc := &d.Spec.Template.Spec.Containers[0]
+		var c *corev1.Container
+		for i := range found.Spec.Template.Spec.Containers {
+			if found.Spec.Template.Spec.Containers[i].Name == dc.Name {
+				c = &found.Spec.Template.Spec.Containers[i]
+			}
+		}
+		if c == nil {
+			found.Spec.Template.Spec.Containers = append(found.Spec.Template.Spec.Containers, *dc)
+			return true
+		}
+		set(&c.Image, &dc.Image)
+		set(&c.ImagePullPolicy, &dc.ImagePullPolicy)
+		set(&c.Env, &dc.Env)
+		set(&c.Ports, &dc.Ports)
+		set(&c.VolumeMounts, &dc.VolumeMounts)
+		set(&c.LivenessProbe, &dc.LivenessProbe)
+		set(&c.ReadinessProbe, &dc.ReadinessProbe)
+		set(&c.Resources, &dc.Resources)
+		set(&c.SecurityContext, &dc.SecurityContext)
+	case *v1alpha3.EnvoyFilter:
+		set(&found.Spec, &desired.(*v1alpha3.EnvoyFilter).Spec)
+	}
+	return changed
+}
+
+// removeGlobalSidecar deletes the global-sidecar resources rendered by the module if keep returns false
+// for their namespace. envoyFilter tells whether it is the namespace of the to-global-sidecar envoyfilter.
+// opts narrow the lists of rendered resources, like client.InNamespace when a single namespace is cleaned up.
+func (r *ServicefenceReconciler) removeGlobalSidecar(ctx context.Context, keep func(ns string, envoyFilter bool) bool,
+	opts ...client.ListOption) error {
+	opts = append([]client.ListOption{client.MatchingLabels{LabelCreatedBy: CreatedByFenceController}}, opts...)
+	for _, item := range []struct {
+		list runtime.Object
+		name string
+	}{
+		{&appsv1.DeploymentList{}, GlobalSidecarName},
+		{&corev1.ServiceList{}, GlobalSidecarName},
+		{&corev1.ServiceAccountList{}, GlobalSidecarName},
+		{&corev1.ConfigMapList{}, GlobalSidecarName},
+		{&v1alpha3.SidecarList{}, GlobalSidecarName},
+		{&v1alpha3.EnvoyFilterList{}, ToGlobalSidecarEnvoyFilter},
+	} {
+		if err := r.apiReader().List(ctx, item.list, opts...); err != nil {
+			return err
+		}
+		objs, err := meta.ExtractList(item.list)
+		if err != nil {
+			return err
+		}
+		_, envoyFilter := item.list.(*v1alpha3.EnvoyFilterList)
+		for _, obj := range objs {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return err
+			}
+			if accessor.GetName() != item.name || keep(accessor.GetNamespace(), envoyFilter) {
+				continue
+			}
+			log.Infof("Deleting %T %s/%s as global-sidecar is not rendered there", obj, accessor.GetNamespace(), accessor.GetName())
+			if err = r.Client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newGlobalSidecarService(ns string, ports []int32) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GlobalSidecarName,
+			Namespace: ns,
+			Labels: map[string]string{
+				"app":                    GlobalSidecarName,
+				"service":                GlobalSidecarName,
+				"slime.io/serviceFenced": "false",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector:        map[string]string{"app": GlobalSidecarName},
+			SessionAffinity: corev1.ServiceAffinityNone,
+			Type:            corev1.ServiceTypeClusterIP,
+		},
+	}
+	for _, p := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+			Name:       fmt.Sprintf("http-%d", p),
+			Port:       p,
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromInt(int(p)),
+		})
+	}
+	return svc
+}
+
+// globalSidecarConfig is the config file of global-sidecar, see proxy.Config
+type globalSidecarConfig struct {
+	WormholePorts []proxy.PortConfig     `json:"wormholePorts"`
+	Dispatches    []proxy.DispatchConfig `json:"dispatches,omitempty"`
+}
+
+// newGlobalSidecarConfigMap renders the wormhole ports and dispatches into the config file of global-sidecar.
+// Unlike the env of the chart, changes of them are reloaded by global-sidecar without a rollout.
+func newGlobalSidecarConfigMap(ns string, ports []int32, dispatches []*lazyloadv1alpha1.Dispatch) (*corev1.ConfigMap, error) {
+	cfg := globalSidecarConfig{
+		WormholePorts: make([]proxy.PortConfig, 0, len(ports)),
+		Dispatches:    proxyDispatches(dispatches),
+	}
+	for _, p := range ports {
+		cfg.WormholePorts = append(cfg.WormholePorts, proxy.PortConfig{Port: int(p)})
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GlobalSidecarName,
+			Namespace: ns,
+			Labels:    map[string]string{"app": GlobalSidecarName},
+		},
+		Data: map[string]string{globalSidecarConfigFile: string(b)},
+	}, nil
+}
+
+// newGlobalSidecarDeployment renders the global-sidecar deployment like the chart, except that wormhole ports
+// and dispatches are read from the mounted global-sidecar configmap
+func (r *ServicefenceReconciler) newGlobalSidecarDeployment(ctx context.Context, ns string) *appsv1.Deployment {
+	gs := r.cfg.GetGlobalSidecar()
+
+	replicas := int32(defaultGlobalSidecarReplicas)
+	if gs.GetReplicas() > 0 {
+		replicas = gs.GetReplicas()
+	}
+	probePort := defaultGlobalSidecarProbePort
+	if gs.GetProbePort() > 0 {
+		probePort = int(gs.GetProbePort())
+	}
+	logLevel := "info"
+	if l := r.env.Config.Global.Log; l != nil && l.LogLevel != "" {
+		logLevel = l.LogLevel
+	}
+
+	annotations := map[string]string{annotationProxyConfig: globalSidecarProxyConfig}
+	if hasMetricSource(r.cfg, MetricSourceTypeAccesslog) {
+		cm := &corev1.ConfigMap{}
+		if err := r.apiReader().Get(ctx, types.NamespacedName{Name: accessLogSourceConfigMap, Namespace: ns}, cm); err == nil {
+			annotations[annotationBootstrapOverride] = accessLogSourceConfigMap
+		} else {
+			log.Warningf("configmap %s/%s is not found, accesslog of global-sidecar is not reported", ns, accessLogSourceConfigMap)
+		}
+	}
+
+	podLabels := map[string]string{"app": GlobalSidecarName}
+	for k, v := range gs.GetLabels() {
+		podLabels[k] = v
+	}
+	model.PatchIstioRevLabel(&podLabels, r.env.IstioRev())
+
+	runAsUser, terminationGracePeriod := int64(1000), int64(40)
+	// the default of api server, set explicitly to not be taken as a drift
+	configMode := int32(0644)
+	probe := func(path string, initialDelay, period, timeout, failureThreshold int32) *corev1.Probe {
+		return &corev1.Probe{
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path:   path,
+					Port:   intstr.FromInt(probePort),
+					Scheme: corev1.URISchemeHTTP,
+				},
+			},
+			InitialDelaySeconds: initialDelay,
+			PeriodSeconds:       period,
+			TimeoutSeconds:      timeout,
+			SuccessThreshold:    1,
+			FailureThreshold:    failureThreshold,
+		}
+	}
+
+	container := corev1.Container{
+		Name:            GlobalSidecarName,
+		Image:           gs.GetImage(),
+		ImagePullPolicy: corev1.PullAlways,
+		Env: []corev1.EnvVar{
+			{Name: "PROBE_PORT", Value: strconv.Itoa(probePort)},
+			{Name: "LOG_LEVEL", Value: logLevel},
+			{Name: "CONFIG_FILE", Value: globalSidecarConfigDir + "/" + globalSidecarConfigFile},
+			{Name: "TRUSTED_PROXIES", Value: strings.Join(proxy.DefaultTrustedProxies, ",")},
+		},
+		// no container ports, which would roll out global-sidecar once wormhole ports change.
+		// Inbound traffic of all ports is intercepted by istio anyway.
+		VolumeMounts:    []corev1.VolumeMount{{Name: "config", MountPath: globalSidecarConfigDir, ReadOnly: true}},
+		LivenessProbe:   probe("/healthz/live", 600, 30, 15, 3),
+		ReadinessProbe:  probe("/healthz/ready", 1, 2, 1, 30),
+		Resources:       globalSidecarResources(gs.GetResources()),
+		SecurityContext: &corev1.SecurityContext{RunAsUser: &runAsUser},
+	}
+	setContainerEnv(&container, "DEPENDENCY_REPORT_ADDR", gs.GetDependencyReportAddr())
+	setContainerEnv(&container, "ACCESS_LOG", gs.GetAccessLog())
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GlobalSidecarName,
+			Namespace: ns,
+			Labels:    map[string]string{"app": GlobalSidecarName},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": GlobalSidecarName}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      podLabels,
+					Annotations: annotations,
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: GlobalSidecarName,
+					// longer than drainDelay and drain timeout of the proxy
+					TerminationGracePeriodSeconds: &terminationGracePeriod,
+					Containers:                    []corev1.Container{container},
+					Volumes: []corev1.Volume{{
+						Name: "config",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: GlobalSidecarName},
+								DefaultMode:          &configMode,
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// globalSidecarResources converts res to the resource requirements of container, quantities are validated
+// by ResolveFenceConfig
+func globalSidecarResources(res *lazyloadv1alpha1.GlobalSidecarResources) corev1.ResourceRequirements {
+	convert := func(m map[string]string) corev1.ResourceList {
+		if len(m) == 0 {
+			return nil
+		}
+		ret := make(corev1.ResourceList, len(m))
+		for k, v := range m {
+			if q, err := resource.ParseQuantity(v); err == nil {
+				ret[corev1.ResourceName(k)] = q
+			}
+		}
+		return ret
+	}
+	return corev1.ResourceRequirements{Requests: convert(res.GetRequests()), Limits: convert(res.GetLimits())}
+}
+
+// newGlobalSidecarSidecar lets global-sidecar see all services and pass through unknown ones, even if
+// a default sidecar of the namespace or the mesh config restricts them
+func newGlobalSidecarSidecar(ns, rev string) (*v1alpha3.Sidecar, error) {
+	spec, err := normalizeSpec(map[string]interface{}{
+		"workloadSelector":      map[string]interface{}{"labels": map[string]interface{}{"app": GlobalSidecarName}},
+		"egress":                []interface{}{map[string]interface{}{"hosts": []interface{}{"*/*"}}},
+		"outboundTrafficPolicy": map[string]interface{}{"mode": "ALLOW_ANY"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sidecar := &v1alpha3.Sidecar{
+		ObjectMeta: metav1.ObjectMeta{Name: GlobalSidecarName, Namespace: ns},
+		Spec:       spec,
+	}
+	model.PatchIstioRevLabel(&sidecar.Labels, rev)
+	return sidecar, nil
+}
+
+// normalizeSpec makes spec like the one decoded from api server, so that it can be compared
+func normalizeSpec(spec map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]interface{}{}
+	if err = json.Unmarshal(raw, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// renderDispatches returns Fence.Dispatches with clusters rendered like the tpl function of the chart,
+// e.g. outbound|80||gateway.{{ .Values.namespace }}.svc.cluster.local. Dispatches fail to render are skipped.
+func (r *ServicefenceReconciler) renderDispatches() []*lazyloadv1alpha1.Dispatch {
+	values := map[string]interface{}{
+		"Values": map[string]interface{}{
+			"namespace":      r.cfg.GetGlobalSidecar().GetNamespace(),
+			"istioNamespace": r.env.Config.Global.IstioNamespace,
+		},
+	}
+	ret := make([]*lazyloadv1alpha1.Dispatch, 0, len(r.cfg.Dispatches))
+	for _, d := range r.cfg.Dispatches {
+		cluster, err := renderDispatchCluster(d.Cluster, values)
+		if err != nil {
+			log.Warningf("skip dispatch %s, render cluster %q failed, %v", d.Name, d.Cluster, err)
+			continue
+		}
+		rendered := d.DeepCopy()
+		rendered.Cluster = cluster
+		ret = append(ret, rendered)
+	}
+	return ret
+}
+
+func renderDispatchCluster(cluster string, values interface{}) (string, error) {
+	if !strings.Contains(cluster, "{{") {
+		return cluster, nil
+	}
+	t, err := template.New("cluster").Option("missingkey=error").Parse(cluster)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err = t.Execute(&b, values); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// setContainerEnv sets the env of container to value, empty value removes it. It returns true if the env is changed.
+func setContainerEnv(c *corev1.Container, name, value string) bool {
+	for i := range c.Env {
+		if c.Env[i].Name != name {
+			continue
+		}
+		if value == "" {
+			c.Env = append(c.Env[:i], c.Env[i+1:]...)
+			return true
+		}
+		if c.Env[i].Value == value && c.Env[i].ValueFrom == nil {
+			return false
+		}
+		c.Env[i] = corev1.EnvVar{Name: name, Value: value}
+		return true
+	}
+	if value == "" {
+		return false
+	}
+	c.Env = append(c.Env, corev1.EnvVar{Name: name, Value: value})
+	return true
+}
+
+// proxyDispatches returns the dispatches of global-sidecar from the rendered dispatches, so that requests
+// reaching global-sidecar are dispatched by the same rules as the to-global-sidecar envoyfilter
+func proxyDispatches(dispatches []*lazyloadv1alpha1.Dispatch) []proxy.DispatchConfig {
+	if len(dispatches) == 0 {
+		return nil
+	}
+	cfgs := make([]proxy.DispatchConfig, 0, len(dispatches))
+	for _, d := range dispatches {
+		cfg := proxy.DispatchConfig{Name: d.Name, Domains: d.Domains, Cluster: d.Cluster}
+		if err := cfg.Validate(); err != nil {
+			// the proxy would refuse to start with it
+			log.Warningf("dispatch %s is not passed to global-sidecar, %v", d.Name, err)
+			continue
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs
+}
+
+// newToGlobalSidecarEnvoyFilter makes the outbound routes of wormhole ports point to global-sidecar or the dispatch
+// clusters, the same as the to-global-sidecar envoyfilter in chart
+func newToGlobalSidecarEnvoyFilter(t globalSidecarTarget, ports []int32, dispatches []*lazyloadv1alpha1.Dispatch,
+	clusterDomain, rev string) (*v1alpha3.EnvoyFilter, error) {
+	var patches []interface{}
+	for _, p := range ports {
+		routeName := strconv.Itoa(int(p))
+		globalSidecarCluster := fmt.Sprintf("outbound|%d||%s.%s.svc.%s", p, GlobalSidecarName, t.namespace, clusterDomain)
+
+		var vhosts []interface{}
+		if len(dispatches) > 0 {
+			for _, d := range dispatches {
+				cluster := d.Cluster
+				if cluster == proxy.DispatchClusterGlobalSidecar {
+					cluster = globalSidecarCluster
+				}
+				domains := make([]interface{}, 0, len(d.Domains))
+				for _, domain := range d.Domains {
+					domains = append(domains, domain)
+				}
+				vhosts = append(vhosts, newVirtualHost(d.Name, domains, cluster))
+			}
+		} else {
+			vhosts = append(vhosts, newVirtualHost("to_global_sidecar", []interface{}{"*"}, globalSidecarCluster))
+		}
+
+		headersToAdd := []interface{}{
+			newHeaderToAdd(proxy.HeaderOrigDest, "%DOWNSTREAM_LOCAL_ADDRESS%"),
+			// the source pod, which global-sidecar takes as the source ip as it comes from the trusted local sidecar
+			newHeaderToAdd("X-Forwarded-For", "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%"),
+		}
+		if t.sourceNs != "" {
+			headersToAdd = append(headersToAdd, newHeaderToAdd(proxy.HeaderSourceNs, t.sourceNs))
+		}
+
+		patches = append(patches,
+			map[string]interface{}{
+				"applyTo": "VIRTUAL_HOST",
+				"match": map[string]interface{}{
+					"context": "SIDECAR_OUTBOUND",
+					"routeConfiguration": map[string]interface{}{
+						"name":  routeName,
+						"vhost": map[string]interface{}{"name": "allow_any"},
+					},
+				},
+				"patch": map[string]interface{}{"operation": "REMOVE"},
+			},
+			map[string]interface{}{
+				"applyTo": "ROUTE_CONFIGURATION",
+				"match": map[string]interface{}{
+					"context":            "SIDECAR_OUTBOUND",
+					"routeConfiguration": map[string]interface{}{"name": routeName},
+				},
+				"patch": map[string]interface{}{
+					"operation": "MERGE",
+					"value": map[string]interface{}{
+						"virtual_hosts":          vhosts,
+						"request_headers_to_add": headersToAdd,
+					},
+				},
+			},
+		)
+
+		if t.sourceNs == "" {
+			// cluster mode, the source namespace is set by lua from the env of source pod
+			patches = append(patches,
+				map[string]interface{}{
+					"applyTo": "HTTP_FILTER",
+					"match": map[string]interface{}{
+						"context": "SIDECAR_OUTBOUND",
+						"listener": map[string]interface{}{
+							"name": "0.0.0.0_" + routeName,
+							"filterChain": map[string]interface{}{
+								"filter": map[string]interface{}{
+									"name":      "envoy.filters.network.http_connection_manager",
+									"subFilter": map[string]interface{}{"name": "envoy.filters.http.router"},
+								},
+							},
+						},
+					},
+					"patch": map[string]interface{}{
+						"operation": "INSERT_BEFORE",
+						"value": map[string]interface{}{
+							"name": "envoy.filters.http.lua",
+							"typed_config": map[string]interface{}{
+								"@type":       "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
+								"inline_code": "-- place holder\n",
+							},
+						},
+					},
+				},
+				map[string]interface{}{
+					"applyTo": "HTTP_ROUTE",
+					"match": map[string]interface{}{
+						"context": "SIDECAR_OUTBOUND",
+						"routeConfiguration": map[string]interface{}{
+							"name":  routeName,
+							"vhost": map[string]interface{}{"name": "to_global_sidecar"},
+						},
+					},
+					"patch": map[string]interface{}{
+						"operation": "MERGE",
+						"value": map[string]interface{}{
+							"typed_per_filter_config": map[string]interface{}{
+								"envoy.filters.http.lua": map[string]interface{}{
+									"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.LuaPerRoute",
+									"source_code": map[string]interface{}{
+										"inline_string": "function envoy_on_request(request_handle)\n" +
+											"  request_handle:headers():replace(\"Slime-Source-Ns\", os.getenv(\"POD_NAMESPACE\"))\n" +
+											"end\n",
+									},
+								},
+							},
+						},
+					},
+				},
+			)
+		}
+
+		// global-sidecar itself passes through the requests
+		globalSidecarProxy := map[string]interface{}{
+			"metadata": map[string]interface{}{"SLIME_APP": "LAZYLOAD_GLOBAL_SIDECAR"},
+		}
+		patches = append(patches,
+			map[string]interface{}{
+				"applyTo": "VIRTUAL_HOST",
+				"match": map[string]interface{}{
+					"proxy":   globalSidecarProxy,
+					"context": "SIDECAR_OUTBOUND",
+					"routeConfiguration": map[string]interface{}{
+						"name":  routeName,
+						"vhost": map[string]interface{}{"name": "to_global_sidecar"},
+					},
+				},
+				"patch": map[string]interface{}{"operation": "REMOVE"},
+			},
+			map[string]interface{}{
+				"applyTo": "ROUTE_CONFIGURATION",
+				"match": map[string]interface{}{
+					"proxy":              globalSidecarProxy,
+					"context":            "SIDECAR_OUTBOUND",
+					"routeConfiguration": map[string]interface{}{"name": routeName},
+				},
+				"patch": map[string]interface{}{
+					"operation": "MERGE",
+					"value": map[string]interface{}{
+						"virtual_hosts": []interface{}{
+							newVirtualHost("allow_any_new", []interface{}{"*"}, "PassthroughCluster"),
+						},
+					},
+				},
+			},
+		)
+	}
+
+	spec, err := normalizeSpec(map[string]interface{}{"configPatches": patches})
+	if err != nil {
+		return nil, err
+	}
+	ef := &v1alpha3.EnvoyFilter{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ToGlobalSidecarEnvoyFilter,
+			Namespace: t.envoyFilterNamespace,
+		},
+		Spec: spec,
+	}
+	model.PatchIstioRevLabel(&ef.Labels, rev)
+	return ef, nil
+}
+
+func newVirtualHost(name string, domains []interface{}, cluster string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    name,
+		"domains": domains,
+		"routes": []interface{}{
+			map[string]interface{}{
+				"match": map[string]interface{}{"prefix": "/"},
+				"route": map[string]interface{}{"cluster": cluster},
+			},
+		},
+	}
+}
+
+func newHeaderToAdd(key, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"header": map[string]interface{}{"key": key, "value": value},
+		"append": true,
+	}
+}
@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"slime.io/slime/framework/apis/networking/v1alpha3"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// readGolden decodes the objects of a multi-document yaml file
+func readGolden(t *testing.T, path string) []runtime.Object {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret []runtime.Object
+	for _, doc := range strings.Split(string(b), "\n---\n") {
+		if !strings.Contains(doc, "kind:") {
+			continue
+		}
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode([]byte(doc), nil, nil)
+		if err != nil {
+			t.Fatalf("decode %s failed, %v:\n%s", path, err, doc)
+		}
+		ret = append(ret, obj)
+	}
+	return ret
+}
+
+// getRendered gets the object like want from the client, nil if it does not exist
+func getRendered(t *testing.T, r *ServicefenceReconciler, want runtime.Object) runtime.Object {
+	t.Helper()
+	accessor, err := meta.Accessor(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reflect.New(reflect.TypeOf(want).Elem()).Interface().(runtime.Object)
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, got)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// configFile decodes the proxy config file of the global-sidecar configmap
+func configFile(t *testing.T, cm *corev1.ConfigMap) globalSidecarConfig {
+	t.Helper()
+	var ret globalSidecarConfig
+	if err := json.Unmarshal([]byte(cm.Data[globalSidecarConfigFile]), &ret); err != nil {
+		t.Fatalf("invalid %s of configmap %s/%s, %v", globalSidecarConfigFile, cm.Namespace, cm.Name, err)
+	}
+	return ret
+}
+
+func TestGlobalSidecarObjectsMatchChart(t *testing.T) {
+	accessLogSource := func(ns string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: accessLogSourceConfigMap, Namespace: ns}}
+	}
+
+	cases := []struct {
+		name   string
+		cfg    *lazyloadv1alpha1.Fence
+		golden string
+	}{
+		{
+			name: "cluster",
+			cfg: &lazyloadv1alpha1.Fence{
+				GlobalSidecarMode: GlobalSidecarModeCluster,
+				WormholePort:      []string{"9080", "80"},
+				Dispatches: []*lazyloadv1alpha1.Dispatch{
+					{Name: "baidu", Domains: []string{"www.baidu.com"},
+						Cluster: "outbound|80||baidu.{{ .Values.namespace }}.svc.cluster.local"},
+					{Name: "rest", Domains: []string{"*"}, Cluster: "_GLOBAL_SIDECAR"},
+				},
+				GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{
+					Render:    true,
+					Namespace: "mesh-operator",
+					Image:     "slimeio/slime-global-sidecar:v0.5.0",
+					Labels:    map[string]string{"sidecar.istio.io/inject": "true"},
+					Resources: &lazyloadv1alpha1.GlobalSidecarResources{
+						Requests: map[string]string{"cpu": "200m", "memory": "200Mi"},
+						Limits:   map[string]string{"cpu": "400m", "memory": "400Mi"},
+					},
+					DependencyReportAddr: "lazyload.mesh-operator:8080",
+				},
+			},
+			golden: "testdata/global-sidecar-cluster.yaml",
+		},
+		{
+			name: "namespace",
+			cfg: &lazyloadv1alpha1.Fence{
+				GlobalSidecarMode: GlobalSidecarModeNamespace,
+				Namespace:         []string{"default"},
+				WormholePort:      []string{"9080"},
+				GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{
+					Render: true,
+					Image:  "slimeio/slime-global-sidecar:v0.5.0",
+				},
+			},
+			golden: "testdata/global-sidecar-namespace.yaml",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newTestReconciler(t, c.cfg, accessLogSource("mesh-operator"), accessLogSource("default"))
+			if err := r.ReconcileGlobalSidecar(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range readGolden(t, c.golden) {
+				got := getRendered(t, r, want)
+				if got == nil {
+					t.Errorf("%T is not rendered", want)
+					continue
+				}
+				gotMeta, _ := meta.Accessor(got)
+				wantMeta, _ := meta.Accessor(want)
+				labels := map[string]string{}
+				for k, v := range gotMeta.GetLabels() {
+					labels[k] = v
+				}
+				if labels[LabelCreatedBy] != CreatedByFenceController {
+					t.Errorf("%T is not labeled as created by controller", got)
+				}
+				delete(labels, LabelCreatedBy)
+				if !reflect.DeepEqual(labels, wantMeta.GetLabels()) && len(labels)+len(wantMeta.GetLabels()) > 0 {
+					t.Errorf("labels of %T = %v, want %v", got, labels, wantMeta.GetLabels())
+				}
+
+				var gotSpec, wantSpec interface{}
+				switch got := got.(type) {
+				case *corev1.ServiceAccount:
+					continue
+				case *corev1.ConfigMap:
+					gotSpec, wantSpec = configFile(t, got), configFile(t, want.(*corev1.ConfigMap))
+				case *corev1.Service:
+					gotSpec, wantSpec = got.Spec, want.(*corev1.Service).Spec
+				case *appsv1.Deployment:
+					gotSpec, wantSpec = got.Spec, want.(*appsv1.Deployment).Spec
+				case *v1alpha3.Sidecar:
+					gotSpec, wantSpec = got.Spec, want.(*v1alpha3.Sidecar).Spec
+				case *v1alpha3.EnvoyFilter:
+					gotSpec, wantSpec = got.Spec, want.(*v1alpha3.EnvoyFilter).Spec
+				}
+				if !equality.Semantic.DeepEqual(gotSpec, wantSpec) {
+					gotJSON, _ := json.MarshalIndent(gotSpec, "", "  ")
+					wantJSON, _ := json.MarshalIndent(wantSpec, "", "  ")
+					t.Errorf("spec of %T differs from chart\ngot:  %s\nwant: %s", got, gotJSON, wantJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileGlobalSidecarUpdatesAndRemoves(t *testing.T) {
+	cfg := &lazyloadv1alpha1.Fence{
+		GlobalSidecarMode: GlobalSidecarModeNamespace,
+		AutoFence:         true,
+		WormholePort:      []string{"9080"},
+		GlobalSidecar:     &lazyloadv1alpha1.GlobalSidecar{Render: true, Image: "global-sidecar:v1"},
+	}
+	// installed by the chart before, which is adopted
+	chartSvc := newGlobalSidecarService("a", []int32{80})
+	r := newTestReconciler(t, cfg, chartSvc)
+	r.enabledNamespaces = map[string]bool{"a": true, "b": true}
+
+	if err := r.ReconcileGlobalSidecar(); err != nil {
+		t.Fatal(err)
+	}
+	for _, ns := range []string{"a", "b"} {
+		svc := getRendered(t, r, newGlobalSidecarService(ns, nil)).(*corev1.Service)
+		if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Port != 9080 || svc.Labels[LabelCreatedBy] != CreatedByFenceController {
+			t.Errorf("service of %s is not rendered, got %+v", ns, svc)
+		}
+	}
+
+	deployKey := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: GlobalSidecarName}}
+	template := getRendered(t, r, deployKey).(*appsv1.Deployment).Spec.Template
+
+	// ports change converges
+	r.cfg.WormholePort = []string{"9080", "9090"}
+	// namespace b is unfenced
+	r.enabledNamespaces["b"] = false
+	if err := r.ReconcileGlobalSidecar(); err != nil {
+		t.Fatal(err)
+	}
+	cm := getRendered(t, r, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: GlobalSidecarName}}).(*corev1.ConfigMap)
+	if ports := configFile(t, cm).WormholePorts; len(ports) != 2 || ports[1].Port != 9090 {
+		t.Errorf("ports of global-sidecar config are not updated, got %v", ports)
+	}
+	// reloaded by global-sidecar without a rollout
+	if got := getRendered(t, r, deployKey).(*appsv1.Deployment).Spec.Template; !equality.Semantic.DeepEqual(got, template) {
+		t.Errorf("pod template of global-sidecar changes with ports")
+	}
+	for _, obj := range []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: GlobalSidecarName}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: GlobalSidecarName}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: GlobalSidecarName}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: GlobalSidecarName}},
+		&v1alpha3.Sidecar{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: GlobalSidecarName}},
+		&v1alpha3.EnvoyFilter{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: ToGlobalSidecarEnvoyFilter}},
+	} {
+		if getRendered(t, r, obj) != nil {
+			t.Errorf("%T of unfenced namespace b is not removed", obj)
+		}
+	}
+
+	// rendering is disabled, the rendered objects are removed but the ones of others are kept
+	others := newGlobalSidecarService("c", []int32{80})
+	if err := r.Client.Create(context.TODO(), others); err != nil {
+		t.Fatal(err)
+	}
+	r.cfg.GlobalSidecar.Render = false
+	if err := r.ReconcileGlobalSidecar(); err != nil {
+		t.Fatal(err)
+	}
+	if getRendered(t, r, deployKey) != nil {
+		t.Errorf("deployment of a is not removed after rendering is disabled")
+	}
+	if getRendered(t, r, newGlobalSidecarService("c", nil)) == nil {
+		t.Errorf("service not created by controller is removed")
+	}
+}
+
+func TestSyncGlobalSidecarDeploymentAnnotations(t *testing.T) {
+	desired := &appsv1.Deployment{}
+	desired.Spec.Template.Annotations = map[string]string{annotationProxyConfig: globalSidecarProxyConfig}
+	desired.Spec.Template.Spec.Containers = []corev1.Container{{Name: GlobalSidecarName}}
+
+	found := desired.DeepCopy()
+	found.Spec.Template.Annotations = map[string]string{
+		annotationProxyConfig:               "stale",
+		annotationBootstrapOverride:         accessLogSourceConfigMap,
+		"kubectl.kubernetes.io/restartedAt": "2021-06-01T10:00:00Z",
+	}
+	if !syncGlobalSidecarObject(found, desired) {
+		t.Fatalf("changes of rendered annotations are not synced")
+	}
+	want := map[string]string{
+		annotationProxyConfig:               globalSidecarProxyConfig,
+		"kubectl.kubernetes.io/restartedAt": "2021-06-01T10:00:00Z",
+	}
+	if !reflect.DeepEqual(found.Spec.Template.Annotations, want) {
+		t.Errorf("got annotations %v, want %v", found.Spec.Template.Annotations, want)
+	}
+	if syncGlobalSidecarObject(found, desired) {
+		t.Errorf("annotations of others are taken as a change")
+	}
+}
+
+func TestRenderDispatchCluster(t *testing.T) {
+	values := map[string]interface{}{"Values": map[string]interface{}{"namespace": "mesh-operator"}}
+	cases := []struct {
+		cluster string
+		want    string
+		wantErr bool
+	}{
+		{cluster: "_GLOBAL_SIDECAR", want: "_GLOBAL_SIDECAR"},
+		{cluster: "outbound|80||a.{{ .Values.namespace }}.svc.cluster.local", want: "outbound|80||a.mesh-operator.svc.cluster.local"},
+		{cluster: "outbound|80||a.{{ .Values.unknown }}.svc.cluster.local", wantErr: true},
+		{cluster: "{{ include \"x\" . }}", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := renderDispatchCluster(c.cluster, values)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("renderDispatchCluster(%q) = %q, %v, want %q, err %v", c.cluster, got, err, c.want, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	prometheusModel "github.com/prometheus/common/model"
+	"slime.io/slime/framework/model/metric"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// labels of metric keys recognized as dependencies
+const (
+	labelDestinationService = "destination_service"
+	labelRequestHost        = "request_host"
+	labelDestinationPort    = "destination_port"
+	labelRequestProtocol    = "request_protocol"
+)
+
+// parseMetricKey parses a metric key like {destination_service="x.ns.svc.cluster.local",destination_port="80"},
+// which is the label set of a prometheus sample
+func parseMetricKey(key string) (map[string]string, error) {
+	s := strings.TrimSpace(key)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("metric key %s is not enclosed in {}", key)
+	}
+	s = s[1 : len(s)-1]
+
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return labels, nil
+		}
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid label in metric key %s", key)
+		}
+		name := strings.TrimSpace(s[:i])
+		s = strings.TrimLeft(s[i+1:], " ")
+		if !strings.HasPrefix(s, `"`) {
+			return nil, fmt.Errorf("value of label %s is not quoted in metric key %s", name, key)
+		}
+		// find the closing quote, skipping the escaped ones
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("value of label %s is not closed in metric key %s", name, key)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of label %s in metric key %s, %v", name, key, err)
+		}
+		labels[name] = value
+		s = s[end+1:]
+	}
+}
+
+// formatMetricKey is the reverse of parseMetricKey
+func formatMetricKey(labels map[string]string) string {
+	ls := make(prometheusModel.LabelSet, len(labels))
+	for k, v := range labels {
+		ls[prometheusModel.LabelName(k)] = prometheusModel.LabelValue(v)
+	}
+	return ls.String()
+}
+
+// metricDependencyKey returns the metric key of dep
+func metricDependencyKey(dep *lazyloadv1alpha1.MetricDependency) string {
+	labels := map[string]string{labelDestinationService: dep.Host}
+	if dep.Port != 0 {
+		labels[labelDestinationPort] = strconv.Itoa(int(dep.Port))
+	}
+	if dep.Protocol != "" {
+		labels[labelRequestProtocol] = dep.Protocol
+	}
+	return formatMetricKey(labels)
+}
+
+// newMetricDependency converts a metric key and its value to a dependency, nil is returned if
+// the key has no destination host
+func newMetricDependency(key, value, source string) *lazyloadv1alpha1.MetricDependency {
+	labels, err := parseMetricKey(key)
+	if err != nil {
+		log.Debugf("skip metric %s, %v", key, err)
+		return nil
+	}
+	host := labels[labelDestinationService]
+	if host == "" {
+		host = labels[labelRequestHost]
+	}
+	if host == "" {
+		return nil
+	}
+
+	dep := &lazyloadv1alpha1.MetricDependency{Host: host, Protocol: labels[labelRequestProtocol]}
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		dep.Host, labels[labelDestinationPort] = h, p
+	}
+	if p, err := strconv.ParseUint(labels[labelDestinationPort], 10, 16); err == nil {
+		dep.Port = uint32(p)
+	}
+	if dep.Count, err = strconv.ParseFloat(value, 64); err != nil {
+		// the value of old metric may be a timestamp instead of a count
+		dep.Count = 1
+	}
+	if source != "" {
+		dep.Sources = []string{source}
+	}
+	return dep
+}
+
+// metricResultSource returns the metric source of the result
+func metricResultSource(result metric.Result) string {
+	if result.Name == AccessLogConvertorName {
+		return MetricSourceTypeAccesslog
+	}
+	return MetricSourceTypePrometheus
+}
+
+// newMetricDependencies converts the results of all handlers and sources of a fence to dependencies.
+// Dependencies of the same host and port are merged, the larger count wins and the sources are joined.
+func newMetricDependencies(results []metric.Result) []*lazyloadv1alpha1.MetricDependency {
+	var deps []*lazyloadv1alpha1.MetricDependency
+	for _, result := range results {
+		source := metricResultSource(result)
+		for k, v := range result.Value {
+			if dep := newMetricDependency(k, v, source); dep != nil {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return mergeMetricDependencies(deps)
+}
+
+// mergeMetricDependencies merges and sorts deps by host and port. The input is not modified.
+func mergeMetricDependencies(deps []*lazyloadv1alpha1.MetricDependency) []*lazyloadv1alpha1.MetricDependency {
+	type depKey struct {
+		host string
+		port uint32
+	}
+	merged := map[depKey]*lazyloadv1alpha1.MetricDependency{}
+	for _, dep := range deps {
+		k := depKey{dep.Host, dep.Port}
+		old, ok := merged[k]
+		if !ok {
+			merged[k] = dep.DeepCopy()
+			continue
+		}
+		if dep.Count > old.Count {
+			old.Count = dep.Count
+		}
+		if old.Protocol == "" {
+			old.Protocol = dep.Protocol
+		}
+		if dep.LastSeen != nil && (old.LastSeen == nil || dep.LastSeen.Seconds > old.LastSeen.Seconds) {
+			old.LastSeen = dep.LastSeen.DeepCopy()
+		}
+		for _, s := range dep.Sources {
+			if !stringsContains(old.Sources, s) {
+				old.Sources = append(old.Sources, s)
+			}
+		}
+	}
+
+	ret := make([]*lazyloadv1alpha1.MetricDependency, 0, len(merged))
+	for _, dep := range merged {
+		sort.Strings(dep.Sources)
+		ret = append(ret, dep)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Host != ret[j].Host {
+			return ret[i].Host < ret[j].Host
+		}
+		return ret[i].Port < ret[j].Port
+	})
+	return ret
+}
+
+func stringsContains(ss []string, s string) bool {
+	for _, item := range ss {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// metricStatusToDependencies converts the deprecated status.metricStatus to dependencies
+func metricStatusToDependencies(metricStatus map[string]string) []*lazyloadv1alpha1.MetricDependency {
+	var deps []*lazyloadv1alpha1.MetricDependency
+	for k, v := range metricStatus {
+		if dep := newMetricDependency(k, v, ""); dep != nil {
+			deps = append(deps, dep)
+		}
+	}
+	return mergeMetricDependencies(deps)
+}
+
+// fenceMetricDependencies returns the dependencies in status of sf, including the ones in the deprecated
+// status.metricStatus which are not converted yet
+func fenceMetricDependencies(sf *lazyloadv1alpha1.ServiceFence) []*lazyloadv1alpha1.MetricDependency {
+	if len(sf.Status.MetricStatus) == 0 {
+		return sf.Status.MetricDependencies
+	}
+	deps := append([]*lazyloadv1alpha1.MetricDependency{}, sf.Status.MetricDependencies...)
+	return mergeMetricDependencies(append(deps, metricStatusToDependencies(sf.Status.MetricStatus)...))
+}
+
+// keepReportedDependencies returns deps with the dependencies reported by global-sidecar in status of sf,
+// which are kept until their LastSeen is older than reportedDependencyTTL unless deps has them.
+func keepReportedDependencies(sf *lazyloadv1alpha1.ServiceFence, deps []*lazyloadv1alpha1.MetricDependency, now time.Time) []*lazyloadv1alpha1.MetricDependency {
+	found := map[string]bool{}
+	for _, dep := range deps {
+		found[net.JoinHostPort(dep.Host, strconv.Itoa(int(dep.Port)))] = true
+	}
+	var kept []*lazyloadv1alpha1.MetricDependency
+	for _, dep := range sf.Status.MetricDependencies {
+		if !stringsContains(dep.Sources, dependencySourceReport) || found[net.JoinHostPort(dep.Host, strconv.Itoa(int(dep.Port)))] {
+			continue
+		}
+		if dep.LastSeen != nil && now.Sub(time.Unix(dep.LastSeen.Seconds, 0)) > reportedDependencyTTL {
+			continue
+		}
+		kept = append(kept, dep)
+	}
+	if len(kept) == 0 {
+		return deps
+	}
+	return mergeMetricDependencies(append(append([]*lazyloadv1alpha1.MetricDependency{}, deps...), kept...))
+}
+
+// setMetricDependencies replaces the dependencies in status of sf with deps, and returns whether any
+// dependency is added, removed or has its count changed. LastSeen of a dependency is kept if its count
+// does not change and deps has no newer one, or set to now.
+func setMetricDependencies(sf *lazyloadv1alpha1.ServiceFence, deps []*lazyloadv1alpha1.MetricDependency, now time.Time) bool {
+	old := map[string]*lazyloadv1alpha1.MetricDependency{}
+	for _, dep := range fenceMetricDependencies(sf) {
+		old[net.JoinHostPort(dep.Host, strconv.Itoa(int(dep.Port)))] = dep
+	}
+
+	changed := len(old) != len(deps)
+	for _, dep := range deps {
+		o := old[net.JoinHostPort(dep.Host, strconv.Itoa(int(dep.Port)))]
+		if o != nil && o.Count == dep.Count && o.LastSeen != nil {
+			// a newer LastSeen of a report is kept
+			if dep.LastSeen == nil || dep.LastSeen.Seconds < o.LastSeen.Seconds {
+				dep.LastSeen = o.LastSeen
+			}
+			continue
+		}
+		changed = changed || o == nil || o.Count != dep.Count
+		dep.LastSeen = &lazyloadv1alpha1.Timestamp{Seconds: now.Unix()}
+	}
+
+	sf.Status.MetricDependencies = deps
+	// the deprecated metricStatus is converted
+	sf.Status.MetricStatus = nil
+	return changed
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func TestParseMetricKey(t *testing.T) {
+	cases := []struct {
+		key     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{key: `{}`, want: map[string]string{}},
+		{
+			key:  `{destination_service="details.default.svc.cluster.local", destination_port="9080"}`,
+			want: map[string]string{"destination_service": "details.default.svc.cluster.local", "destination_port": "9080"},
+		},
+		{key: ` { request_host = "a,b=c" } `, want: map[string]string{"request_host": "a,b=c"}},
+		{key: `{request_host="say \"hi\"\\"}`, want: map[string]string{"request_host": `say "hi"\`}},
+		{key: `destination_service="a"`, wantErr: true},
+		{key: `{destination_service=a}`, wantErr: true},
+		{key: `{destination_service="a}`, wantErr: true},
+		{key: `{="a"}`, wantErr: true},
+		{key: `{destination_service}`, wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseMetricKey(c.key)
+		if (err != nil) != c.wantErr || (!c.wantErr && !reflect.DeepEqual(got, c.want)) {
+			t.Errorf("parseMetricKey(%s) = %v, %v, want %v, err %v", c.key, got, err, c.want, c.wantErr)
+		}
+	}
+
+	labels := map[string]string{"destination_service": "details", "request_host": `say "hi"`}
+	if got, err := parseMetricKey(formatMetricKey(labels)); err != nil || !reflect.DeepEqual(got, labels) {
+		t.Errorf("parseMetricKey(formatMetricKey(%v)) = %v, %v", labels, got, err)
+	}
+}
+
+func TestNewMetricDependency(t *testing.T) {
+	cases := []struct {
+		name, key, value, source string
+		want                     *lazyloadv1alpha1.MetricDependency
+	}{
+		{
+			name:   "destination service",
+			key:    `{destination_service="details.default.svc.cluster.local",destination_port="9080",request_protocol="http"}`,
+			value:  "12.5",
+			source: MetricSourceTypePrometheus,
+			want: &lazyloadv1alpha1.MetricDependency{
+				Host: "details.default.svc.cluster.local", Port: 9080, Protocol: "http", Count: 12.5,
+				Sources: []string{MetricSourceTypePrometheus},
+			},
+		},
+		{
+			name:   "request host with port",
+			key:    `{request_host="details.default:9080"}`,
+			value:  "3",
+			source: MetricSourceTypeAccesslog,
+			want: &lazyloadv1alpha1.MetricDependency{
+				Host: "details.default", Port: 9080, Count: 3, Sources: []string{MetricSourceTypeAccesslog},
+			},
+		},
+		{
+			name:  "destination service wins over request host",
+			key:   `{destination_service="details",request_host="other"}`,
+			value: "1",
+			want:  &lazyloadv1alpha1.MetricDependency{Host: "details", Count: 1},
+		},
+		{
+			name:  "legacy timestamp value",
+			key:   `{destination_service="details"}`,
+			value: "2021-06-01 10:00:00 +0800 CST",
+			want:  &lazyloadv1alpha1.MetricDependency{Host: "details", Count: 1},
+		},
+		{name: "invalid port", key: `{destination_service="details",destination_port="http"}`, value: "1",
+			want: &lazyloadv1alpha1.MetricDependency{Host: "details", Count: 1}},
+		{name: "no host", key: `{destination_port="9080"}`, value: "1"},
+		{name: "invalid key", key: `details`, value: "1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := newMetricDependency(c.key, c.value, c.source); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("newMetricDependency() = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMetricStatusToDependencies(t *testing.T) {
+	got := metricStatusToDependencies(map[string]string{
+		`{destination_service="reviews"}`:                         "2",
+		`{destination_service="details"}`:                         "1",
+		`{destination_service="details",request_protocol="http"}`: "5",
+		`{destination_service="details",destination_port="80"}`:   "1",
+		`{request_host="ratings:9080"}`:                           "2021-06-01 10:00:00 +0800 CST",
+		`not a key`:                                               "1",
+	})
+	want := []*lazyloadv1alpha1.MetricDependency{
+		{Host: "details", Count: 5, Protocol: "http"},
+		{Host: "details", Port: 80, Count: 1},
+		{Host: "ratings", Port: 9080, Count: 1},
+		{Host: "reviews", Count: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metricStatusToDependencies() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeMetricDependenciesKeepsInput(t *testing.T) {
+	a := &lazyloadv1alpha1.MetricDependency{Host: "details", Count: 1, Sources: []string{MetricSourceTypePrometheus}}
+	b := &lazyloadv1alpha1.MetricDependency{Host: "details", Count: 2, Sources: []string{MetricSourceTypeAccesslog}}
+	got := mergeMetricDependencies([]*lazyloadv1alpha1.MetricDependency{a, b})
+	if len(got) != 1 || got[0].Count != 2 || len(got[0].Sources) != 2 {
+		t.Fatalf("mergeMetricDependencies() = %+v", got)
+	}
+	if a.Count != 1 || len(a.Sources) != 1 || got[0] == a {
+		t.Errorf("input is modified, %+v", a)
+	}
+}
+
+func TestSetMetricDependencies(t *testing.T) {
+	now := time.Unix(10000, 0)
+	seen := func(d time.Duration) *lazyloadv1alpha1.Timestamp {
+		return &lazyloadv1alpha1.Timestamp{Seconds: now.Add(-d).Unix()}
+	}
+	dep := func(host string, count float64, lastSeen *lazyloadv1alpha1.Timestamp, sources ...string) *lazyloadv1alpha1.MetricDependency {
+		return &lazyloadv1alpha1.MetricDependency{Host: host, Count: count, LastSeen: lastSeen, Sources: sources}
+	}
+	old := []*lazyloadv1alpha1.MetricDependency{
+		dep("details", 1, seen(time.Minute), MetricSourceTypePrometheus),
+		dep("ratings", 1, seen(time.Minute), MetricSourceTypePrometheus),
+	}
+
+	cases := []struct {
+		name         string
+		status       []*lazyloadv1alpha1.MetricDependency
+		metricStatus map[string]string
+		deps         []*lazyloadv1alpha1.MetricDependency
+		want         []*lazyloadv1alpha1.MetricDependency
+		wantChanged  bool
+	}{
+		{
+			name:   "unchanged keeps last seen",
+			status: old,
+			deps:   []*lazyloadv1alpha1.MetricDependency{dep("details", 1, nil), dep("ratings", 1, nil)},
+			want:   []*lazyloadv1alpha1.MetricDependency{dep("details", 1, seen(time.Minute)), dep("ratings", 1, seen(time.Minute))},
+		},
+		{
+			name:        "count changed",
+			status:      old,
+			deps:        []*lazyloadv1alpha1.MetricDependency{dep("details", 2, nil), dep("ratings", 1, nil)},
+			want:        []*lazyloadv1alpha1.MetricDependency{dep("details", 2, seen(0)), dep("ratings", 1, seen(time.Minute))},
+			wantChanged: true,
+		},
+		{
+			name:   "newer last seen of a report",
+			status: old,
+			deps: []*lazyloadv1alpha1.MetricDependency{
+				dep("details", 1, seen(0), MetricSourceTypePrometheus, dependencySourceReport), dep("ratings", 1, seen(2*time.Minute)),
+			},
+			want: []*lazyloadv1alpha1.MetricDependency{
+				dep("details", 1, seen(0), MetricSourceTypePrometheus, dependencySourceReport), dep("ratings", 1, seen(time.Minute)),
+			},
+		},
+		{
+			name:        "removed",
+			status:      old,
+			deps:        []*lazyloadv1alpha1.MetricDependency{dep("details", 1, nil)},
+			want:        []*lazyloadv1alpha1.MetricDependency{dep("details", 1, seen(time.Minute))},
+			wantChanged: true,
+		},
+		{
+			name:         "legacy metric status is converted",
+			metricStatus: map[string]string{`{destination_service="details"}`: "2021-06-01 10:00:00 +0800 CST"},
+			deps:         []*lazyloadv1alpha1.MetricDependency{dep("details", 1, nil)},
+			want:         []*lazyloadv1alpha1.MetricDependency{dep("details", 1, seen(0))},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sf := testFence("default", "reviews")
+			for _, d := range c.status {
+				sf.Status.MetricDependencies = append(sf.Status.MetricDependencies, d.DeepCopy())
+			}
+			sf.Status.MetricStatus = c.metricStatus
+			changed := setMetricDependencies(sf, c.deps, now)
+			if changed != c.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, c.wantChanged)
+			}
+			if !reflect.DeepEqual(sf.Status.MetricDependencies, c.want) || sf.Status.MetricStatus != nil {
+				t.Errorf("status = %+v, %v, want %+v", sf.Status.MetricDependencies, sf.Status.MetricStatus, c.want)
+			}
+		})
+	}
+}
+
+func TestKeepReportedDependencies(t *testing.T) {
+	now := time.Now()
+	reported := func(host string, age time.Duration) *lazyloadv1alpha1.MetricDependency {
+		return &lazyloadv1alpha1.MetricDependency{
+			Host: host, Count: 1, Sources: []string{dependencySourceReport},
+			LastSeen: &lazyloadv1alpha1.Timestamp{Seconds: now.Add(-age).Unix()},
+		}
+	}
+	sf := testFence("default", "reviews")
+	sf.Status.MetricDependencies = []*lazyloadv1alpha1.MetricDependency{
+		reported("details", time.Minute),
+		reported("ratings", 2*reportedDependencyTTL),
+		reported("productpage", time.Minute),
+		{Host: "reviews", Count: 1, Sources: []string{MetricSourceTypePrometheus}},
+	}
+	deps := []*lazyloadv1alpha1.MetricDependency{
+		{Host: "productpage", Count: 3, Sources: []string{MetricSourceTypeAccesslog}},
+	}
+
+	got := keepReportedDependencies(sf, deps, now)
+	want := []*lazyloadv1alpha1.MetricDependency{
+		reported("details", time.Minute),
+		{Host: "productpage", Count: 3, Sources: []string{MetricSourceTypeAccesslog}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keepReportedDependencies() = %+v, want %+v", got, want)
+	}
+	if len(deps) != 1 {
+		t.Errorf("input is modified, %+v", deps)
+	}
+
+	r := newTestReconciler(t, nil)
+	r.setFenceMetricDependencies(sf, deps)
+	if len(sf.Status.MetricDependencies) != 2 || sf.Status.MetricDependencies[0].Host != "details" {
+		t.Errorf("reported dependency is dropped by refresh, got %+v", sf.Status.MetricDependencies)
+	}
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"slime.io/slime/framework/model/metric"
+)
+
+// multiSource dispatches handlers to the sources by handler name and collects all of their results.
+// The last results of a failed source are reused, so that one broken source does not erase the
+// dependencies found by the others.
+type multiSource struct {
+	sources []*namedSource
+
+	lastResults map[*namedSource]map[string][]metric.Result
+	sync.Mutex
+
+	// both producers start the source, but the sources should be started once
+	startOnce sync.Once
+	startErr  error
+}
+
+type namedSource struct {
+	name string
+	metric.Source
+	// handles returns whether handler belongs to the source
+	handles func(handler metric.Handler) bool
+}
+
+func newMultiSource(sources ...*namedSource) *multiSource {
+	return &multiSource{
+		sources:     sources,
+		lastResults: map[*namedSource]map[string][]metric.Result{},
+	}
+}
+
+func (s *multiSource) Start() error {
+	s.startOnce.Do(func() {
+		for _, src := range s.sources {
+			if err := src.Start(); err != nil {
+				log.Errorf("start metric source %s failed, %+v", src.name, err)
+				s.startErr = err
+			}
+		}
+	})
+	return s.startErr
+}
+
+func (s *multiSource) QueryMetric(queryMap metric.QueryMap) (metric.Metric, error) {
+	ret := metric.Metric{}
+	var errs []string
+	queried := 0
+	for _, src := range s.sources {
+		qm := metric.QueryMap{}
+		for meta, handlers := range queryMap {
+			for _, h := range handlers {
+				if src.handles(h) {
+					qm[meta] = append(qm[meta], h)
+				}
+			}
+		}
+		if len(qm) == 0 {
+			continue
+		}
+
+		// sources are queried without the lock, which only guards the last results
+		queried++
+		m, err := src.QueryMetric(qm)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", src.name, err))
+			log.Errorf("query metric source %s failed, use its last results, %+v", src.name, err)
+		}
+		s.collect(ret, src, qm, m, err)
+	}
+
+	if len(errs) > 0 && len(errs) == queried {
+		return nil, fmt.Errorf("all metric sources failed, %s", strings.Join(errs, "; "))
+	}
+	return ret, nil
+}
+
+// collect records the results m of src for the fences in qm if the query succeeds, and appends the last
+// results of src to ret
+func (s *multiSource) collect(ret metric.Metric, src *namedSource, qm metric.QueryMap, m metric.Metric, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	last := s.lastResults[src]
+	if last == nil {
+		last = map[string][]metric.Result{}
+		s.lastResults[src] = last
+	}
+	for meta := range qm {
+		if err == nil {
+			last[meta] = m[meta]
+		}
+		if results, ok := last[meta]; ok {
+			ret[meta] = append(ret[meta], results...)
+		}
+	}
+}
+
+// startProducers works like metric.NewProducer, but runs the producers on the given source
+func startProducers(config *metric.ProducerConfig, source metric.Source) {
+	var wp *metric.WatcherProducer
+	var tp *metric.TickerProducer
+
+	if config.EnableWatcherProducer {
+		wp = metric.NewWatcherProducer(config.WatcherProducerConfig, source)
+		wp.Start()
+		go wp.HandleWatcherEvent()
+	}
+
+	if config.EnableTickerProducer {
+		tp = metric.NewTickerProducer(config.TickerProducerConfig, source)
+		tp.Start()
+		go tp.HandleTickerEvent()
+	}
+
+	go func() {
+		<-config.StopChan
+		if wp != nil {
+			wp.Stop()
+		}
+		if tp != nil {
+			tp.Stop()
+		}
+		log.Infof("all producers stopped")
+	}()
+}
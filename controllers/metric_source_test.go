@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"slime.io/slime/framework/model/metric"
+)
+
+// fakeSource answers each handler with a result of its value, or fails if err is set
+type fakeSource struct {
+	value string
+	err   error
+	// block delays the queries until it is closed, if set
+	block chan struct{}
+
+	sync.Mutex
+	queried []metric.QueryMap
+}
+
+func (s *fakeSource) Start() error { return nil }
+
+func (s *fakeSource) QueryMetric(queryMap metric.QueryMap) (metric.Metric, error) {
+	if s.block != nil {
+		<-s.block
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.queried = append(s.queried, queryMap)
+	if s.err != nil {
+		return nil, s.err
+	}
+	ret := metric.Metric{}
+	for meta, handlers := range queryMap {
+		for _, h := range handlers {
+			ret[meta] = append(ret[meta], metric.Result{Name: h.Name, Value: map[string]string{meta: s.value}})
+		}
+	}
+	return ret, nil
+}
+
+func handledBy(name string) func(metric.Handler) bool {
+	return func(h metric.Handler) bool {
+		return h.Name == name
+	}
+}
+
+// resultValues returns the sorted "handler=value" of results
+func resultValues(results []metric.Result) []string {
+	var ret []string
+	for _, r := range results {
+		for _, v := range r.Value {
+			ret = append(ret, r.Name+"="+v)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestMultiSourceDispatchesAndMerges(t *testing.T) {
+	prom, accesslog := &fakeSource{value: "1"}, &fakeSource{value: "2"}
+	s := newMultiSource(
+		&namedSource{name: MetricSourceTypePrometheus, Source: prom, handles: handledBy("destination")},
+		&namedSource{name: MetricSourceTypeAccesslog, Source: accesslog, handles: handledBy(MetricSourceTypeAccesslog)},
+	)
+	destination, log := metric.Handler{Name: "destination"}, metric.Handler{Name: MetricSourceTypeAccesslog}
+
+	got, err := s.QueryMetric(metric.QueryMap{
+		"default/reviews":     {destination, log},
+		"default/productpage": {log},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []metric.QueryMap{{"default/reviews": {destination}}}; !reflect.DeepEqual(prom.queried, want) {
+		t.Errorf("prometheus is queried with %v, want %v", prom.queried, want)
+	}
+	if want := []metric.QueryMap{{"default/reviews": {log}, "default/productpage": {log}}}; !reflect.DeepEqual(accesslog.queried, want) {
+		t.Errorf("accesslog is queried with %v, want %v", accesslog.queried, want)
+	}
+	want := map[string][]string{
+		"default/reviews":     {"accesslog=2", "destination=1"},
+		"default/productpage": {"accesslog=2"},
+	}
+	for meta, values := range want {
+		if got := resultValues(got[meta]); !reflect.DeepEqual(got, values) {
+			t.Errorf("results of %s = %v, want %v", meta, got, values)
+		}
+	}
+
+	// a source without handlers is not queried
+	if _, err = s.QueryMetric(metric.QueryMap{"default/productpage": {log}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(prom.queried) != 1 {
+		t.Errorf("prometheus is queried without its handlers, %v", prom.queried)
+	}
+}
+
+func TestMultiSourceReusesLastResults(t *testing.T) {
+	prom, accesslog := &fakeSource{value: "1"}, &fakeSource{value: "2"}
+	s := newMultiSource(
+		&namedSource{name: MetricSourceTypePrometheus, Source: prom, handles: handledBy("destination")},
+		&namedSource{name: MetricSourceTypeAccesslog, Source: accesslog, handles: handledBy(MetricSourceTypeAccesslog)},
+	)
+	queryMap := metric.QueryMap{"default/reviews": {{Name: "destination"}, {Name: MetricSourceTypeAccesslog}}}
+	if _, err := s.QueryMetric(queryMap); err != nil {
+		t.Fatal(err)
+	}
+
+	prom.err, accesslog.value = fmt.Errorf("prometheus is down"), "3"
+	got, err := s.QueryMetric(queryMap)
+	if err != nil {
+		t.Fatalf("one failed source fails the query, %v", err)
+	}
+	if values, want := resultValues(got["default/reviews"]), []string{"accesslog=3", "destination=1"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got results %v, want the last ones of the failed source %v", values, want)
+	}
+
+	// no last results of the fence
+	got, err = s.QueryMetric(metric.QueryMap{"default/ratings": queryMap["default/reviews"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, want := resultValues(got["default/ratings"]), []string{"accesslog=3"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got results %v, want %v", values, want)
+	}
+
+	accesslog.err = fmt.Errorf("accesslog is down")
+	if _, err = s.QueryMetric(queryMap); err == nil {
+		t.Errorf("no error when all sources fail")
+	}
+	// only the queried sources count
+	prom.err = nil
+	accesslog.err = fmt.Errorf("accesslog is down")
+	if _, err = s.QueryMetric(metric.QueryMap{"default/reviews": {{Name: MetricSourceTypeAccesslog}}}); err == nil {
+		t.Errorf("no error when the only queried source fails")
+	}
+}
+
+func TestMultiSourceQueriesWithoutLock(t *testing.T) {
+	slow := &fakeSource{value: "1", block: make(chan struct{})}
+	fast := &fakeSource{value: "2"}
+	s := newMultiSource(
+		&namedSource{name: MetricSourceTypePrometheus, Source: slow, handles: handledBy("destination")},
+		&namedSource{name: MetricSourceTypeAccesslog, Source: fast, handles: handledBy(MetricSourceTypeAccesslog)},
+	)
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		_, _ = s.QueryMetric(metric.QueryMap{"default/reviews": {{Name: "destination"}}})
+	}()
+	fastDone := make(chan struct{})
+	go func() {
+		defer close(fastDone)
+		_, _ = s.QueryMetric(metric.QueryMap{"default/reviews": {{Name: MetricSourceTypeAccesslog}}})
+	}()
+
+	select {
+	case <-fastDone:
+	case <-time.After(5 * time.Second):
+		t.Errorf("query is blocked by a slow source")
+	}
+	close(slow.block)
+	<-slowDone
+}
@@ -9,6 +9,8 @@ import (
 	"regexp"
 	"sync"
 
+	corev1 "k8s.io/api/core/v1"
+
 	"slime.io/slime/framework/model"
 	modmodel "slime.io/slime/modules/lazyload/model"
 )
@@ -35,6 +37,14 @@ type LabelSvcCache struct {
 	sync.RWMutex
 }
 
+// PortSvcCache holds ports of each service, key is ns/name
+type PortSvcCache struct {
+	Data map[string][]corev1.ServicePort
+	// Changed is notified when ports of any service change
+	Changed chan struct{}
+	sync.RWMutex
+}
+
 type domainAliasRule struct {
 	pattern   string
 	templates []string
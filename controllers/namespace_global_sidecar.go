@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// namespaceGlobalSidecarManaged returns true if the controller manages the lifecycle of
+// global-sidecar in each fenced namespace
+func (r *ServicefenceReconciler) namespaceGlobalSidecarManaged() bool {
+	return r.cfg.GlobalSidecarMode == GlobalSidecarModeNamespace && r.globalSidecarRenderEnabled()
+}
+
+// isGlobalSidecarReady returns whether the global-sidecar of namespace has available replicas.
+// Caller should hold the reconcile lock.
+func (r *ServicefenceReconciler) isGlobalSidecarReady(ns string) bool {
+	r.seedGlobalSidecarReady(context.TODO())
+	return r.globalSidecarReady[ns]
+}
+
+// seedGlobalSidecarReady records the ready global-sidecars once, so that sidecars refreshed before the
+// deployment watch catches up still reference the ones already running. It is retried on the next call
+// if listing fails. Caller should hold the reconcile lock.
+func (r *ServicefenceReconciler) seedGlobalSidecarReady(ctx context.Context) {
+	if r.globalSidecarReadySeeded {
+		return
+	}
+	// only the global-sidecars rendered by the controller are managed in namespace mode
+	deploys := &appsv1.DeploymentList{}
+	if err := r.apiReader().List(ctx, deploys, client.MatchingLabels{LabelCreatedBy: CreatedByFenceController}); err != nil {
+		log.Errorf("list deployments to seed global-sidecar readiness failed, %+v", err)
+		return
+	}
+	for i := range deploys.Items {
+		deploy := &deploys.Items[i]
+		if deploy.Name == GlobalSidecarName && r.nsScope.contains(deploy.Namespace) && isDeploymentReady(deploy) {
+			r.globalSidecarReady[deploy.Namespace] = true
+		}
+	}
+	r.globalSidecarReadySeeded = true
+}
+
+func isDeploymentReady(deploy *appsv1.Deployment) bool {
+	return deploy.DeletionTimestamp == nil && deploy.Status.AvailableReplicas > 0
+}
+
+// ReconcileGlobalSidecarDeployment tracks the readiness of the namespace global-sidecar managed by controller
+// and refreshes the sidecars of the namespace once it changes, so that fences only reference a ready global-sidecar
+func (r *ServicefenceReconciler) ReconcileGlobalSidecarDeployment(req ctrl.Request) (ctrl.Result, error) {
+	if req.Name != GlobalSidecarName || !r.namespaceGlobalSidecarManaged() || !r.nsScope.contains(req.Namespace) {
+		return reconcile.Result{}, nil
+	}
+	ctx := context.TODO()
+
+	ready := false
+	deploy := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, req.NamespacedName, deploy); err != nil {
+		if !errors.IsNotFound(err) {
+			log.Errorf("get global-sidecar deployment %s error, %+v", req.NamespacedName, err)
+			return reconcile.Result{}, err
+		}
+	} else {
+		ready = isDeploymentReady(deploy)
+	}
+
+	r.reconcileLock.Lock()
+	defer r.reconcileLock.Unlock()
+
+	r.seedGlobalSidecarReady(ctx)
+
+	if r.globalSidecarReady[req.Namespace] == ready {
+		return reconcile.Result{}, nil
+	}
+	log.Infof("global-sidecar in namespace %s becomes ready: %v, refresh sidecars", req.Namespace, ready)
+	if ready {
+		r.globalSidecarReady[req.Namespace] = true
+	} else {
+		delete(r.globalSidecarReady, req.Namespace)
+	}
+
+	sfs := &lazyloadv1alpha1.ServiceFenceList{}
+	if err := r.Client.List(ctx, sfs, client.InNamespace(req.Namespace)); err != nil {
+		log.Errorf("list servicefences in %s failed, %+v", req.Namespace, err)
+		return reconcile.Result{}, err
+	}
+	for i := range sfs.Items {
+		sf := &sfs.Items[i]
+		if !sf.Spec.Enable {
+			continue
+		}
+		if err := r.refreshSidecar(sf); err != nil {
+			log.Errorf("refresh sidecar %s/%s met err: %v", sf.Namespace, sf.Name, err)
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// syncNamespaceGlobalSidecar renders the global-sidecar of a fenced namespace, and removes the rendered one
+// once the namespace is unfenced. Caller should hold the reconcile lock.
+func (r *ServicefenceReconciler) syncNamespaceGlobalSidecar(ctx context.Context, ns string, fenced bool) error {
+	r.globalSidecarLock.Lock()
+	defer r.globalSidecarLock.Unlock()
+	if fenced {
+		return r.reconcileGlobalSidecarTarget(ctx, namespaceGlobalSidecarTarget(ns))
+	}
+	return r.removeGlobalSidecar(ctx, func(itemNs string, _ bool) bool {
+		return itemNs != ns
+	}, client.InNamespace(ns))
+}
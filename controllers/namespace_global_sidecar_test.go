@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func readyGlobalSidecar(ns string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      GlobalSidecarName,
+			Labels:    map[string]string{"app": GlobalSidecarName, LabelCreatedBy: CreatedByFenceController},
+		},
+		Status: appsv1.DeploymentStatus{AvailableReplicas: 1},
+	}
+}
+
+// listRecorder records the options of lists
+type listRecorder struct {
+	client.Reader
+	lists []*client.ListOptions
+}
+
+func (r *listRecorder) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	r.lists = append(r.lists, (&client.ListOptions{}).ApplyOptions(opts))
+	return r.Reader.List(ctx, list, opts...)
+}
+
+// sidecarHosts returns the egress hosts of the sidecar generated for sf
+func sidecarHosts(t *testing.T, r *ServicefenceReconciler, sf *lazyloadv1alpha1.ServiceFence) map[string]bool {
+	t.Helper()
+	sidecar, err := r.newSidecar(sf, r.env)
+	if err != nil || sidecar == nil {
+		t.Fatalf("newSidecar = %v, %v", sidecar, err)
+	}
+	ret := map[string]bool{}
+	for _, h := range sidecar.Spec["egress"].([]interface{})[0].(map[string]interface{})["hosts"].([]interface{}) {
+		ret[h.(string)] = true
+	}
+	return ret
+}
+
+func TestNewSidecarReferencesGlobalSidecar(t *testing.T) {
+	const host = "*/global-sidecar.default.svc.cluster.local"
+	cases := []struct {
+		name string
+		mode string
+		// render makes global-sidecar managed by controller in namespace mode
+		render bool
+		objs   []runtime.Object
+		want   bool
+	}{
+		{name: "cluster mode", mode: GlobalSidecarModeCluster, want: false},
+		{name: "deployed by others", mode: GlobalSidecarModeNamespace, want: true},
+		{name: "managed and not ready", mode: GlobalSidecarModeNamespace, render: true, want: false},
+		{
+			name: "managed and ready before the first reconcile", mode: GlobalSidecarModeNamespace, render: true,
+			objs: []runtime.Object{readyGlobalSidecar("default")}, want: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := &lazyloadv1alpha1.Fence{
+				GlobalSidecarMode: c.mode,
+				GlobalSidecar:     &lazyloadv1alpha1.GlobalSidecar{Render: c.render, Image: "global-sidecar:v1"},
+			}
+			r := newTestReconciler(t, cfg, append(c.objs, testService("default", "reviews"))...)
+			sf := testFence("default", "reviews")
+			sf.Spec.Enable = true
+			if got := sidecarHosts(t, r, sf)[host]; got != c.want {
+				t.Errorf("sidecar references global-sidecar: %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestReconcileGlobalSidecarDeploymentTracksReadiness(t *testing.T) {
+	cfg := &lazyloadv1alpha1.Fence{
+		GlobalSidecarMode: GlobalSidecarModeNamespace,
+		GlobalSidecar:     &lazyloadv1alpha1.GlobalSidecar{Render: true, Image: "global-sidecar:v1"},
+	}
+	deploy := readyGlobalSidecar("default")
+	deploy.Status.AvailableReplicas = 0
+	r := newTestReconciler(t, cfg, deploy)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: GlobalSidecarName}}
+
+	if _, err := r.ReconcileGlobalSidecarDeployment(req); err != nil {
+		t.Fatal(err)
+	}
+	if r.isGlobalSidecarReady("default") {
+		t.Errorf("global-sidecar without available replicas is ready")
+	}
+
+	deploy = &appsv1.Deployment{}
+	if err := r.Client.Get(context.TODO(), req.NamespacedName, deploy); err != nil {
+		t.Fatal(err)
+	}
+	deploy.Status.AvailableReplicas = 1
+	if err := r.Client.Update(context.TODO(), deploy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReconcileGlobalSidecarDeployment(req); err != nil {
+		t.Fatal(err)
+	}
+	if !r.isGlobalSidecarReady("default") {
+		t.Errorf("global-sidecar with available replicas is not ready")
+	}
+
+	if err := r.Client.Delete(context.TODO(), deploy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReconcileGlobalSidecarDeployment(req); err != nil {
+		t.Fatal(err)
+	}
+	if r.isGlobalSidecarReady("default") {
+		t.Errorf("deleted global-sidecar is ready")
+	}
+}
+
+func TestSeedGlobalSidecarReadyListsRendered(t *testing.T) {
+	cfg := &lazyloadv1alpha1.Fence{
+		Namespace:         []string{"default", "other"},
+		GlobalSidecarMode: GlobalSidecarModeNamespace,
+		GlobalSidecar:     &lazyloadv1alpha1.GlobalSidecar{Render: true, Image: "global-sidecar:v1"},
+	}
+	// installed by others
+	unmanaged := readyGlobalSidecar("other")
+	unmanaged.Labels = nil
+	r := newTestReconciler(t, cfg, readyGlobalSidecar("default"), unmanaged)
+	reader := &listRecorder{Reader: r.Client}
+	r.reader = reader
+
+	if !r.isGlobalSidecarReady("default") || r.isGlobalSidecarReady("other") {
+		t.Errorf("got ready global-sidecars %v, want the rendered one of default only", r.globalSidecarReady)
+	}
+	if len(reader.lists) != 1 || reader.lists[0].LabelSelector == nil {
+		t.Errorf("got lists %+v, want deployments selected by label", reader.lists)
+	}
+}
+
+func TestReconcileNamespaceManagesGlobalSidecar(t *testing.T) {
+	cfg := &lazyloadv1alpha1.Fence{
+		AutoFence:         true,
+		GlobalSidecarMode: GlobalSidecarModeNamespace,
+		WormholePort:      []string{"9080"},
+		GlobalSidecar:     &lazyloadv1alpha1.GlobalSidecar{Render: true, Image: "global-sidecar:v1", Replicas: 2},
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "default",
+		Labels: map[string]string{LabelServiceFenced: ServiceFencedTrue},
+	}}
+	r := newTestReconciler(t, cfg, ns)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "default"}}
+	key := types.NamespacedName{Namespace: "default", Name: GlobalSidecarName}
+
+	if _, err := r.ReconcileNamespace(req); err != nil {
+		t.Fatal(err)
+	}
+	deploy := &appsv1.Deployment{}
+	if err := r.Client.Get(context.TODO(), key, deploy); err != nil {
+		t.Fatalf("global-sidecar of fenced namespace is not created, %v", err)
+	}
+	if *deploy.Spec.Replicas != 2 || deploy.Labels[LabelCreatedBy] != CreatedByFenceController {
+		t.Errorf("unexpected global-sidecar deployment %+v", deploy.ObjectMeta)
+	}
+
+	ns = &corev1.Namespace{}
+	if err := r.Client.Get(context.TODO(), req.NamespacedName, ns); err != nil {
+		t.Fatal(err)
+	}
+	ns.Labels[LabelServiceFenced] = ServiceFencedFalse
+	if err := r.Client.Update(context.TODO(), ns); err != nil {
+		t.Fatal(err)
+	}
+	// rendered in another fenced namespace
+	other := readyGlobalSidecar("other")
+	if err := r.Client.Create(context.TODO(), other); err != nil {
+		t.Fatal(err)
+	}
+	reader := &listRecorder{Reader: r.Client}
+	r.reader = reader
+	if _, err := r.ReconcileNamespace(req); err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []runtime.Object{&appsv1.Deployment{}, &corev1.Service{}, &corev1.ServiceAccount{}} {
+		if err := r.Client.Get(context.TODO(), key, obj); err == nil {
+			t.Errorf("%T of unfenced namespace is not removed", obj)
+		}
+	}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "other", Name: GlobalSidecarName}, &appsv1.Deployment{}); err != nil {
+		t.Errorf("global-sidecar of other namespace is removed, %v", err)
+	}
+	for _, lo := range reader.lists {
+		if lo.Namespace != "default" {
+			t.Errorf("got list %+v of all namespaces to clean up namespace default", lo)
+		}
+	}
+}
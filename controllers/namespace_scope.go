@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// namespaceScope decides which namespaces are managed by the module according to Fence.Namespace.
+// Items are glob patterns like "ns-*", items prefixed with "!" exclude the matched namespaces.
+// An empty include list means all namespaces.
+type namespaceScope struct {
+	includes []string
+	excludes []string
+}
+
+// parseNamespacePattern parses an item of Fence.Namespace
+func parseNamespacePattern(item string) (pattern string, exclude bool, err error) {
+	exclude = strings.HasPrefix(item, "!")
+	pattern = strings.TrimPrefix(item, "!")
+	if pattern == "" {
+		return "", false, fmt.Errorf("invalid namespace %q, the pattern is empty", item)
+	}
+	if _, err = path.Match(pattern, ""); err != nil {
+		return "", false, fmt.Errorf("invalid namespace %q, %v", item, err)
+	}
+	return pattern, exclude, nil
+}
+
+// newNamespaceScope builds the scope from Fence.Namespace, which is validated by ResolveFenceConfig
+func newNamespaceScope(patterns []string) *namespaceScope {
+	s := &namespaceScope{}
+	for _, item := range patterns {
+		p, exclude, err := parseNamespacePattern(item)
+		if err != nil {
+			log.Errorf("%v, skip it", err)
+			continue
+		}
+		if exclude {
+			s.excludes = append(s.excludes, p)
+		} else {
+			s.includes = append(s.includes, p)
+		}
+	}
+	return s
+}
+
+func matchAny(patterns []string, ns string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, ns); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns whether fences in ns are managed
+func (s *namespaceScope) contains(ns string) bool {
+	if matchAny(s.excludes, ns) {
+		return false
+	}
+	return len(s.includes) == 0 || matchAny(s.includes, ns)
+}
+
+// literalIncludes returns the included namespaces which are not patterns
+func (s *namespaceScope) literalIncludes() []string {
+	var ret []string
+	for _, p := range s.includes {
+		if !strings.ContainsAny(p, `*?[\`) && !matchAny(s.excludes, p) {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// scopedNamespaces returns the namespaces in scope, including the literal ones and the ones with services
+// matching the patterns. Nothing is returned if Fence.Namespace has no include item.
+func (r *ServicefenceReconciler) scopedNamespaces() []string {
+	if len(r.nsScope.includes) == 0 {
+		return nil
+	}
+
+	set := map[string]bool{}
+	for _, ns := range r.nsScope.literalIncludes() {
+		set[ns] = true
+	}
+	r.nsSvcCache.RLock()
+	for ns := range r.nsSvcCache.Data {
+		if r.nsScope.contains(ns) {
+			set[ns] = true
+		}
+	}
+	r.nsSvcCache.RUnlock()
+
+	ret := make([]string, 0, len(set))
+	for ns := range set {
+		ret = append(ret, ns)
+	}
+	sort.Strings(ret)
+	return ret
+}
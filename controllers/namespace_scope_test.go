@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func TestNamespaceScope(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns []string
+		in       []string
+		out      []string
+		literal  []string
+	}{
+		{name: "empty means all", in: []string{"default", "ns-a"}},
+		{
+			name:     "literal and glob",
+			patterns: []string{"default", "ns-*"},
+			in:       []string{"default", "ns-a"},
+			out:      []string{"other", "ns"},
+			literal:  []string{"default"},
+		},
+		{
+			name:     "excludes win",
+			patterns: []string{"ns-*", "default", "!ns-test-*", "!default"},
+			in:       []string{"ns-a"},
+			out:      []string{"ns-test-a", "default"},
+		},
+		{
+			name:     "only excludes",
+			patterns: []string{"!kube-*"},
+			in:       []string{"default"},
+			out:      []string{"kube-system"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newNamespaceScope(c.patterns)
+			for _, ns := range c.in {
+				if !s.contains(ns) {
+					t.Errorf("%s is not in scope %v", ns, c.patterns)
+				}
+			}
+			for _, ns := range c.out {
+				if s.contains(ns) {
+					t.Errorf("%s is in scope %v", ns, c.patterns)
+				}
+			}
+			if got := s.literalIncludes(); !reflect.DeepEqual(got, c.literal) {
+				t.Errorf("literalIncludes() = %v, want %v", got, c.literal)
+			}
+		})
+	}
+}
+
+func TestResolveFenceConfigRejectsNamespacePatterns(t *testing.T) {
+	for _, item := range []string{"", "!", "ns-[", "!ns-["} {
+		cfg := &lazyloadv1alpha1.Fence{
+			Namespace:    []string{"default", item},
+			MetricSource: &lazyloadv1alpha1.MetricSource{Types: []string{MetricSourceTypeAccesslog}},
+		}
+		err := ResolveFenceConfig(cfg, nil)
+		if err == nil || !strings.Contains(err.Error(), "invalid namespace") {
+			t.Errorf("namespace %q: err = %v, want invalid namespace", item, err)
+		}
+	}
+}
+
+func TestPrepareDestFenceInScope(t *testing.T) {
+	r := newTestReconciler(t, &lazyloadv1alpha1.Fence{Namespace: []string{"default"}},
+		testService("default", "details"), testService("other", "details"))
+	src := testFence("default", "reviews")
+
+	if sf := r.prepareDestFence(src, "details.other.svc.cluster.local"); sf != nil {
+		t.Errorf("fence out of scope is prepared, got %+v", sf)
+	}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "other", Name: "details"}, &lazyloadv1alpha1.ServiceFence{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("fence out of scope is created, err %v", err)
+	}
+	if sf := r.prepareDestFence(src, "details.default.svc.cluster.local"); sf == nil {
+		t.Errorf("fence in scope is not prepared")
+	}
+}
+
+func TestReconcileGlobalSidecarDeploymentInScope(t *testing.T) {
+	cfg := &lazyloadv1alpha1.Fence{
+		Namespace:         []string{"default"},
+		GlobalSidecarMode: GlobalSidecarModeNamespace,
+		GlobalSidecar:     &lazyloadv1alpha1.GlobalSidecar{Render: true, Image: "global-sidecar:v1"},
+	}
+	r := newTestReconciler(t, cfg, readyGlobalSidecar("other"), readyGlobalSidecar("default"))
+	for _, ns := range []string{"other", "default"} {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: ns, Name: GlobalSidecarName}}
+		if _, err := r.ReconcileGlobalSidecarDeployment(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.globalSidecarReady["other"] || !r.globalSidecarReady["default"] {
+		t.Errorf("only global-sidecar in scope should be tracked, got %v", r.globalSidecarReady)
+	}
+}
+
+func TestAddDependenciesInScope(t *testing.T) {
+	sf := testFence("other", "reviews")
+	r := newTestReconciler(t, &lazyloadv1alpha1.Fence{Namespace: []string{"default"}}, sf)
+	nn := types.NamespacedName{Namespace: "other", Name: "reviews"}
+	if err := r.addDependencies(nn, map[string]struct{}{"details.other.svc.cluster.local": {}}); err != nil {
+		t.Fatal(err)
+	}
+	got := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), nn, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.MetricDependencies) != 0 {
+		t.Errorf("dependencies are added to fence out of scope, got %v", got.Status.MetricDependencies)
+	}
+}
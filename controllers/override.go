@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"slime.io/slime/framework/model"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// AnnotationLazyloadOverride is set on namespace or servicefence to override module options,
+// the value is a json object of fenceOverride
+const AnnotationLazyloadOverride = "slime.io/lazyloadOverride"
+
+// fenceOverride holds the module options that can be overridden per namespace or per fence.
+// Fields set replace the module ones, unset fields are inherited.
+type fenceOverride struct {
+	// only applies to namespace
+	DefaultFence *bool `json:"defaultFence,omitempty"`
+	// only applies to namespace, used by the namespace global-sidecar
+	WormholePort  []string                        `json:"wormholePort,omitempty"`
+	DomainAliases []*lazyloadv1alpha1.DomainAlias `json:"domainAliases,omitempty"`
+	// metric sources queried for the fences, a subset of MetricSource.Types of the module.
+	// Empty list stops querying metrics.
+	MetricSourceTypes []string `json:"metricSourceTypes,omitempty"`
+}
+
+type parsedOverride struct {
+	fenceOverride
+	aliasRules []*domainAliasRule
+}
+
+func parseOverride(raw string) *parsedOverride {
+	o := &parsedOverride{}
+	if err := json.Unmarshal([]byte(raw), &o.fenceOverride); err != nil {
+		log.Errorf("invalid %s annotation %s, ignore it, %+v", AnnotationLazyloadOverride, raw, err)
+		return nil
+	}
+	if o.DomainAliases != nil {
+		o.aliasRules = newDomainAliasRules(o.DomainAliases)
+	}
+	for _, t := range o.MetricSourceTypes {
+		if t != MetricSourceTypePrometheus && t != MetricSourceTypeAccesslog {
+			log.Warningf("unknown metric source type %q in %s annotation %s, ignore it", t, AnnotationLazyloadOverride, raw)
+		}
+	}
+	return o
+}
+
+type cachedOverride struct {
+	raw    string
+	parsed *parsedOverride
+}
+
+// overrideCache caches the parsed overrides of namespaces by name and of fences by namespace/name,
+// so that alias patterns are compiled once per annotation change
+type overrideCache struct {
+	data map[string]cachedOverride
+	sync.Mutex
+}
+
+// set caches the override of key parsed from raw, which is reused until raw changes. Empty raw removes it.
+// It returns true if raw changes.
+func (c *overrideCache) set(key, raw string) bool {
+	c.Lock()
+	defer c.Unlock()
+	cached, ok := c.data[key]
+	if ok && cached.raw == raw {
+		return false
+	}
+	if raw == "" {
+		delete(c.data, key)
+		return ok
+	}
+	if c.data == nil {
+		c.data = map[string]cachedOverride{}
+	}
+	c.data[key] = cachedOverride{raw: raw, parsed: parseOverride(raw)}
+	return true
+}
+
+// parse returns the cached override of key if raw is the cached one, otherwise parses raw without caching it
+func (c *overrideCache) parse(key, raw string) *parsedOverride {
+	if raw == "" {
+		return nil
+	}
+	c.Lock()
+	cached, ok := c.data[key]
+	c.Unlock()
+	if ok && cached.raw == raw {
+		return cached.parsed
+	}
+	return parseOverride(raw)
+}
+
+// get returns the cached override of key, nil if none or invalid
+func (c *overrideCache) get(key string) *parsedOverride {
+	c.Lock()
+	defer c.Unlock()
+	return c.data[key].parsed
+}
+
+// fenceSettings is the effective options of fences in a namespace or of a single fence
+type fenceSettings struct {
+	defaultFence      bool
+	wormholePort      []string
+	aliasRules        []*domainAliasRule
+	metricSourceTypes []string
+}
+
+func (r *ServicefenceReconciler) defaultFenceSettings() fenceSettings {
+	return fenceSettings{
+		defaultFence:      r.cfg.DefaultFence,
+		wormholePort:      r.cfg.WormholePort,
+		aliasRules:        r.doAliasRules,
+		metricSourceTypes: r.cfg.GetMetricSource().GetTypes(),
+	}
+}
+
+func (s fenceSettings) merge(o *parsedOverride, isNs bool) fenceSettings {
+	if o == nil {
+		return s
+	}
+	if isNs {
+		if o.DefaultFence != nil {
+			s.defaultFence = *o.DefaultFence
+		}
+		if o.WormholePort != nil {
+			s.wormholePort = o.WormholePort
+		}
+	}
+	if o.DomainAliases != nil {
+		s.aliasRules = o.aliasRules
+	}
+	if o.MetricSourceTypes != nil {
+		s.metricSourceTypes = o.MetricSourceTypes
+	}
+	return s
+}
+
+// usesMetricSource returns whether metrics of source type t are queried
+func (s fenceSettings) usesMetricSource(t string) bool {
+	for _, item := range s.metricSourceTypes {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+// nsSettings merges the override of namespace object with module options
+func (r *ServicefenceReconciler) nsSettings(ns *corev1.Namespace) fenceSettings {
+	s := r.defaultFenceSettings()
+	if ns == nil {
+		return s
+	}
+	return s.merge(r.overrides.parse(ns.Name, ns.Annotations[AnnotationLazyloadOverride]), true)
+}
+
+// nsSettingsByName is like nsSettings but uses the cached override of namespace, see ReconcileNamespaceOverride
+func (r *ServicefenceReconciler) nsSettingsByName(name string) fenceSettings {
+	return r.defaultFenceSettings().merge(r.overrides.get(name), true)
+}
+
+// fenceSettings merges module options, the override of namespace and the override of sf in order,
+// and caches the override of sf
+func (r *ServicefenceReconciler) fenceSettings(sf *lazyloadv1alpha1.ServiceFence) fenceSettings {
+	key := types.NamespacedName{Namespace: sf.Namespace, Name: sf.Name}.String()
+	r.overrides.set(key, sf.Annotations[AnnotationLazyloadOverride])
+	return r.nsSettingsByName(sf.Namespace).merge(r.overrides.get(key), false)
+}
+
+// fenceSettingsByName is like fenceSettings but uses the cached override of the fence
+func (r *ServicefenceReconciler) fenceSettingsByName(nn types.NamespacedName) fenceSettings {
+	return r.nsSettingsByName(nn.Namespace).merge(r.overrides.get(nn.String()), false)
+}
+
+// forgetFenceOverride drops the cached override of a deleted fence
+func (r *ServicefenceReconciler) forgetFenceOverride(nn types.NamespacedName) {
+	r.overrides.set(nn.String(), "")
+}
+
+// ReconcileNamespaceOverride caches the override annotation of namespace, and refreshes the fences of
+// the namespace once it changes
+func (r *ServicefenceReconciler) ReconcileNamespaceOverride(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.TODO()
+	ns := &corev1.Namespace{}
+	raw := ""
+	if err := r.Client.Get(ctx, req.NamespacedName, ns); err != nil {
+		if !errors.IsNotFound(err) {
+			log.Errorf("get namespace %s error, %+v", req.Name, err)
+			return reconcile.Result{}, err
+		}
+	} else {
+		raw = ns.Annotations[AnnotationLazyloadOverride]
+	}
+
+	r.reconcileLock.Lock()
+	defer r.reconcileLock.Unlock()
+
+	if !r.overrides.set(req.Name, raw) || !r.nsScope.contains(req.Name) {
+		return reconcile.Result{}, nil
+	}
+	log.Infof("override of namespace %s changes, refresh its servicefences", req.Name)
+	sfs := &lazyloadv1alpha1.ServiceFenceList{}
+	if err := r.Client.List(ctx, sfs, client.InNamespace(req.Name)); err != nil {
+		log.Errorf("list servicefences in %s failed, %+v", req.Name, err)
+		return reconcile.Result{}, err
+	}
+	for i := range sfs.Items {
+		sf := &sfs.Items[i]
+		if rev := model.IstioRevFromLabel(sf.Labels); !r.env.RevInScope(rev) {
+			continue
+		}
+		diff := r.updateVisitedHostStatus(sf)
+		r.recordVisitor(sf, diff)
+		if sf.Spec.Enable {
+			if err := r.refreshSidecar(sf); err != nil {
+				log.Errorf("refresh sidecar %s/%s met err: %v", sf.Namespace, sf.Name, err)
+			}
+		}
+	}
+	return reconcile.Result{}, nil
+}
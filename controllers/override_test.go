@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"slime.io/slime/framework/apis/config/v1alpha1"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func TestOverrideCache(t *testing.T) {
+	const aliases = `{"domainAliases": [{"pattern": "(?P<service>[^\\.]+)\\.svc$", "templates": ["$service.alias"]}]}`
+	c := &overrideCache{}
+
+	if !c.set("default", aliases) {
+		t.Errorf("set a new override returns false")
+	}
+	parsed := c.get("default")
+	if parsed == nil || len(parsed.aliasRules) != 1 {
+		t.Fatalf("override is not parsed, got %+v", parsed)
+	}
+	if c.set("default", aliases) || c.get("default") != parsed {
+		t.Errorf("unchanged override is parsed again")
+	}
+	if c.parse("default", aliases) != parsed {
+		t.Errorf("parse does not reuse the cached override")
+	}
+	if c.parse("default", `{"defaultFence": true}`) == parsed || c.get("default") != parsed {
+		t.Errorf("parse of another value should not touch the cache")
+	}
+
+	if !c.set("default", "{invalid") || c.get("default") != nil {
+		t.Errorf("invalid override should be cached as nil")
+	}
+	if !c.set("default", "") || len(c.data) != 0 {
+		t.Errorf("empty override is not evicted, cache %v", c.data)
+	}
+	if c.set("default", "") {
+		t.Errorf("removing an absent override returns true")
+	}
+}
+
+func TestFenceSettingsMerge(t *testing.T) {
+	r := newTestReconciler(t, &lazyloadv1alpha1.Fence{WormholePort: []string{"9080"}})
+	r.overrides.set("default", `{"defaultFence": true, "wormholePort": ["80"], "metricSourceTypes": ["accesslog"]}`)
+	sf := testFence("default", "reviews")
+
+	got := r.fenceSettings(sf)
+	if !got.defaultFence || !reflect.DeepEqual(got.wormholePort, []string{"80"}) ||
+		!reflect.DeepEqual(got.metricSourceTypes, []string{MetricSourceTypeAccesslog}) {
+		t.Errorf("namespace override is not merged, got %+v", got)
+	}
+
+	// options only for namespace are ignored on fence
+	sf.Annotations = map[string]string{AnnotationLazyloadOverride: `{"defaultFence": false, "wormholePort": ["81"], "metricSourceTypes": []}`}
+	got = r.fenceSettings(sf)
+	if !got.defaultFence || !reflect.DeepEqual(got.wormholePort, []string{"80"}) || got.usesMetricSource(MetricSourceTypeAccesslog) {
+		t.Errorf("fence override is not merged over the namespace one, got %+v", got)
+	}
+	if got := r.fenceSettingsByName(types.NamespacedName{Namespace: "default", Name: "reviews"}); got.metricSourceTypes == nil ||
+		len(got.metricSourceTypes) != 0 {
+		t.Errorf("fence override is not cached, got %+v", got)
+	}
+
+	r.forgetFenceOverride(types.NamespacedName{Namespace: "default", Name: "reviews"})
+	if got := r.fenceSettingsByName(types.NamespacedName{Namespace: "default", Name: "reviews"}); !got.usesMetricSource(MetricSourceTypeAccesslog) {
+		t.Errorf("override of deleted fence is not forgotten, got %+v", got)
+	}
+	if got := r.nsSettingsByName("other"); got.defaultFence || !reflect.DeepEqual(got.wormholePort, []string{"9080"}) {
+		t.Errorf("module options are not inherited, got %+v", got)
+	}
+}
+
+func TestMetricHandlersFollowOverride(t *testing.T) {
+	r := newTestReconciler(t, nil)
+	r.cfg.MetricSource.Types = []string{MetricSourceTypePrometheus, MetricSourceTypeAccesslog}
+	r.env.Config.Metric = &v1alpha1.Metric{Prometheus: &v1alpha1.Prometheus_Source{
+		Handlers: map[string]*v1alpha1.Prometheus_Source_Handler{
+			"destination": {Query: `sum(istio_requests_total{source_app="$source_app"})by(destination_service)`},
+		},
+	}}
+	handlerNames := func() []string {
+		var ret []string
+		for _, h := range r.metricHandlers("reviews", "default") {
+			ret = append(ret, h.Name)
+		}
+		return ret
+	}
+
+	if got := handlerNames(); !reflect.DeepEqual(got, []string{"destination", AccessLogConvertorName}) {
+		t.Errorf("handlers without override = %v", got)
+	}
+	r.overrides.set("default", `{"metricSourceTypes": ["accesslog"]}`)
+	if got := handlerNames(); !reflect.DeepEqual(got, []string{AccessLogConvertorName}) {
+		t.Errorf("handlers with namespace override = %v", got)
+	}
+	r.overrides.set("default/reviews", `{"metricSourceTypes": ["prometheus", "unknown"]}`)
+	if got := handlerNames(); !reflect.DeepEqual(got, []string{"destination"}) {
+		t.Errorf("handlers with fence override = %v", got)
+	}
+}
+
+func TestReconcileNamespaceOverrideRefreshesFences(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	sf := testFence("default", "reviews")
+	sf.Status.MetricDependencies = []*lazyloadv1alpha1.MetricDependency{{Host: "details.default.svc.cluster.local"}}
+	r := newTestReconciler(t, nil, ns, sf)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "default"}}
+	key := types.NamespacedName{Namespace: "default", Name: "reviews"}
+	const alias = "details.default.alias"
+
+	domains := func() map[string]*lazyloadv1alpha1.Destinations {
+		got := &lazyloadv1alpha1.ServiceFence{}
+		if err := r.Client.Get(context.TODO(), key, got); err != nil {
+			t.Fatal(err)
+		}
+		return got.Status.Domains
+	}
+
+	if _, err := r.ReconcileNamespaceOverride(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := domains()[alias]; ok {
+		t.Fatalf("alias domain exists without override")
+	}
+
+	ns = &corev1.Namespace{}
+	if err := r.Client.Get(context.TODO(), req.NamespacedName, ns); err != nil {
+		t.Fatal(err)
+	}
+	ns.Annotations = map[string]string{AnnotationLazyloadOverride: `{"domainAliases": [{"pattern": ` +
+		`"(?P<service>[^\\.]+)\\.(?P<namespace>[^\\.]+)\\.svc\\.cluster\\.local$", "templates": ["$service.$namespace.alias"]}]}`}
+	if err := r.Client.Update(context.TODO(), ns); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReconcileNamespaceOverride(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := domains()[alias]; !ok {
+		t.Errorf("fence is not refreshed after namespace override changes, domains %v", domains())
+	}
+
+	if err := r.Client.Delete(context.TODO(), ns); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReconcileNamespaceOverride(req); err != nil {
+		t.Fatal(err)
+	}
+	if r.overrides.get("default") != nil {
+		t.Errorf("override of deleted namespace is not evicted")
+	}
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"context"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -52,18 +53,19 @@ func (r *ServicefenceReconciler) ConsumeMetric(metric metric.Metric) {
 		log.Debugf("got metric for %s", meta)
 		namespace, name := strings.Split(meta, "/")[0], strings.Split(meta, "/")[1]
 		nn := types.NamespacedName{Namespace: namespace, Name: name}
-		if len(results) != 1 {
+		if len(results) == 0 {
 			log.Errorf("wrong metric results length for %s", meta)
 			continue
 		}
-		value := results[0].Value
-		if _, err := r.Refresh(reconcile.Request{NamespacedName: nn}, value); err != nil {
+		// results of all handlers and sources are merged
+		deps := newMetricDependencies(results)
+		if _, err := r.Refresh(reconcile.Request{NamespacedName: nn}, deps); err != nil {
 			log.Errorf("refresh error:%v", err)
 		}
 	}
 }
 
-func (r *ServicefenceReconciler) Refresh(req reconcile.Request, value map[string]string) (reconcile.Result, error) {
+func (r *ServicefenceReconciler) Refresh(req reconcile.Request, deps []*lazyloadv1alpha1.MetricDependency) (reconcile.Result, error) {
 	log := log.WithField("reporter", "ServicefenceReconciler").WithField("function", "Refresh")
 
 	r.reconcileLock.Lock()
@@ -84,6 +86,9 @@ func (r *ServicefenceReconciler) Refresh(req reconcile.Request, value map[string
 	if sf == nil {
 		log.Info("ServiceFence Not Found, skip")
 		return reconcile.Result{}, nil
+	} else if !r.nsScope.contains(sf.Namespace) {
+		log.Debugf("namespace of sf %v is not in scope, skip", req.NamespacedName)
+		return reconcile.Result{}, nil
 	} else if rev := model.IstioRevFromLabel(sf.Labels); !r.env.RevInScope(rev) {
 		log.Infof("existing sf %v istioRev %s but our %s, skip ...",
 			req.NamespacedName, rev, r.env.IstioRev())
@@ -91,7 +96,8 @@ func (r *ServicefenceReconciler) Refresh(req reconcile.Request, value map[string
 	}
 
 	// use updateVisitedHostStatus to update svf.spec and svf.status
-	sf.Status.MetricStatus = value
+	changed := r.setFenceMetricDependencies(sf, deps)
+	r.refreshScheduler.observe(req.NamespacedName.String(), changed, time.Now())
 	diff := r.updateVisitedHostStatus(sf)
 	r.recordVisitor(sf, diff)
 
@@ -114,7 +120,7 @@ func (r *ServicefenceReconciler) isNsFenced(ns *corev1.Namespace) bool {
 			return false
 		}
 	}
-	return r.cfg.DefaultFence
+	return r.nsSettings(ns).defaultFence
 }
 
 func (r *ServicefenceReconciler) isServiceFenced(ctx context.Context, svc *corev1.Service) bool {
@@ -171,6 +177,10 @@ func (r *ServicefenceReconciler) ReconcileNamespace(req ctrl.Request) (ret ctrl.
 		log.Debugf("auto fence does not apply to istio and slime namespace, skip")
 		return reconcile.Result{}, nil
 	}
+	if !r.nsScope.contains(req.Name) {
+		log.Debugf("namespace %s is not in scope, skip", req.Name)
+		return reconcile.Result{}, nil
+	}
 
 	r.reconcileLock.Lock()
 	defer r.reconcileLock.Unlock()
@@ -194,6 +204,13 @@ func (r *ServicefenceReconciler) ReconcileNamespace(req ctrl.Request) (ret ctrl.
 
 	nsFenced := r.isNsFenced(ns)
 
+	if r.namespaceGlobalSidecarManaged() {
+		if err = r.syncNamespaceGlobalSidecar(ctx, req.Name, nsFenced); err != nil {
+			log.Errorf("sync global-sidecar of namespace %s failed, %+v", req.Name, err)
+			return reconcile.Result{}, err
+		}
+	}
+
 	if nsFenced == r.enabledNamespaces[req.Name] {
 		return reconcile.Result{}, nil
 	} else {
@@ -226,6 +243,14 @@ func (r *ServicefenceReconciler) ReconcileNamespace(req ctrl.Request) (ret ctrl.
 
 // refreshFenceStatusOfService caller should hold the reconcile lock.
 func (r *ServicefenceReconciler) refreshFenceStatusOfService(ctx context.Context, svc *corev1.Service, nsName types.NamespacedName) (reconcile.Result, error) {
+	if svc != nil {
+		nsName.Namespace = svc.Namespace
+	}
+	if !r.nsScope.contains(nsName.Namespace) {
+		log.Debugf("namespace of service %v is not in scope, skip", nsName)
+		return reconcile.Result{}, nil
+	}
+
 	if svc == nil {
 		// Fetch the Service instance
 		svc = &corev1.Service{}
@@ -4,6 +4,7 @@ import (
 	"context"
 	stderrors "errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,9 +16,9 @@ import (
 	prometheusV1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -56,20 +57,7 @@ func (r *ServicefenceReconciler) handleWatcherEvent(event trigger.WatcherEvent)
 	qm := make(map[string][]metric.Handler)
 	var hs []metric.Handler
 
-	// check metric source type
-	switch r.env.Config.Global.Misc["metricSourceType"] {
-	case MetricSourceTypePrometheus:
-		for pName, pHandler := range r.env.Config.Metric.Prometheus.Handlers {
-			hs = append(hs, generateHandler(event.NN.Name, event.NN.Namespace, pName, pHandler))
-		}
-	case MetricSourceTypeAccesslog:
-		hs = []metric.Handler{
-			{
-				Name:  AccessLogConvertorName,
-				Query: "",
-			},
-		}
-	}
+	hs = r.metricHandlers(event.NN.Name, event.NN.Namespace)
 
 	qm[event.NN.String()] = hs
 	return qm
@@ -77,97 +65,128 @@ func (r *ServicefenceReconciler) handleWatcherEvent(event trigger.WatcherEvent)
 
 // call back function for ticker producer
 func (r *ServicefenceReconciler) handleTickerEvent(event trigger.TickerEvent) metric.QueryMap {
-	// no need to check time duration
-
-	// generate query map for producer
-	// check metric source type
+	// generate query map for producer, fences not due yet are skipped in adaptive refresh
 	qm := make(map[string][]metric.Handler)
 
-	switch r.env.Config.Global.Misc["metricSourceType"] {
-	case MetricSourceTypePrometheus:
-		for meta := range r.getInterestMeta() {
-			namespace, name := strings.Split(meta, "/")[0], strings.Split(meta, "/")[1]
-			var hs []metric.Handler
-			for pName, pHandler := range r.env.Config.Metric.Prometheus.Handlers {
-				hs = append(hs, generateHandler(name, namespace, pName, pHandler))
-			}
-			qm[meta] = hs
-		}
-	case MetricSourceTypeAccesslog:
-		for meta := range r.getInterestMeta() {
-			qm[meta] = []metric.Handler{
-				{
-					Name:  AccessLogConvertorName,
-					Query: "",
-				},
-			}
+	now := time.Now()
+	for meta := range r.getInterestMeta() {
+		if !r.refreshScheduler.due(meta, now) {
+			continue
 		}
+		namespace, name := strings.Split(meta, "/")[0], strings.Split(meta, "/")[1]
+		qm[meta] = r.metricHandlers(name, namespace)
 	}
 
 	return qm
 }
 
+// metricHandlers returns handlers of the enabled metric sources used by the fence, see fenceOverride
+func (r *ServicefenceReconciler) metricHandlers(name, namespace string) []metric.Handler {
+	var hs []metric.Handler
+	settings := r.fenceSettingsByName(types.NamespacedName{Namespace: namespace, Name: name})
+	for _, t := range r.cfg.GetMetricSource().GetTypes() {
+		if !settings.usesMetricSource(t) {
+			continue
+		}
+		switch t {
+		case MetricSourceTypePrometheus:
+			for pName, pHandler := range r.env.Config.Metric.Prometheus.Handlers {
+				h, err := r.prometheusHandler(name, namespace, pName, pHandler)
+				if err != nil {
+					log.Errorf("render query of prometheus handler %s for %s/%s failed, skip it, %+v", pName, namespace, name, err)
+					continue
+				}
+				hs = append(hs, h)
+			}
+		case MetricSourceTypeAccesslog:
+			hs = append(hs, metric.Handler{
+				Name:  AccessLogConvertorName,
+				Query: "",
+			})
+		}
+	}
+	return hs
+}
+
 func generateHandler(name, namespace, pName string, pHandler *v1alpha1.Prometheus_Source_Handler) metric.Handler {
 	query := strings.ReplaceAll(pHandler.Query, "$namespace", namespace)
 	query = strings.ReplaceAll(query, "$source_app", name)
 	return metric.Handler{Name: pName, Query: query}
 }
 
-func newProducerConfig(env bootstrap.Environment) (*metric.ProducerConfig, error) {
-	// init metric source
-	var enablePrometheusSource bool
-	var prometheusSourceConfig metric.PrometheusSourceConfig
-	var accessLogSourceConfig metric.AccessLogSourceConfig
-	var err error
-
-	switch env.Config.Global.Misc["metricSourceType"] {
-	case MetricSourceTypePrometheus:
-		enablePrometheusSource = true
-		prometheusSourceConfig, err = newPrometheusSourceConfig(env)
-		if err != nil {
-			return nil, err
-		}
-	case MetricSourceTypeAccesslog:
-		enablePrometheusSource = false
-		// init log source port
-		port := env.Config.Global.Misc["logSourcePort"]
+func (r *ServicefenceReconciler) newProducerConfig() (*metric.ProducerConfig, metric.Source, error) {
+	env := r.env
 
-		// init initCache
-		initCache, err := newInitCache(env)
-		if err != nil {
-			return nil, err
-		}
-		log.Debugf("initCache is %+v", initCache)
+	// init metric sources
+	var sources []*namedSource
+	for _, t := range r.cfg.GetMetricSource().GetTypes() {
+		switch t {
+		case MetricSourceTypePrometheus:
+			prometheusSourceConfig, err := newPrometheusSourceConfig(env, r.cfg.MetricSource.GetPrometheusClient())
+			if err != nil {
+				return nil, nil, err
+			}
+			if r.queryTemplates, err = newQueryTemplates(env.Config.Metric.Prometheus.Handlers); err != nil {
+				return nil, nil, err
+			}
+			var source metric.Source = metric.NewPrometheusSource(prometheusSourceConfig)
+			if batch := r.cfg.MetricSource.GetPrometheusBatch(); batch.GetEnable() {
+				source = &batchPrometheusSource{
+					Source:  source,
+					api:     prometheusSourceConfig.Api,
+					queries: newBatchQueries(env.Config.Metric.Prometheus.Handlers, batch),
+				}
+			}
+			sources = append(sources, &namedSource{
+				name:   t,
+				Source: source,
+				handles: func(h metric.Handler) bool {
+					return h.Name != AccessLogConvertorName
+				},
+			})
+		case MetricSourceTypeAccesslog:
+			// init log source port
+			port := r.cfg.MetricSource.LogSourcePort
 
-		// make preparation for handler
-		ipToSvcCache, svcToIpsCache, cacheLock, err := newIpToSvcCache(env.K8SClient)
-		if err != nil {
-			return nil, err
-		}
+			// init initCache
+			initCache, err := newInitCache(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			log.Debugf("initCache is %+v", initCache)
 
-		// init accessLog source config
-		accessLogSourceConfig = metric.AccessLogSourceConfig{
-			ServePort: port,
-			AccessLogConvertorConfigs: []metric.AccessLogConvertorConfig{
-				{
-					Name: AccessLogConvertorName,
-					Handler: func(logEntry []*data_accesslog.HTTPAccessLogEntry) (map[string]map[string]string, error) {
-						return accessLogHandler(logEntry, ipToSvcCache, svcToIpsCache, cacheLock)
+			// make preparation for handler
+			ipToSvcCache, svcToIpsCache, cacheLock, err := r.getIpToSvcCache()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// init accessLog source config
+			accessLogSourceConfig := metric.AccessLogSourceConfig{
+				ServePort: port,
+				AccessLogConvertorConfigs: []metric.AccessLogConvertorConfig{
+					{
+						Name: AccessLogConvertorName,
+						Handler: func(logEntry []*data_accesslog.HTTPAccessLogEntry) (map[string]map[string]string, error) {
+							return accessLogHandler(logEntry, ipToSvcCache, svcToIpsCache, cacheLock)
+						},
+						InitCache: initCache,
 					},
-					InitCache: initCache,
 				},
-			},
+			}
+			sources = append(sources, &namedSource{
+				name:   t,
+				Source: metric.NewAccessLogSource(accessLogSourceConfig),
+				handles: func(h metric.Handler) bool {
+					return h.Name == AccessLogConvertorName
+				},
+			})
 		}
-	default:
-		return nil, stderrors.New("wrong metricSourceType")
 	}
 
 	// init whole producer config
 	pc := &metric.ProducerConfig{
-		EnablePrometheusSource: enablePrometheusSource,
-		PrometheusSourceConfig: prometheusSourceConfig,
-		AccessLogSourceConfig:  accessLogSourceConfig,
-		EnableWatcherProducer:  true,
+		EnableWatcherProducer: true,
 		WatcherProducerConfig: metric.WatcherProducerConfig{
 			Name:       "lazyload-watcher",
 			MetricChan: make(chan metric.Metric),
@@ -189,7 +208,7 @@ func newProducerConfig(env bootstrap.Environment) (*metric.ProducerConfig, error
 			MetricChan: make(chan metric.Metric),
 			TickerTriggerConfig: trigger.TickerTriggerConfig{
 				Durations: []time.Duration{
-					30 * time.Second,
+					r.refreshScheduler.min,
 				},
 				EventChan: make(chan trigger.TickerEvent),
 			},
@@ -197,17 +216,21 @@ func newProducerConfig(env bootstrap.Environment) (*metric.ProducerConfig, error
 		StopChan: env.Stop,
 	}
 
-	return pc, nil
+	return pc, newMultiSource(sources...), nil
 }
 
-func newPrometheusSourceConfig(env bootstrap.Environment) (metric.PrometheusSourceConfig, error) {
+func newPrometheusSourceConfig(env bootstrap.Environment, cfg *lazyloadapiv1alpha1.PrometheusClient) (metric.PrometheusSourceConfig, error) {
 	ps := env.Config.Metric.Prometheus
 	if ps == nil {
 		return metric.PrometheusSourceConfig{}, stderrors.New("failure create prometheus client, empty prometheus config")
 	}
+	rt, err := newPrometheusRoundTripper(cfg)
+	if err != nil {
+		return metric.PrometheusSourceConfig{}, err
+	}
 	promClient, err := prometheusApi.NewClient(prometheusApi.Config{
 		Address:      ps.Address,
-		RoundTripper: nil,
+		RoundTripper: rt,
 	})
 	if err != nil {
 		return metric.PrometheusSourceConfig{}, err
@@ -234,19 +257,16 @@ func newInitCache(env bootstrap.Environment) (map[string]map[string]string, erro
 	}
 	for _, svf := range svfList.Items {
 		meta := svf.GetNamespace() + "/" + svf.GetName()
-		value := make(map[string]string)
-		ms, existed, err := unstructured.NestedMap(svf.Object, "status", "metricStatus")
-		if err != nil {
-			log.Errorf("got servicefence %s status.metricStatus error: %v", meta, err)
+		sf := &lazyloadapiv1alpha1.ServiceFence{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(svf.Object, sf); err != nil {
+			log.Errorf("convert servicefence %s error: %v", meta, err)
 			continue
 		}
-		if existed {
-			for k, v := range ms {
-				ok := false
-				if value[k], ok = v.(string); !ok {
-					log.Errorf("servicefence %s metricStatus value is not string, value: %+v", meta, v)
-					continue
-				}
+		// counts of accesslog source are accumulated from the ones in status
+		value := make(map[string]string)
+		for _, dep := range fenceMetricDependencies(sf) {
+			if len(dep.Sources) == 0 || stringsContains(dep.Sources, MetricSourceTypeAccesslog) {
+				value[metricDependencyKey(dep)] = strconv.FormatFloat(dep.Count, 'f', -1, 64)
 			}
 		}
 		result[meta] = value
@@ -375,8 +395,13 @@ func spliceDestinationSvc(entry *data_accesslog.HTTPAccessLogEntry, sourceSvc st
 		destSvc = dest
 	}
 
-	log.Debugf("DestinationSvc is: %s", "{destination_service=\""+destSvc+"\"}")
-	return "{destination_service=\"" + destSvc + "\"}"
+	labels := map[string]string{labelDestinationService: destSvc, labelRequestProtocol: "http"}
+	if _, port, err := net.SplitHostPort(auth); err == nil {
+		labels[labelDestinationPort] = port
+	}
+	key := formatMetricKey(labels)
+	log.Debugf("DestinationSvc is: %s", key)
+	return key
 }
 
 func completeDestSvcName(destParts []string, dest, suffix string, svcToIpsCache map[string][]string, cacheLock *sync.RWMutex) (destSvc string) {
@@ -394,6 +419,15 @@ func completeDestSvcName(destParts []string, dest, suffix string, svcToIpsCache
 	return
 }
 
+// getIpToSvcCache returns the ip <-> service caches shared by accesslog convertor and dependency report,
+// they are initialized at the first call
+func (r *ServicefenceReconciler) getIpToSvcCache() (map[string]string, map[string][]string, *sync.RWMutex, error) {
+	r.ipCacheOnce.Do(func() {
+		r.ipToSvcCache, r.svcToIpsCache, r.ipCacheLock, r.ipCacheErr = newIpToSvcCache(r.env.K8SClient)
+	})
+	return r.ipToSvcCache, r.svcToIpsCache, r.ipCacheLock, r.ipCacheErr
+}
+
 func newIpToSvcCache(clientSet *kubernetes.Clientset) (map[string]string, map[string][]string, *sync.RWMutex, error) {
 	log := log.WithField("reporter", "AccessLogConvertor").WithField("function", "generateSvcToIpsCache")
 	ipToSvcCache := make(map[string]string)
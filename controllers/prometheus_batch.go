@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	prometheusV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prometheusModel "github.com/prometheus/common/model"
+	"slime.io/slime/framework/apis/config/v1alpha1"
+	"slime.io/slime/framework/model/metric"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+const (
+	labelSourceApp       = "source_app"
+	labelSourceNamespace = "source_namespace"
+
+	// defaultHandlerQuery is the handler query of the samples, it is batched without a configured batch query
+	defaultHandlerQuery      = `sum(istio_requests_total{source_app="$source_app",reporter="destination"})by(destination_service)`
+	defaultHandlerBatchQuery = `sum(istio_requests_total{source_app!="",reporter="destination"})by(source_app,source_namespace,destination_service)`
+)
+
+type batchQuery struct {
+	query string
+	// namespaced is whether the per-fence query only selects the namespace of the fence
+	namespaced bool
+}
+
+// newBatchQueries returns the batch queries by handler name, handlers without a batch query are not included
+func newBatchQueries(handlers map[string]*v1alpha1.Prometheus_Source_Handler, cfg *lazyloadv1alpha1.PrometheusBatch) map[string]*batchQuery {
+	custom := map[string]string{}
+	for _, q := range cfg.GetQueries() {
+		custom[q.Handler] = q.Query
+	}
+
+	ret := map[string]*batchQuery{}
+	for name, h := range handlers {
+		query := custom[name]
+		if query == "" && strings.Join(strings.Fields(h.Query), "") == defaultHandlerQuery {
+			query = defaultHandlerBatchQuery
+		}
+		if query == "" {
+			log.Infof("prometheus handler %s has no batch query, query it per fence", name)
+			continue
+		}
+		ret[name] = &batchQuery{query: query, namespaced: isNamespacedQuery(h.Query)}
+	}
+	return ret
+}
+
+// labelMatcher matches the label matchers of a query, like source_app="$source_app"
+var labelMatcher = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*"([^"]*)"`)
+
+// checkBatchable returns an error if the handler query selects the fence by something else than
+// source_app and source_namespace, as the result of the batch query is only fanned out by them
+func checkBatchable(query string) error {
+	if isQueryTemplate(query) && strings.Contains(query, ".Labels") {
+		return fmt.Errorf("the query selects the fence by .Labels")
+	}
+	for _, m := range labelMatcher.FindAllStringSubmatch(query, -1) {
+		label, op, value := m[1], m[2], m[3]
+		if !strings.Contains(value, "{{") && !strings.Contains(value, "$source_app") && !strings.Contains(value, "$namespace") {
+			continue
+		}
+		if label != labelSourceApp && label != labelSourceNamespace {
+			return fmt.Errorf("the query selects the fence by label %s, only %s and %s are supported",
+				label, labelSourceApp, labelSourceNamespace)
+		}
+		if op != "=" {
+			return fmt.Errorf("the query selects the fence by label %s with %s, only = is supported", label, op)
+		}
+	}
+	return nil
+}
+
+// groupingMatcher matches the grouping clauses of the aggregations of a query, like by(source_app)
+var groupingMatcher = regexp.MustCompile(`\b(by|without)\s*\(([^)]*)\)`)
+
+// checkBatchQuery returns an error if the batch query aggregates source_app away, or source_namespace
+// for a namespaced handler, as its result could not be fanned out to the fences
+func checkBatchQuery(query string, namespaced bool) error {
+	required := []string{labelSourceApp}
+	if namespaced {
+		required = append(required, labelSourceNamespace)
+	}
+	for _, m := range groupingMatcher.FindAllStringSubmatch(query, -1) {
+		labels := map[string]bool{}
+		for _, l := range strings.Split(m[2], ",") {
+			labels[strings.TrimSpace(l)] = true
+		}
+		for _, l := range required {
+			if keep := m[1] == "by"; labels[l] != keep {
+				return fmt.Errorf("the batch query drops label %s by %s(%s)", l, m[1], m[2])
+			}
+		}
+	}
+	return nil
+}
+
+// isNamespacedQuery returns whether the handler query selects the namespace of the fence
+func isNamespacedQuery(query string) bool {
+	if isQueryTemplate(query) {
+		return strings.Contains(query, ".Namespace")
+	}
+	return strings.Contains(query, "$namespace")
+}
+
+// batchPrometheusSource queries each batched handler once for all fences of a query map and fans the
+// result out to the fences. The other handlers are queried per fence by the embedded source.
+type batchPrometheusSource struct {
+	metric.Source
+	api     prometheusV1.API
+	queries map[string]*batchQuery
+}
+
+func (s *batchPrometheusSource) QueryMetric(queryMap metric.QueryMap) (metric.Metric, error) {
+	perFence := metric.QueryMap{}
+	batched := map[string][]string{}
+	for meta, handlers := range queryMap {
+		for _, h := range handlers {
+			if s.queries[h.Name] != nil {
+				batched[h.Name] = append(batched[h.Name], meta)
+			} else {
+				perFence[meta] = append(perFence[meta], h)
+			}
+		}
+	}
+	// a single fence, like the one of a watcher event, is cheaper to query alone
+	for name, metas := range batched {
+		if len(metas) == 1 {
+			for _, h := range queryMap[metas[0]] {
+				if h.Name == name {
+					perFence[metas[0]] = append(perFence[metas[0]], h)
+				}
+			}
+			delete(batched, name)
+		}
+	}
+
+	ret := metric.Metric{}
+	if len(perFence) > 0 {
+		m, err := s.Source.QueryMetric(perFence)
+		if err != nil {
+			return nil, err
+		}
+		for meta, results := range m {
+			ret[meta] = append(ret[meta], results...)
+		}
+	}
+
+	for name, metas := range batched {
+		bq := s.queries[name]
+		byApp, err := s.queryBatch(bq.query, bq.namespaced)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metric of handler %s from prometheus, %v", name, err)
+		}
+		for _, meta := range metas {
+			ns, app := strings.Split(meta, "/")[0], strings.Split(meta, "/")[1]
+			ret[meta] = append(ret[meta], metric.Result{Name: name, Value: fanOut(byApp[app], ns, bq.namespaced)})
+		}
+	}
+
+	log.Debugf("queried metric of %d fences from prometheus, %d handlers batched", len(queryMap), len(batched))
+	return ret, nil
+}
+
+// queryBatch returns the samples of the batch query by source_app. It fails if a sample has no source
+// labels, as fanning it out would give empty results to the fences.
+func (s *batchPrometheusSource) queryBatch(query string, namespaced bool) (map[string]prometheusModel.Vector, error) {
+	value, warnings, err := s.api.Query(context.Background(), query, time.Now())
+	if err != nil {
+		return nil, err
+	} else if warnings != nil {
+		return nil, fmt.Errorf("warning: %s", strings.Join(warnings, ";"))
+	}
+	vector, ok := value.(prometheusModel.Vector)
+	if !ok {
+		return nil, fmt.Errorf("result type %s of batch query is not vector", value.Type())
+	}
+
+	ret := map[string]prometheusModel.Vector{}
+	for _, sample := range vector {
+		if _, ok := sample.Metric[labelSourceApp]; !ok {
+			return nil, fmt.Errorf("sample %s of batch query has no label %s", sample.Metric, labelSourceApp)
+		}
+		if _, ok := sample.Metric[labelSourceNamespace]; namespaced && !ok {
+			return nil, fmt.Errorf("sample %s of batch query has no label %s", sample.Metric, labelSourceNamespace)
+		}
+		app := string(sample.Metric[labelSourceApp])
+		ret[app] = append(ret[app], sample)
+	}
+	return ret, nil
+}
+
+// fanOut converts the samples of a fence to the result of its per-fence query. The source labels are
+// dropped from the keys, and the samples of the same key from different namespaces are summed up.
+func fanOut(samples prometheusModel.Vector, ns string, namespaced bool) map[string]string {
+	sums := map[string]float64{}
+	for _, sample := range samples {
+		if namespaced && string(sample.Metric[labelSourceNamespace]) != ns {
+			continue
+		}
+		labels := sample.Metric.Clone()
+		delete(labels, labelSourceApp)
+		delete(labels, labelSourceNamespace)
+		sums[labels.String()] += float64(sample.Value)
+	}
+
+	ret := make(map[string]string, len(sums))
+	for k, v := range sums {
+		ret[k] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ret
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	prometheusV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prometheusModel "github.com/prometheus/common/model"
+	"slime.io/slime/framework/apis/config/v1alpha1"
+	"slime.io/slime/framework/model/metric"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// stubPrometheusAPI answers queries with the vector of the query
+type stubPrometheusAPI struct {
+	prometheusV1.API
+	vectors map[string]prometheusModel.Vector
+	queries []string
+}
+
+func (s *stubPrometheusAPI) Query(_ context.Context, query string, _ time.Time) (prometheusModel.Value, api.Warnings, error) {
+	s.queries = append(s.queries, query)
+	return s.vectors[query], nil, nil
+}
+
+// stubMetricSource records the per-fence queries and answers each with an empty result
+type stubMetricSource struct {
+	queryMap metric.QueryMap
+}
+
+func (s *stubMetricSource) Start() error { return nil }
+
+func (s *stubMetricSource) QueryMetric(queryMap metric.QueryMap) (metric.Metric, error) {
+	s.queryMap = queryMap
+	ret := metric.Metric{}
+	for meta, handlers := range queryMap {
+		for _, h := range handlers {
+			ret[meta] = append(ret[meta], metric.Result{Name: h.Name, Value: map[string]string{}})
+		}
+	}
+	return ret, nil
+}
+
+func sample(value float64, kv ...string) *prometheusModel.Sample {
+	m := prometheusModel.Metric{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		m[prometheusModel.LabelName(kv[i])] = prometheusModel.LabelValue(kv[i+1])
+	}
+	return &prometheusModel.Sample{Metric: m, Value: prometheusModel.SampleValue(value)}
+}
+
+func TestNewBatchQueries(t *testing.T) {
+	handlers := map[string]*v1alpha1.Prometheus_Source_Handler{
+		"default":   {Query: `sum(istio_requests_total{source_app="$source_app", reporter="destination"}) by (destination_service)`},
+		"custom":    {Query: `sum(istio_requests_total{source_app="$source_app",source_namespace="$namespace"})by(destination_service)`},
+		"template":  {Query: `sum(istio_requests_total{source_app="{{ .Name }}",source_namespace="{{ .Namespace }}"})by(destination_service)`},
+		"unbatched": {Query: `sum(istio_tcp_sent_bytes_total{source_app="$source_app"})by(destination_service)`},
+	}
+	cfg := &lazyloadv1alpha1.PrometheusBatch{Enable: true, Queries: []*lazyloadv1alpha1.PrometheusBatchQuery{
+		{Handler: "custom", Query: "custom batch"},
+		{Handler: "template", Query: "template batch"},
+	}}
+
+	got := newBatchQueries(handlers, cfg)
+	want := map[string]*batchQuery{
+		"default":  {query: defaultHandlerBatchQuery},
+		"custom":   {query: "custom batch", namespaced: true},
+		"template": {query: "template batch", namespaced: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newBatchQueries() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	samples := prometheusModel.Vector{
+		sample(1, "source_app", "reviews", "source_namespace", "default", "destination_service", "details.default.svc.cluster.local"),
+		sample(2, "source_app", "reviews", "source_namespace", "other", "destination_service", "details.default.svc.cluster.local"),
+		sample(4, "source_app", "reviews", "source_namespace", "other", "destination_service", "ratings.other.svc.cluster.local"),
+	}
+	cases := []struct {
+		name       string
+		namespaced bool
+		want       map[string]string
+	}{
+		{
+			name: "namespaces are summed up",
+			want: map[string]string{
+				`{destination_service="details.default.svc.cluster.local"}`: "3",
+				`{destination_service="ratings.other.svc.cluster.local"}`:   "4",
+			},
+		},
+		{
+			name:       "namespace of fence only",
+			namespaced: true,
+			want:       map[string]string{`{destination_service="details.default.svc.cluster.local"}`: "1"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := fanOut(samples, "default", c.namespaced); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("fanOut() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestBatchPrometheusSourceQueryMetric(t *testing.T) {
+	const batch = "batch"
+	vector := prometheusModel.Vector{
+		sample(1, "source_app", "reviews", "source_namespace", "default", "destination_service", "details"),
+		sample(2, "source_app", "reviews", "source_namespace", "other", "destination_service", "details"),
+		sample(5, "source_app", "productpage", "source_namespace", "default", "destination_service", "reviews"),
+	}
+	batched := metric.Handler{Name: "destination", Query: "per fence"}
+	unbatched := metric.Handler{Name: "tcp", Query: "per fence tcp"}
+
+	cases := []struct {
+		name        string
+		namespaced  bool
+		queryMap    metric.QueryMap
+		wantBatch   int
+		wantFenced  map[string][]string
+		wantResults map[string]map[string]string
+	}{
+		{
+			name: "batched",
+			queryMap: metric.QueryMap{
+				"default/reviews":     {batched, unbatched},
+				"default/productpage": {batched},
+			},
+			wantBatch:  1,
+			wantFenced: map[string][]string{"default/reviews": {"tcp"}},
+			wantResults: map[string]map[string]string{
+				"default/reviews":     {`{destination_service="details"}`: "3"},
+				"default/productpage": {`{destination_service="reviews"}`: "5"},
+			},
+		},
+		{
+			name:       "namespaced",
+			namespaced: true,
+			queryMap: metric.QueryMap{
+				"default/reviews": {batched},
+				"other/reviews":   {batched},
+			},
+			wantBatch: 1,
+			wantResults: map[string]map[string]string{
+				"default/reviews": {`{destination_service="details"}`: "1"},
+				"other/reviews":   {`{destination_service="details"}`: "2"},
+			},
+		},
+		{
+			name:       "single fence is queried alone",
+			queryMap:   metric.QueryMap{"default/reviews": {batched, unbatched}},
+			wantFenced: map[string][]string{"default/reviews": {"destination", "tcp"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			promAPI := &stubPrometheusAPI{vectors: map[string]prometheusModel.Vector{batch: vector}}
+			perFence := &stubMetricSource{}
+			s := &batchPrometheusSource{
+				Source:  perFence,
+				api:     promAPI,
+				queries: map[string]*batchQuery{"destination": {query: batch, namespaced: c.namespaced}},
+			}
+			got, err := s.QueryMetric(c.queryMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(promAPI.queries) != c.wantBatch {
+				t.Errorf("%d batch queries, want %d", len(promAPI.queries), c.wantBatch)
+			}
+			fenced := map[string][]string{}
+			for meta, handlers := range perFence.queryMap {
+				for _, h := range handlers {
+					fenced[meta] = append(fenced[meta], h.Name)
+				}
+				sort.Strings(fenced[meta])
+			}
+			if len(fenced) != 0 || len(c.wantFenced) != 0 {
+				if !reflect.DeepEqual(fenced, c.wantFenced) {
+					t.Errorf("per fence handlers %v, want %v", fenced, c.wantFenced)
+				}
+			}
+			for meta := range c.queryMap {
+				if len(got[meta]) != len(c.queryMap[meta]) {
+					t.Errorf("%s has results %+v, want one per handler", meta, got[meta])
+				}
+			}
+			for meta, want := range c.wantResults {
+				var value map[string]string
+				for _, result := range got[meta] {
+					if result.Name == batched.Name {
+						value = result.Value
+					}
+				}
+				if !reflect.DeepEqual(value, want) {
+					t.Errorf("result of %s = %v, want %v", meta, value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBatchQuery(t *testing.T) {
+	cases := []struct {
+		query      string
+		namespaced bool
+		wantErr    bool
+	}{
+		{query: defaultHandlerBatchQuery, namespaced: true},
+		{query: `sum by (source_app) (istio_requests_total)`},
+		{query: `sum(istio_requests_total)without(source_workload)`, namespaced: true},
+		{query: `istio_requests_total{source_app!=""}`, namespaced: true},
+		{query: `sum(istio_requests_total)by(destination_service)`, wantErr: true},
+		{query: `sum(istio_requests_total)by(source_app,destination_service)`, namespaced: true, wantErr: true},
+		{query: `sum(sum(istio_requests_total)by(destination_service))by(source_app)`, wantErr: true},
+		{query: `sum(istio_requests_total)without(source_app)`, wantErr: true},
+	}
+	for _, c := range cases {
+		if err := checkBatchQuery(c.query, c.namespaced); (err != nil) != c.wantErr {
+			t.Errorf("checkBatchQuery(%q, %v) = %v, want error %v", c.query, c.namespaced, err, c.wantErr)
+		}
+	}
+}
+
+func TestBatchPrometheusSourceQueryMetricWithoutSourceLabels(t *testing.T) {
+	const batch = "batch"
+	queryMap := metric.QueryMap{
+		"default/reviews":     {{Name: "destination"}},
+		"default/productpage": {{Name: "destination"}},
+	}
+	cases := []struct {
+		name       string
+		namespaced bool
+		vector     prometheusModel.Vector
+	}{
+		{
+			name:   "no source_app",
+			vector: prometheusModel.Vector{sample(1, "destination_service", "details")},
+		},
+		{
+			name:       "no source_namespace of namespaced handler",
+			namespaced: true,
+			vector:     prometheusModel.Vector{sample(1, "source_app", "reviews", "destination_service", "details")},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &batchPrometheusSource{
+				Source:  &stubMetricSource{},
+				api:     &stubPrometheusAPI{vectors: map[string]prometheusModel.Vector{batch: c.vector}},
+				queries: map[string]*batchQuery{"destination": {query: batch, namespaced: c.namespaced}},
+			}
+			if _, err := s.QueryMetric(queryMap); err == nil {
+				t.Errorf("no error for samples without the source labels")
+			}
+		})
+	}
+}
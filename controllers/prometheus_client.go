@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+var (
+	prometheusQueryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lazyload",
+		Subsystem: "prometheus",
+		Name:      "queries_total",
+		Help:      "Total number of queries to the prometheus metric source by response code, code is error if no response.",
+	}, []string{"code"})
+
+	prometheusQueryDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "lazyload",
+		Subsystem: "prometheus",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of queries to the prometheus metric source.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	prometheusUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lazyload",
+		Subsystem: "prometheus",
+		Name:      "up",
+		Help:      "Whether the last query to the prometheus metric source succeeded.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(prometheusQueryTotal, prometheusQueryDuration, prometheusUp)
+}
+
+// prometheusRoundTripper adds the authentication and timeout of PrometheusClient to queries and records
+// the health metrics of the prometheus metric source
+type prometheusRoundTripper struct {
+	next    http.RoundTripper
+	cfg     *lazyloadv1alpha1.PrometheusClient
+	timeout time.Duration
+}
+
+// newPrometheusRoundTripper returns the round tripper of the prometheus client, cfg can be nil
+func newPrometheusRoundTripper(cfg *lazyloadv1alpha1.PrometheusClient) (http.RoundTripper, error) {
+	var timeout time.Duration
+	if cfg.GetTimeout() != "" {
+		d, err := time.ParseDuration(cfg.GetTimeout())
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid prometheus timeout %q, should be a positive duration", cfg.GetTimeout())
+		}
+		timeout = d
+	}
+
+	tlsConfig, err := newPrometheusTLSConfig(cfg.GetTls())
+	if err != nil {
+		return nil, err
+	}
+
+	// same as prometheus api.DefaultRoundTripper except for tls
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+	}
+	return &prometheusRoundTripper{next: transport, cfg: cfg, timeout: timeout}, nil
+}
+
+func newPrometheusTLSConfig(cfg *lazyloadv1alpha1.PrometheusTLS) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CaFile != "" {
+		ca, err := ioutil.ReadFile(cfg.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read prometheus ca file error, %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in prometheus ca file %s", cfg.CaFile)
+		}
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("prometheus certFile and keyFile should be set together")
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load prometheus client certificate error, %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (rt *prometheusRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if rt.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, rt.timeout)
+	}
+	// the request should not be modified by a round tripper
+	req = req.Clone(ctx)
+	if err := rt.authorize(req); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+	prometheusQueryDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		cancel()
+		prometheusQueryTotal.WithLabelValues("error").Inc()
+		prometheusUp.Set(0)
+		return nil, err
+	}
+
+	prometheusQueryTotal.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode < http.StatusBadRequest {
+		prometheusUp.Set(1)
+	} else {
+		prometheusUp.Set(0)
+	}
+	// the timeout also covers reading the body, so cancel it when the body is closed
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (rt *prometheusRoundTripper) authorize(req *http.Request) error {
+	token := rt.cfg.GetBearerToken()
+	if f := rt.cfg.GetBearerTokenFile(); f != "" {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("read prometheus bearer token file error, %v", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+
+	if ba := rt.cfg.GetBasicAuth(); ba != nil {
+		password := ba.Password
+		if ba.PasswordFile != "" {
+			b, err := ioutil.ReadFile(ba.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("read prometheus password file error, %v", err)
+			}
+			password = strings.TrimSpace(string(b))
+		}
+		req.SetBasicAuth(ba.Username, password)
+	}
+	return nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	prometheusApi "github.com/prometheus/client_golang/api"
+	prometheusV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	prometheusModel "github.com/prometheus/common/model"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+const stubQueryResponse = `{"status":"success","data":{"resultType":"vector","result":[` +
+	`{"metric":{"destination_service":"reviews.default.svc.cluster.local"},"value":[1600000000,"3"]}]}}`
+
+func newStubPrometheus(t *testing.T, cfg *lazyloadv1alpha1.PrometheusClient, address string) prometheusV1.API {
+	rt, err := newPrometheusRoundTripper(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := prometheusApi.NewClient(prometheusApi.Config{Address: address, RoundTripper: rt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prometheusV1.NewAPI(client)
+}
+
+func TestPrometheusClientBearerTokenAndTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(stubQueryResponse))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "prometheus-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile, tokenFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "token")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err = ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	api := newStubPrometheus(t, &lazyloadv1alpha1.PrometheusClient{
+		BearerTokenFile: tokenFile,
+		Tls:             &lazyloadv1alpha1.PrometheusTLS{CaFile: caFile},
+	}, server.URL)
+	value, _, err := api.Query(context.Background(), "up", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vector, ok := value.(prometheusModel.Vector)
+	if !ok || len(vector) != 1 || vector[0].Value != 3 {
+		t.Errorf("got value %v, want a vector of 3", value)
+	}
+	if up := testutil.ToFloat64(prometheusUp); up != 1 {
+		t.Errorf("got up %v, want 1", up)
+	}
+}
+
+func TestPrometheusClientBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "admin" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(stubQueryResponse))
+	}))
+	defer server.Close()
+
+	api := newStubPrometheus(t, &lazyloadv1alpha1.PrometheusClient{
+		BasicAuth: &lazyloadv1alpha1.PrometheusBasicAuth{Username: "admin", Password: "pass"},
+	}, server.URL)
+	if _, _, err := api.Query(context.Background(), "up", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	api = newStubPrometheus(t, nil, server.URL)
+	if _, _, err := api.Query(context.Background(), "up", time.Now()); err == nil {
+		t.Error("got no error without basic auth")
+	}
+	if up := testutil.ToFloat64(prometheusUp); up != 0 {
+		t.Errorf("got up %v, want 0", up)
+	}
+}
+
+func TestPrometheusClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	api := newStubPrometheus(t, &lazyloadv1alpha1.PrometheusClient{Timeout: "50ms"}, server.URL)
+	start := time.Now()
+	if _, _, err := api.Query(context.Background(), "up", time.Now()); err == nil {
+		t.Error("got no error from a slow prometheus")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("query took %v, want it to time out after 50ms", d)
+	}
+}
+
+func TestPrometheusClientInvalidConfig(t *testing.T) {
+	for _, cfg := range []*lazyloadv1alpha1.PrometheusClient{
+		{Timeout: "-1s"},
+		{Tls: &lazyloadv1alpha1.PrometheusTLS{CaFile: "/nonexistent/ca.pem"}},
+		{Tls: &lazyloadv1alpha1.PrometheusTLS{CertFile: "/nonexistent/cert.pem"}},
+	} {
+		if _, err := newPrometheusRoundTripper(cfg); err == nil {
+			t.Errorf("got no error for %v", cfg)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"slime.io/slime/framework/apis/config/v1alpha1"
+	"slime.io/slime/framework/model/metric"
+)
+
+// queryTemplateData is the data of handler queries written in go template, like
+// sum(istio_requests_total{source_workload=~"{{ .Name }}-.*",source_workload_namespace="{{ .Namespace }}"}[{{ .Window }}])by(destination_service)
+type queryTemplateData struct {
+	// Name and Namespace of the fence, which are the ones of its service
+	Name      string
+	Namespace string
+	// Labels is the selector of the service, empty if the service is not found
+	Labels map[string]string
+	// IstioRev is the istio revision of the module
+	IstioRev string
+	// Window is the refresh interval of the fence in seconds, like "30s", which fits range selectors.
+	// It grows with the interval of the fence under adaptive refresh.
+	Window string
+}
+
+type queryTemplate struct {
+	*template.Template
+	// needLabels is whether the service should be fetched for the selector labels
+	needLabels bool
+}
+
+// isQueryTemplate returns whether the handler query is a go template instead of a $namespace/$source_app one
+func isQueryTemplate(query string) bool {
+	return strings.Contains(query, "{{")
+}
+
+// newQueryTemplates parses the handler queries written in go template by handler name
+func newQueryTemplates(handlers map[string]*v1alpha1.Prometheus_Source_Handler) (map[string]*queryTemplate, error) {
+	ret := map[string]*queryTemplate{}
+	for name, h := range handlers {
+		if !isQueryTemplate(h.Query) {
+			continue
+		}
+		t, err := template.New(name).Option("missingkey=zero").Parse(h.Query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query template of prometheus handler %s, %v", name, err)
+		}
+		ret[name] = &queryTemplate{Template: t, needLabels: strings.Contains(h.Query, ".Labels")}
+	}
+	return ret, nil
+}
+
+// prometheusHandler renders the query of handler pName for the fence
+func (r *ServicefenceReconciler) prometheusHandler(name, namespace, pName string, pHandler *v1alpha1.Prometheus_Source_Handler) (metric.Handler, error) {
+	t := r.queryTemplates[pName]
+	if t == nil {
+		return generateHandler(name, namespace, pName, pHandler), nil
+	}
+
+	data := queryTemplateData{
+		Name:      name,
+		Namespace: namespace,
+		IstioRev:  r.env.IstioRev(),
+		Window:    fmt.Sprintf("%ds", int64(r.refreshScheduler.interval(namespace+"/"+name).Seconds())),
+	}
+	if t.needLabels {
+		svc := &corev1.Service{}
+		if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, svc); err != nil {
+			if !errors.IsNotFound(err) {
+				return metric.Handler{}, fmt.Errorf("get service %s/%s error, %v", namespace, name, err)
+			}
+		}
+		data.Labels = svc.Spec.Selector
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return metric.Handler{}, err
+	}
+	return metric.Handler{Name: pName, Query: b.String()}, nil
+}
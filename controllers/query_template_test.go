@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"slime.io/slime/framework/apis/config/v1alpha1"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func TestNewQueryTemplates(t *testing.T) {
+	got, err := newQueryTemplates(map[string]*v1alpha1.Prometheus_Source_Handler{
+		"plain":  {Query: `sum(istio_requests_total{source_app="$source_app"})by(destination_service)`},
+		"name":   {Query: `sum(istio_requests_total{source_app="{{ .Name }}"})by(destination_service)`},
+		"labels": {Query: `sum(istio_requests_total{source_app="{{ index .Labels "app" }}"})by(destination_service)`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["plain"] != nil {
+		t.Errorf("only go templates should be parsed, got %v", got)
+	}
+	if got["name"].needLabels || !got["labels"].needLabels {
+		t.Errorf("needLabels of name %v, labels %v", got["name"].needLabels, got["labels"].needLabels)
+	}
+
+	_, err = newQueryTemplates(map[string]*v1alpha1.Prometheus_Source_Handler{"broken": {Query: `{{ .Name `}})
+	if err == nil || !strings.Contains(err.Error(), "invalid query template of prometheus handler broken") {
+		t.Errorf("err = %v, want invalid query template", err)
+	}
+}
+
+func TestPrometheusHandlerRender(t *testing.T) {
+	svc := testService("default", "reviews")
+	svc.Spec.Selector = map[string]string{"app.kubernetes.io/name": "reviews-app"}
+	handlers := map[string]*v1alpha1.Prometheus_Source_Handler{
+		"plain":  {Query: `sum(istio_requests_total{source_app="$source_app",source_namespace="$namespace"})by(destination_service)`},
+		"window": {Query: `sum(increase(istio_requests_total{source_workload=~"{{ .Name }}-.*",source_workload_namespace="{{ .Namespace }}"}[{{ .Window }}]))`},
+		"labels": {Query: `sum(istio_requests_total{source_app="{{ index .Labels "app.kubernetes.io/name" }}"})`},
+		"absent": {Query: `sum(istio_requests_total{source_app="{{ index .Labels "app" }}"})`},
+	}
+	r := newTestReconciler(t, adaptiveFence("10s", ""), svc)
+	templates, err := newQueryTemplates(handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.queryTemplates = templates
+
+	cases := []struct {
+		handler, name string
+		// observed is the number of unchanged refreshes of the fence before rendering
+		observed int
+		want     string
+	}{
+		{handler: "plain", name: "reviews", want: `sum(istio_requests_total{source_app="reviews",source_namespace="default"})by(destination_service)`},
+		{handler: "window", name: "reviews", want: `sum(increase(istio_requests_total{source_workload=~"reviews-.*",source_workload_namespace="default"}[10s]))`},
+		{handler: "window", name: "ratings", observed: 3, want: `sum(increase(istio_requests_total{source_workload=~"ratings-.*",source_workload_namespace="default"}[40s]))`},
+		{handler: "labels", name: "reviews", want: `sum(istio_requests_total{source_app="reviews-app"})`},
+		// labels of a service not found are empty
+		{handler: "absent", name: "ratings", want: `sum(istio_requests_total{source_app=""})`},
+	}
+	for _, c := range cases {
+		for i := 0; i < c.observed; i++ {
+			r.refreshScheduler.observe("default/"+c.name, false, time.Now())
+		}
+		h, err := r.prometheusHandler(c.name, "default", c.handler, handlers[c.handler])
+		if err != nil {
+			t.Fatalf("%s of %s: %v", c.handler, c.name, err)
+		}
+		if h.Name != c.handler || h.Query != c.want {
+			t.Errorf("%s of %s = %+v, want query %s", c.handler, c.name, h, c.want)
+		}
+	}
+}
+
+func TestCheckBatchable(t *testing.T) {
+	cases := []struct {
+		query   string
+		wantErr bool
+	}{
+		{query: defaultHandlerQuery},
+		{query: `sum(istio_requests_total{source_app="$source_app",source_namespace="$namespace"})by(destination_service)`},
+		{query: `sum(istio_requests_total{source_app="{{ .Name }}",source_namespace="{{ .Namespace }}",reporter="destination"})by(destination_service)`},
+		{query: `sum(increase(istio_requests_total{source_app="{{ .Name }}"}[{{ .Window }}]))by(destination_service)`},
+		{query: `sum(istio_requests_total{source_workload=~"{{ .Name }}-.*"})by(destination_service)`, wantErr: true},
+		{query: `sum(istio_requests_total{source_app=~"{{ .Name }}-.*"})by(destination_service)`, wantErr: true},
+		{query: `sum(istio_requests_total{destination_service_namespace="$namespace"})by(destination_service)`, wantErr: true},
+		{query: `sum(istio_requests_total{source_app="{{ index .Labels "app" }}"})by(destination_service)`, wantErr: true},
+	}
+	for _, c := range cases {
+		if err := checkBatchable(c.query); (err != nil) != c.wantErr {
+			t.Errorf("checkBatchable(%s) = %v, want err %v", c.query, err, c.wantErr)
+		}
+	}
+}
+
+func TestResolveFenceConfigRejectsUnbatchableHandler(t *testing.T) {
+	config := &v1alpha1.Config{Metric: &v1alpha1.Metric{Prometheus: &v1alpha1.Prometheus_Source{
+		Handlers: map[string]*v1alpha1.Prometheus_Source_Handler{
+			"destination": {Query: `sum(istio_requests_total{source_workload=~"{{ .Name }}-.*"})by(destination_service)`},
+		},
+	}}}
+	newCfg := func(enable bool) *lazyloadv1alpha1.Fence {
+		return &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+			Types: []string{MetricSourceTypePrometheus},
+			PrometheusBatch: &lazyloadv1alpha1.PrometheusBatch{Enable: enable, Queries: []*lazyloadv1alpha1.PrometheusBatchQuery{
+				{Handler: "destination", Query: `sum(istio_requests_total)by(source_workload,destination_service)`},
+			}},
+		}}
+	}
+
+	if err := ResolveFenceConfig(newCfg(false), config); err != nil {
+		t.Errorf("handler without batching is rejected, %v", err)
+	}
+	err := ResolveFenceConfig(newCfg(true), config)
+	if err == nil || !strings.Contains(err.Error(), `prometheus handler "destination" can not be batched`) {
+		t.Errorf("err = %v, want handler can not be batched", err)
+	}
+}
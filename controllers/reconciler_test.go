@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"slime.io/slime/framework/apis/config/v1alpha1"
+	"slime.io/slime/framework/apis/networking/v1alpha3"
+	"slime.io/slime/framework/bootstrap"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func init() {
+	// the fake client decodes objects with the client-go scheme
+	_ = lazyloadv1alpha1.AddToScheme(scheme.Scheme)
+	_ = v1alpha3.AddToScheme(scheme.Scheme)
+}
+
+// newTestReconciler returns a reconciler backed by a fake client holding objs, without producers and caches
+// of the cluster. cfg is resolved by ResolveFenceConfig, the metric source is accesslog if unset.
+func newTestReconciler(t *testing.T, cfg *lazyloadv1alpha1.Fence, objs ...runtime.Object) *ServicefenceReconciler {
+	t.Helper()
+	if cfg == nil {
+		cfg = &lazyloadv1alpha1.Fence{}
+	}
+	if cfg.MetricSource == nil {
+		// prometheus source needs the metric config of framework
+		cfg.MetricSource = &lazyloadv1alpha1.MetricSource{Types: []string{MetricSourceTypeAccesslog}}
+	}
+	if err := ResolveFenceConfig(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	env := bootstrap.Environment{Config: &v1alpha1.Config{Global: &v1alpha1.Global{
+		Service:        "app",
+		IstioNamespace: "istio-system",
+		SlimeNamespace: "mesh-operator",
+	}}}
+	r := &ServicefenceReconciler{
+		Client:               &applyClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, objs...)},
+		Scheme:               scheme.Scheme,
+		cfg:                  cfg,
+		env:                  env,
+		interestMeta:         map[string]bool{},
+		interestMetaCopy:     map[string]bool{},
+		staleNamespaces:      map[string]bool{},
+		enabledNamespaces:    map[string]bool{},
+		nsSvcCache:           &NsSvcCache{Data: map[string]map[string]struct{}{}},
+		labelSvcCache:        &LabelSvcCache{Data: map[LabelItem]map[string]struct{}{}},
+		portSvcCache:         &PortSvcCache{Data: map[string][]corev1.ServicePort{}},
+		defaultAddNamespaces: []string{"istio-system", "mesh-operator"},
+		doAliasRules:         newDomainAliasRules(cfg.DomainAliases),
+		nsScope:              newNamespaceScope(cfg.Namespace),
+		refreshScheduler:     newRefreshScheduler(cfg),
+		statusLimits:         newStatusLimits(cfg.StatusLimit),
+		globalSidecarReady:   map[string]bool{},
+	}
+	for _, obj := range objs {
+		if svc, ok := obj.(*corev1.Service); ok {
+			if r.nsSvcCache.Data[svc.Namespace] == nil {
+				r.nsSvcCache.Data[svc.Namespace] = map[string]struct{}{}
+			}
+			r.nsSvcCache.Data[svc.Namespace][svc.Namespace+"/"+svc.Name] = struct{}{}
+		}
+	}
+	return r
+}
+
+func testService(ns, name string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": name}},
+	}
+}
+
+func testFence(ns, name string) *lazyloadv1alpha1.ServiceFence {
+	return &lazyloadv1alpha1.ServiceFence{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name}}
+}
+
+// applyClient emulates server-side apply of a single field manager for the fake client, which does not
+// support it. The fields of the last apply configuration of an object missing in the new one are removed,
+// while the others, like the ones written by update, are kept. Lists are replaced as a whole.
+type applyClient struct {
+	client.Client
+	// applies are the options of the applies
+	applies []*client.PatchOptions
+	// last is the last apply configuration of the objects
+	last map[string][]byte
+	// statusUpdates is the count of the updates of status
+	statusUpdates int
+}
+
+func (c *applyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	return c.apply(ctx, obj, "", c.Client.Update, opts...)
+}
+
+func (c *applyClient) Status() client.StatusWriter {
+	return &applyStatusWriter{StatusWriter: c.Client.Status(), c: c}
+}
+
+type applyStatusWriter struct {
+	client.StatusWriter
+	c *applyClient
+}
+
+func (w *applyStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	w.c.statusUpdates++
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func (w *applyStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+	}
+	return w.c.apply(ctx, obj, "status", w.StatusWriter.Update, opts...)
+}
+
+func (c *applyClient) apply(ctx context.Context, obj runtime.Object, subresource string,
+	updateFn func(context.Context, runtime.Object, ...client.UpdateOption) error, opts ...client.PatchOption) error {
+	options := &client.PatchOptions{}
+	options.ApplyOptions(opts)
+	c.applies = append(c.applies, options)
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("apply configuration %T is not unstructured", obj)
+	}
+	typed, err := scheme.Scheme.New(u.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(u.Object)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s", u.GroupVersionKind(), u.GetNamespace(), u.GetName(), subresource)
+	if c.last == nil {
+		c.last = map[string][]byte{}
+	}
+
+	nn := types.NamespacedName{Namespace: u.GetNamespace(), Name: u.GetName()}
+	if err = c.Client.Get(ctx, nn, typed); err != nil {
+		if !errors.IsNotFound(err) || subresource != "" {
+			return err
+		}
+		if err = json.Unmarshal(config, typed); err != nil {
+			return err
+		}
+		err = c.Client.Create(ctx, typed)
+	} else {
+		var current, data []byte
+		if current, err = json.Marshal(typed); err != nil {
+			return err
+		}
+		original := c.last[key]
+		if original == nil {
+			original = []byte("{}")
+		}
+		if data, err = jsonmergepatch.CreateThreeWayJSONMergePatch(original, config, current); err != nil {
+			return err
+		}
+		// the merge patch of the fake client keeps the map entries deleted by the patch
+		patched, patch := map[string]interface{}{}, map[string]interface{}{}
+		if err = json.Unmarshal(current, &patched); err != nil {
+			return err
+		}
+		if err = json.Unmarshal(data, &patch); err != nil {
+			return err
+		}
+		mergeJSON(patched, patch)
+		if data, err = json.Marshal(patched); err != nil {
+			return err
+		}
+		typed, _ = scheme.Scheme.New(u.GroupVersionKind())
+		if err = json.Unmarshal(data, typed); err != nil {
+			return err
+		}
+		err = updateFn(ctx, typed)
+	}
+	if err != nil {
+		return err
+	}
+	c.last[key] = config
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+	if err != nil {
+		return err
+	}
+	gvk := u.GroupVersionKind()
+	u.Object = content
+	u.SetGroupVersionKind(gvk)
+	return nil
+}
+
+// mergeJSON applies the json merge patch to dst
+func mergeJSON(dst, patch map[string]interface{}) {
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(dst, k)
+		case map[string]interface{}:
+			m, ok := dst[k].(map[string]interface{})
+			if !ok {
+				m = map[string]interface{}{}
+				dst[k] = m
+			}
+			mergeJSON(m, v)
+		default:
+			dst[k] = v
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+const (
+	defaultRefreshInterval         = 30 * time.Second
+	defaultMaxRefreshIntervalTimes = 10
+)
+
+// refreshScheduler decides which fences are refreshed on a tick. Without adaptive refresh all fences
+// are refreshed on every tick. With it, the interval of a fence doubles after each refresh that does
+// not change its metric, up to max, and is reset to min once the metric changes.
+type refreshScheduler struct {
+	min, max time.Duration
+	adaptive bool
+
+	fences map[string]*fenceRefresh
+	sync.Mutex
+}
+
+type fenceRefresh struct {
+	interval time.Duration
+	next     time.Time
+	// generation is the last seen generation of the fence, 0 if unknown
+	generation int64
+}
+
+func newRefreshScheduler(cfg *lazyloadv1alpha1.Fence) *refreshScheduler {
+	s := &refreshScheduler{min: defaultRefreshInterval, fences: map[string]*fenceRefresh{}}
+	ms := cfg.GetMetricSource()
+	if d, err := time.ParseDuration(ms.GetRefreshInterval()); err == nil && d > 0 {
+		s.min = d
+	}
+	s.max = s.min * defaultMaxRefreshIntervalTimes
+	if ar := ms.GetAdaptiveRefresh(); ar.GetEnable() {
+		s.adaptive = true
+		if d, err := time.ParseDuration(ar.GetMaxInterval()); err == nil && d >= s.min {
+			s.max = d
+		}
+	}
+	return s
+}
+
+// due returns whether the fence should be refreshed at now
+func (s *refreshScheduler) due(meta string, now time.Time) bool {
+	if !s.adaptive {
+		return true
+	}
+	s.Lock()
+	defer s.Unlock()
+	f := s.fences[meta]
+	// ticks come a little earlier than next, which is set after the query of last tick is done
+	return f == nil || !now.Add(s.min/2).Before(f.next)
+}
+
+// interval returns the refresh interval of the fence
+func (s *refreshScheduler) interval(meta string) time.Duration {
+	if !s.adaptive {
+		return s.min
+	}
+	s.Lock()
+	defer s.Unlock()
+	if f := s.fences[meta]; f != nil {
+		return f.interval
+	}
+	return s.min
+}
+
+// observe records the result of a refresh of the fence
+func (s *refreshScheduler) observe(meta string, changed bool, now time.Time) {
+	if !s.adaptive {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	f := s.fences[meta]
+	if f == nil {
+		f = &fenceRefresh{interval: s.min}
+		s.fences[meta] = f
+	} else if changed {
+		f.interval = s.min
+	} else if f.interval *= 2; f.interval > s.max {
+		f.interval = s.max
+	}
+	f.next = now.Add(f.interval)
+}
+
+// specChanged records generation of the fence and returns whether its spec changed since the last call.
+// Fences without schedule are due anyway, so they are never reported.
+func (s *refreshScheduler) specChanged(meta string, generation int64) bool {
+	if !s.adaptive {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	f := s.fences[meta]
+	if f == nil {
+		return false
+	}
+	changed := f.generation != 0 && f.generation != generation
+	f.generation = generation
+	return changed
+}
+
+// forget drops the schedule of a deleted fence
+func (s *refreshScheduler) forget(meta string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.fences, meta)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func adaptiveFence(interval, max string) *lazyloadv1alpha1.Fence {
+	return &lazyloadv1alpha1.Fence{MetricSource: &lazyloadv1alpha1.MetricSource{
+		Types:           []string{MetricSourceTypeAccesslog},
+		RefreshInterval: interval,
+		AdaptiveRefresh: &lazyloadv1alpha1.AdaptiveRefresh{Enable: true, MaxInterval: max},
+	}}
+}
+
+func TestRefreshSchedulerNotAdaptive(t *testing.T) {
+	s := newRefreshScheduler(&lazyloadv1alpha1.Fence{})
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		s.observe("default/reviews", false, now)
+		if !s.due("default/reviews", now) {
+			t.Fatalf("fence is not due on tick %d without adaptive refresh", i)
+		}
+	}
+	if len(s.fences) != 0 || s.specChanged("default/reviews", 2) {
+		t.Errorf("fences are tracked without adaptive refresh, %v", s.fences)
+	}
+}
+
+func TestRefreshSchedulerAdaptive(t *testing.T) {
+	const meta = "default/reviews"
+	s := newRefreshScheduler(adaptiveFence("10s", "35s"))
+	now := time.Unix(0, 0)
+	if !s.due(meta, now) {
+		t.Fatalf("unknown fence is not due")
+	}
+
+	// want is the interval of the fence after each observe
+	steps := []struct {
+		changed bool
+		want    time.Duration
+	}{
+		{false, 10 * time.Second}, // first refresh starts at min
+		{false, 20 * time.Second},
+		{false, 35 * time.Second}, // capped by max
+		{false, 35 * time.Second},
+		{true, 10 * time.Second},
+		{false, 20 * time.Second},
+	}
+	for i, step := range steps {
+		s.observe(meta, step.changed, now)
+		if got := s.fences[meta].interval; got != step.want {
+			t.Fatalf("step %d: interval %v, want %v", i, got, step.want)
+		}
+		// ticks up to min/2 earlier than next are accepted
+		if s.due(meta, now.Add(step.want-6*time.Second)) {
+			t.Errorf("step %d: fence is due before its interval", i)
+		}
+		if !s.due(meta, now.Add(step.want-5*time.Second)) {
+			t.Errorf("step %d: fence is not due at the tick before next", i)
+		}
+		now = now.Add(step.want)
+	}
+
+	s.forget(meta)
+	if !s.due(meta, now) || len(s.fences) != 0 {
+		t.Errorf("schedule of forgotten fence is kept, %v", s.fences)
+	}
+}
+
+func TestRefreshSchedulerDefaults(t *testing.T) {
+	s := newRefreshScheduler(adaptiveFence("", ""))
+	if s.min != defaultRefreshInterval || s.max != defaultRefreshInterval*defaultMaxRefreshIntervalTimes {
+		t.Errorf("min %v, max %v", s.min, s.max)
+	}
+	s = newRefreshScheduler(adaptiveFence("1m", "30s"))
+	if s.min != time.Minute || s.max != 10*time.Minute {
+		t.Errorf("max less than min should fall back to default, min %v, max %v", s.min, s.max)
+	}
+}
+
+func TestRefreshSchedulerSpecChanged(t *testing.T) {
+	const meta = "default/reviews"
+	s := newRefreshScheduler(adaptiveFence("10s", ""))
+	if s.specChanged(meta, 1) {
+		t.Errorf("fence without schedule is reported")
+	}
+	s.observe(meta, false, time.Now())
+	for i, c := range []struct {
+		generation int64
+		want       bool
+	}{{1, false}, {1, false}, {2, true}, {2, false}} {
+		if got := s.specChanged(meta, c.generation); got != c.want {
+			t.Errorf("call %d with generation %d = %v, want %v", i, c.generation, got, c.want)
+		}
+	}
+}
+
+func TestReconcileResetsRefreshOnSpecChange(t *testing.T) {
+	sf := testFence("default", "reviews")
+	sf.Generation = 1
+	r := newTestReconciler(t, adaptiveFence("10s", ""), sf)
+	nn := types.NamespacedName{Namespace: "default", Name: "reviews"}
+	meta := nn.String()
+	interval := func() time.Duration {
+		return r.refreshScheduler.fences[meta].interval
+	}
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		r.refreshScheduler.observe(meta, false, now)
+	}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: nn}); err != nil {
+		t.Fatal(err)
+	}
+	if got := interval(); got != 40*time.Second {
+		t.Fatalf("interval is reset without spec change, got %v", got)
+	}
+
+	got := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), nn, got); err != nil {
+		t.Fatal(err)
+	}
+	got.Spec.Enable = !got.Spec.Enable
+	got.Generation = 2
+	if err := r.Client.Update(context.TODO(), got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: nn}); err != nil {
+		t.Fatal(err)
+	}
+	if got := interval(); got != 10*time.Second {
+		t.Errorf("interval is not reset after spec change, got %v", got)
+	}
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"context"
 	stderrors "errors"
+	"reflect"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -13,15 +14,16 @@ import (
 	"slime.io/slime/framework/util"
 )
 
-func newSvcCache(clientSet *kubernetes.Clientset) (*NsSvcCache, *LabelSvcCache, error) {
+func newSvcCache(clientSet *kubernetes.Clientset) (*NsSvcCache, *LabelSvcCache, *PortSvcCache, error) {
 	log := log.WithField("function", "newLabelSvcCache")
 	nsSvcCache := &NsSvcCache{Data: map[string]map[string]struct{}{}}
 	labelSvcCache := &LabelSvcCache{Data: map[LabelItem]map[string]struct{}{}}
+	portSvcCache := &PortSvcCache{Data: map[string][]v1.ServicePort{}, Changed: make(chan struct{}, 1)}
 
 	// init labelSvcCache
 	services, err := clientSet.CoreV1().Services("").List(metav1.ListOptions{})
 	if err != nil {
-		return nil, nil, stderrors.New("failed to get service list")
+		return nil, nil, nil, stderrors.New("failed to get service list")
 	}
 
 	for _, service := range services.Items {
@@ -32,6 +34,7 @@ func newSvcCache(clientSet *kubernetes.Clientset) (*NsSvcCache, *LabelSvcCache,
 			nsSvcCache.Data[ns] = make(map[string]struct{})
 		}
 		nsSvcCache.Data[ns][svc] = struct{}{}
+		portSvcCache.Data[svc] = service.Spec.Ports
 		for k, v := range service.GetLabels() {
 			label := LabelItem{
 				Name:  k,
@@ -89,6 +92,7 @@ func newSvcCache(clientSet *kubernetes.Clientset) (*NsSvcCache, *LabelSvcCache,
 				nsSvcCache.Lock()
 				delete(nsSvcCache.Data[ns], eventSvc)
 				nsSvcCache.Unlock()
+				portSvcCache.update(eventSvc, nil)
 				// labelSvcCache already deleted, skip
 				continue
 			}
@@ -101,6 +105,7 @@ func newSvcCache(clientSet *kubernetes.Clientset) (*NsSvcCache, *LabelSvcCache,
 			}
 			nsSvcCache.Data[ns][eventSvc] = struct{}{}
 			nsSvcCache.Unlock()
+			portSvcCache.update(eventSvc, service.Spec.Ports)
 			// add eventSvc to labelSvcCache again
 			labelSvcCache.Lock()
 			for k, v := range service.GetLabels() {
@@ -118,5 +123,25 @@ func newSvcCache(clientSet *kubernetes.Clientset) (*NsSvcCache, *LabelSvcCache,
 		}
 	}()
 
-	return nsSvcCache, labelSvcCache, nil
+	return nsSvcCache, labelSvcCache, portSvcCache, nil
+}
+
+// update sets ports of svc, nil ports means svc is deleted
+func (c *PortSvcCache) update(svc string, ports []v1.ServicePort) {
+	c.Lock()
+	old, ok := c.Data[svc]
+	if ports == nil {
+		delete(c.Data, svc)
+	} else {
+		c.Data[svc] = ports
+	}
+	c.Unlock()
+
+	if ok == (ports != nil) && reflect.DeepEqual(old, ports) {
+		return
+	}
+	select {
+	case c.Changed <- struct{}{}:
+	default:
+	}
 }
@@ -19,7 +19,6 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -33,6 +32,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -52,6 +52,8 @@ import (
 // ServicefenceReconciler reconciles a Servicefence object
 type ServicefenceReconciler struct {
 	client.Client
+	// reader reads from the apiserver directly, nil means the client is used
+	reader               client.Reader
 	Scheme               *runtime.Scheme
 	cfg                  *lazyloadv1alpha1.Fence
 	env                  bootstrap.Environment
@@ -64,38 +66,77 @@ type ServicefenceReconciler struct {
 	enabledNamespaces    map[string]bool
 	nsSvcCache           *NsSvcCache
 	labelSvcCache        *LabelSvcCache
+	portSvcCache         *PortSvcCache
 	defaultAddNamespaces []string
 	doAliasRules         []*domainAliasRule
+	nsScope              *namespaceScope
+	// overrides caches the parsed override annotations of namespaces and fences
+	overrides overrideCache
+	// refreshScheduler decides which fences are queried on a ticker event
+	refreshScheduler *refreshScheduler
+	// recorder records events of servicefences
+	recorder     record.EventRecorder
+	statusLimits statusLimits
+	// truncations remembers what is truncated from status of fences to record events only on changes
+	truncations truncationCache
+	// queryTemplates holds the prometheus handler queries written in go template
+	queryTemplates map[string]*queryTemplate
+	// sidecarDebouncer delays and merges sidecar writes, nil if sidecars are written at once
+	sidecarDebouncer *sidecarDebouncer
+	// reporterTokens caches the reviewed tokens of global-sidecar reporting dependencies
+	reporterTokens reporterTokens
+	// globalSidecarLock serializes writes of global-sidecar resources, it is taken after reconcileLock if both are held
+	globalSidecarLock sync.Mutex
+	// skippedAutoPorts logs the auto wormhole ports skipped as reserved
+	skippedAutoPorts skippedPorts
+
+	ipCacheOnce   sync.Once
+	ipToSvcCache  map[string]string
+	svcToIpsCache map[string][]string
+	ipCacheLock   *sync.RWMutex
+	ipCacheErr    error
+
+	// globalSidecarReady records namespaces whose global-sidecar is ready in namespace mode
+	globalSidecarReady map[string]bool
+	// globalSidecarReadySeeded is true once globalSidecarReady is seeded by the existing deployments
+	globalSidecarReadySeeded bool
 }
 
 // NewReconciler returns a new reconcile.Reconciler
 func NewReconciler(cfg *lazyloadv1alpha1.Fence, mgr manager.Manager, env bootstrap.Environment) *ServicefenceReconciler {
 	log := modmodel.ModuleLog.WithField(model.LogFieldKeyFunction, "NewReconciler")
 
-	// generate producer config
-	pc, err := newProducerConfig(env)
-	if err != nil {
-		log.Errorf("%v", err)
-		return nil
-	}
-
 	r := &ServicefenceReconciler{
 		Client:               mgr.GetClient(),
+		reader:               mgr.GetAPIReader(),
 		Scheme:               mgr.GetScheme(),
 		env:                  env,
 		interestMeta:         map[string]bool{},
 		interestMetaCopy:     map[string]bool{},
-		watcherMetricChan:    pc.WatcherProducerConfig.MetricChan,
-		tickerMetricChan:     pc.TickerProducerConfig.MetricChan,
 		staleNamespaces:      map[string]bool{},
 		enabledNamespaces:    map[string]bool{},
 		defaultAddNamespaces: []string{env.Config.Global.IstioNamespace, env.Config.Global.SlimeNamespace},
 		doAliasRules:         newDomainAliasRules(cfg.DomainAliases),
+		nsScope:              newNamespaceScope(cfg.Namespace),
+		refreshScheduler:     newRefreshScheduler(cfg),
+		recorder:             mgr.GetEventRecorderFor("lazyload"),
+		statusLimits:         newStatusLimits(cfg.StatusLimit),
 		cfg:                  cfg,
+		globalSidecarReady:   map[string]bool{},
+	}
+	r.sidecarDebouncer = newSidecarDebouncer(cfg.SidecarUpdate, r.applyPendingSidecar)
+
+	// generate producer config
+	pc, source, err := r.newProducerConfig()
+	if err != nil {
+		log.Errorf("%v", err)
+		return nil
 	}
+	r.watcherMetricChan = pc.WatcherProducerConfig.MetricChan
+	r.tickerMetricChan = pc.TickerProducerConfig.MetricChan
 
 	// start service related cache
-	r.nsSvcCache, r.labelSvcCache, err = newSvcCache(env.K8SClient)
+	r.nsSvcCache, r.labelSvcCache, r.portSvcCache, err = newSvcCache(env.K8SClient)
 	if err != nil {
 		log.Errorf("init LabelSvcCache err: %v", err)
 		return nil
@@ -106,10 +147,10 @@ func NewReconciler(cfg *lazyloadv1alpha1.Fence, mgr manager.Manager, env bootstr
 	pc.TickerProducerConfig.NeedUpdateMetricHandler = r.handleTickerEvent
 
 	// start producer
-	metric.NewProducer(pc)
+	startProducers(pc, source)
 	log.Infof("producers starts")
 
-	if env.Config.Metric != nil || env.Config.Global.Misc["metricSourceType"] == MetricSourceTypeAccesslog {
+	if env.Config.Metric != nil || hasMetricSource(cfg, MetricSourceTypeAccesslog) {
 		go r.WatchMetric()
 	} else {
 		log.Warningf("watching metric is not running")
@@ -120,6 +161,11 @@ func NewReconciler(cfg *lazyloadv1alpha1.Fence, mgr manager.Manager, env bootstr
 
 // +kubebuilder:rbac:groups=microservice.slime.io,resources=servicefences,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=microservice.slime.io,resources=servicefences/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups="",resources=services;serviceaccounts;configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.istio.io,resources=envoyfilters;sidecars,verbs=get;list;watch;create;update;patch;delete
 
 func (r *ServicefenceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	_ = context.Background()
@@ -140,6 +186,12 @@ func (r *ServicefenceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error
 			// r.interestMeta.Pop(req.NamespacedName.String())
 			delete(r.interestMeta, req.NamespacedName.String())
 			r.updateInterestMetaCopy()
+			r.refreshScheduler.forget(req.NamespacedName.String())
+			r.forgetFenceOverride(req.NamespacedName)
+			r.truncations.forget(req.NamespacedName)
+			if r.sidecarDebouncer != nil {
+				r.sidecarDebouncer.forget(req.NamespacedName)
+			}
 			return r.refreshFenceStatusOfService(context.TODO(), nil, req.NamespacedName)
 		} else {
 			log.Errorf("get serviceFence error,%+v", err)
@@ -152,8 +204,17 @@ func (r *ServicefenceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error
 			req.NamespacedName, rev, r.env.IstioRev())
 		return reconcile.Result{}, nil
 	}
+	if !r.nsScope.contains(req.Namespace) {
+		log.Debugf("namespace of sf %v is not in scope, skip", req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
 	log.Infof("ServicefenceReconciler got serviceFence request, %+v", req.NamespacedName)
 
+	// a spec change may change the metric, so the fence is refreshed at the shortest interval again
+	if meta := req.NamespacedName.String(); r.refreshScheduler.specChanged(meta, instance.Generation) {
+		r.refreshScheduler.observe(meta, true, time.Now())
+	}
+
 	// 资源更新
 	diff := r.updateVisitedHostStatus(instance)
 	r.recordVisitor(instance, diff)
@@ -180,8 +241,17 @@ func (r *ServicefenceReconciler) getInterestMeta() map[string]bool {
 	return r.interestMetaCopy
 }
 
+// refreshSidecar writes the sidecar of instance, or schedules the write if sidecar updates are debounced
 func (r *ServicefenceReconciler) refreshSidecar(instance *lazyloadv1alpha1.ServiceFence) error {
-	log := log.WithField("reporter", "ServicefenceReconciler").WithField("function", "refreshSidecar")
+	if r.sidecarDebouncer == nil {
+		return r.applySidecar(instance)
+	}
+	r.sidecarDebouncer.schedule(types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}, r.sidecarDebouncer.now())
+	return nil
+}
+
+func (r *ServicefenceReconciler) applySidecar(instance *lazyloadv1alpha1.ServiceFence) error {
+	log := log.WithField("reporter", "ServicefenceReconciler").WithField("function", "applySidecar")
 	sidecar, err := r.newSidecar(instance, r.env)
 	if err != nil {
 		log.Errorf("servicefence generate sidecar failed, %+v", err)
@@ -197,11 +267,21 @@ func (r *ServicefenceReconciler) refreshSidecar(instance *lazyloadv1alpha1.Servi
 	}
 	sfRev := model.IstioRevFromLabel(instance.Labels)
 	model.PatchIstioRevLabel(&sidecar.Labels, sfRev)
+	merge := r.cfg.SidecarWriteMode == SidecarWriteModeMerge
+	if merge {
+		hosts, _ := sidecarEgressHosts(sidecar.Spec)
+		setManagedHosts(sidecar, hosts)
+	}
 
-	// Check if this Pod already exists
+	// Check if this Pod already exists. In merge mode, the sidecar is merged with the latest one, so the
+	// egress listeners of users are not overwritten by a stale one in cache
 	found := &v1alpha3.Sidecar{}
 	nsName := types.NamespacedName{Name: sidecar.Name, Namespace: sidecar.Namespace}
-	err = r.Client.Get(context.TODO(), nsName, found)
+	reader := client.Reader(r.Client)
+	if merge {
+		reader = r.apiReader()
+	}
+	err = reader.Get(context.TODO(), nsName, found)
 
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -212,26 +292,43 @@ func (r *ServicefenceReconciler) refreshSidecar(instance *lazyloadv1alpha1.Servi
 		}
 	}
 
-	if found == nil {
-		log.Infof("Creating a new Sidecar in %s:%s", sidecar.Namespace, sidecar.Name)
-		err = r.Client.Create(context.TODO(), sidecar)
-		if err != nil {
-			return err
+	if found != nil {
+		if rev := model.IstioRevFromLabel(found.Labels); rev != sfRev {
+			log.Infof("existed sidecar %v istioRev %s but our rev %s, skip update ...",
+				nsName, rev, sfRev)
+			return nil
 		}
-	} else if rev := model.IstioRevFromLabel(found.Labels); rev != sfRev {
-		log.Infof("existed sidecar %v istioRev %s but our rev %s, skip update ...",
-			nsName, rev, sfRev)
-	} else {
-		if !reflect.DeepEqual(found.Spec, sidecar.Spec) {
-			log.Infof("Update a Sidecar in %s:%s", sidecar.Namespace, sidecar.Name)
-			sidecar.ResourceVersion = found.ResourceVersion
-			err = r.Client.Update(context.TODO(), sidecar)
-			if err != nil {
-				return err
-			}
+		if merge {
+			// hosts added by users to the egress listener are kept
+			sidecar.Spec["egress"] = mergeSidecar(found, sidecar).Spec["egress"]
 		}
 	}
 
+	// lazyload only owns the fields it generates, the others are left to their own field managers
+	obj := sidecarApplyObject(sidecar, "workloadSelector", "egress")
+	opts := applyOptions
+	if merge {
+		// egress is owned as a whole, so the ownership of the listeners of users is not forced. The
+		// apply fails on conflicts if egress is changed in the meantime or owned by another manager.
+		opts = []client.PatchOption{client.FieldOwner(FieldManager)}
+		if found != nil {
+			obj.SetResourceVersion(found.ResourceVersion)
+		}
+	}
+	if err = r.Client.Patch(context.TODO(), obj, client.Apply, opts...); err != nil {
+		if merge && errors.IsConflict(err) {
+			log.Warningf("sidecar %v is changed or its egress is owned by other field managers, %v", nsName, err)
+		}
+		sidecarWritesTotal.WithLabelValues(sidecarWriteFailed).Inc()
+		return err
+	}
+	if found != nil && obj.GetResourceVersion() == found.ResourceVersion {
+		sidecarWritesTotal.WithLabelValues(sidecarWriteUnchanged).Inc()
+	} else {
+		log.Infof("Applied Sidecar in %s:%s", sidecar.Namespace, sidecar.Name)
+		sidecarWritesTotal.WithLabelValues(sidecarWriteApplied).Inc()
+	}
+
 	return nil
 }
 
@@ -242,8 +339,22 @@ func (r *ServicefenceReconciler) recordVisitor(sf *lazyloadv1alpha1.ServiceFence
 		if destSf == nil {
 			continue
 		}
-		destSf.Status.Visitor[sf.Namespace+"/"+sf.Name] = true
-		_ = r.Client.Status().Update(context.TODO(), destSf)
+		visitor := sf.Namespace + "/" + sf.Name
+		if destSf.Status.Visitor[visitor] {
+			continue
+		}
+		if len(destSf.Status.Visitor) >= r.statusLimits.visitors {
+			r.recordTruncated(destSf, "visitor "+visitor, []string{visitor},
+				fmt.Sprintf("visitor %s is not recorded, the limit is %d", visitor, r.statusLimits.visitors))
+			continue
+		}
+		r.recordTruncated(destSf, "visitor "+visitor, nil, "")
+		_ = r.updateFenceStatus(context.TODO(), destSf, func(destSf *lazyloadv1alpha1.ServiceFence) {
+			if destSf.Status.Visitor == nil {
+				destSf.Status.Visitor = make(map[string]bool)
+			}
+			destSf.Status.Visitor[visitor] = true
+		})
 	}
 
 	for _, delHost := range diff.Deleted {
@@ -251,8 +362,13 @@ func (r *ServicefenceReconciler) recordVisitor(sf *lazyloadv1alpha1.ServiceFence
 		if destSf == nil {
 			continue
 		}
-		delete(destSf.Status.Visitor, sf.Namespace+"/"+sf.Name)
-		_ = r.Client.Status().Update(context.TODO(), destSf)
+		visitor := sf.Namespace + "/" + sf.Name
+		if !destSf.Status.Visitor[visitor] {
+			continue
+		}
+		_ = r.updateFenceStatus(context.TODO(), destSf, func(destSf *lazyloadv1alpha1.ServiceFence) {
+			delete(destSf.Status.Visitor, visitor)
+		})
 	}
 }
 
@@ -262,6 +378,10 @@ func (r *ServicefenceReconciler) prepareDestFence(srcSf *lazyloadv1alpha1.Servic
 	if nsName == nil {
 		return nil
 	}
+	if !r.nsScope.contains(nsName.Namespace) {
+		// fences out of scope are neither created nor written
+		return nil
+	}
 
 	svc := &corev1.Service{}
 	if err := r.Client.Get(context.TODO(), *nsName, svc); err != nil {
@@ -311,7 +431,8 @@ func parseHost(sourceNs, h string) *types.NamespacedName {
 }
 
 func (r *ServicefenceReconciler) updateVisitedHostStatus(sf *lazyloadv1alpha1.ServiceFence) Diff {
-	domains := r.genDomains(sf, r.doAliasRules)
+	aliasRules := r.fenceSettings(sf).aliasRules
+	domains := r.genDomains(sf, aliasRules)
 
 	delta := Diff{
 		Deleted: make([]string, 0),
@@ -325,20 +446,29 @@ func (r *ServicefenceReconciler) updateVisitedHostStatus(sf *lazyloadv1alpha1.Se
 					Hosts:  dest.Hosts,
 					Status: lazyloadv1alpha1.Destinations_EXPIREWAIT,
 				}
-			} else {
-				// pending -> delete
-				delta.Deleted = append(delta.Deleted, k)
 			}
 		}
 	}
+	dropped := compactDomains(domains, r.statusLimits.domains, metricDomainCounts(sf, aliasRules))
+	r.recordTruncated(sf, "domains", dropped, fmt.Sprintf("%d domains are dropped, the limit is %d", len(dropped), r.statusLimits.domains))
+	for k := range sf.Status.Domains {
+		if _, ok := domains[k]; !ok {
+			// pending -> delete, or dropped by the limit
+			delta.Deleted = append(delta.Deleted, k)
+		}
+	}
 	for k := range domains {
 		if _, ok := sf.Status.Domains[k]; !ok {
 			delta.Added = append(delta.Added, k)
 		}
 	}
-	sf.Status.Domains = domains
-
-	_ = r.Client.Status().Update(context.TODO(), sf)
+	// the fields of status owned by the fence itself, others (visitor) are written by other fences
+	deps, metricStatus := sf.Status.MetricDependencies, sf.Status.MetricStatus
+	_ = r.updateFenceStatus(context.TODO(), sf, func(sf *lazyloadv1alpha1.ServiceFence) {
+		sf.Status.Domains = domains
+		sf.Status.MetricDependencies = deps
+		sf.Status.MetricStatus = metricStatus
+	})
 
 	return delta
 }
@@ -348,7 +478,7 @@ func (r *ServicefenceReconciler) genDomains(sf *lazyloadv1alpha1.ServiceFence, r
 
 	addDomainsWithHost(domains, sf, r.nsSvcCache, rules)
 	addDomainsWithLabelSelector(domains, sf, r.labelSvcCache, rules)
-	addDomainsWithMetricStatus(domains, sf, rules)
+	addDomainsWithMetricDependencies(domains, sf, rules)
 
 	return domains
 }
@@ -516,24 +646,11 @@ func addDomainsWithLabelSelector(domains map[string]*lazyloadv1alpha1.Destinatio
 	}
 }
 
-// update domains with Status.MetricStatus
-func addDomainsWithMetricStatus(domains map[string]*lazyloadv1alpha1.Destinations, sf *lazyloadv1alpha1.ServiceFence, rules []*domainAliasRule) {
-	for metricName := range sf.Status.MetricStatus {
-		metricName = strings.Trim(metricName, "{}")
-		if !strings.HasPrefix(metricName, "destination_service") && !strings.HasPrefix(metricName, "request_host") {
-			continue
-		}
-		// destination_service format like: "grafana.istio-system.svc.cluster.local"
-
-		var fullHost string
-		// trim ""
-		if ss := strings.Split(metricName, "\""); len(ss) != 3 {
-			continue
-		} else {
-			// remove port
-			fullHost = strings.SplitN(ss[1], ":", 2)[0]
-		}
-
+// update domains with the metric dependencies in status
+func addDomainsWithMetricDependencies(domains map[string]*lazyloadv1alpha1.Destinations, sf *lazyloadv1alpha1.ServiceFence, rules []*domainAliasRule) {
+	for _, dep := range fenceMetricDependencies(sf) {
+		// host format like: "grafana.istio-system.svc.cluster.local"
+		fullHost := dep.Host
 		if !isValidHost(fullHost) {
 			continue
 		}
@@ -571,11 +688,15 @@ func (r *ServicefenceReconciler) newSidecar(sf *lazyloadv1alpha1.ServiceFence, e
 	}
 
 	// check whether using namespace global-sidecar
-	// if so, init config of sidecar will adds */global-sidecar.${svf.ns}.svc.cluster.local
-	if env.Config.Global.Misc["globalSidecarMode"] == "namespace" {
-		hosts = append(hosts, fmt.Sprintf("*/global-sidecar.%s.svc.cluster.local", sf.Namespace))
+	// if so, init config of sidecar will adds */global-sidecar.${svf.ns}.svc.cluster.local,
+	// and waits for it to be ready if it is managed by controller
+	if r.cfg.GlobalSidecarMode == GlobalSidecarModeNamespace &&
+		(!r.namespaceGlobalSidecarManaged() || r.isGlobalSidecarReady(sf.Namespace)) {
+		hosts = append(hosts, fmt.Sprintf("*/%s.%s.svc.%s", GlobalSidecarName, sf.Namespace, r.cfg.ClusterDomain))
 	}
 
+	hosts = aggregateEgressHosts(hosts, r.cfg.EgressAggregation, r.cfg.ClusterDomain, r.nsSvcCache)
+
 	// remove duplicated hosts
 	noDupHosts := make([]string, 0, len(hosts))
 	temp := map[string]struct{}{}
@@ -686,50 +807,8 @@ func (r *ServicefenceReconciler) Subscribe(host string, destination interface{})
 
 		r.updateVisitedHostStatus(visitorSf)
 
-		sidecar, err := r.newSidecar(visitorSf, r.env)
-		if sidecar == nil {
-			continue
-		}
-		if err != nil {
-			return
-		}
-
-		// Set VisitedHost instance as the owner and controller
-		if err := controllerutil.SetControllerReference(visitorSf, sidecar, r.Scheme); err != nil {
-			return
-		}
-		model.PatchIstioRevLabel(&sidecar.Labels, visitorRev)
-
-		// Check for existence
-		found := &v1alpha3.Sidecar{}
-		nsName := types.NamespacedName{Name: sidecar.Name, Namespace: sidecar.Namespace}
-		err = r.Client.Get(context.TODO(), nsName, found)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				found = nil
-				err = nil
-			} else {
-				return
-			}
-		}
-
-		if found == nil {
-			err = r.Client.Create(context.TODO(), sidecar)
-			if err != nil {
-				log.Errorf("create sidecar %+v met err %v", sidecar, err)
-			}
-		} else if scRev := model.IstioRevFromLabel(found.Labels); scRev != visitorRev {
-			log.Infof("existing sidecar %v istioRev %s but our %s, skip ...",
-				nsName, scRev, visitorRev)
-		} else {
-			if !reflect.DeepEqual(found.Spec, sidecar.Spec) {
-				sidecar.ResourceVersion = found.ResourceVersion
-				err = r.Client.Update(context.TODO(), sidecar)
-
-				if err != nil {
-					log.Errorf("create sidecar %+v met err %v", sidecar, err)
-				}
-			}
+		if err := r.refreshSidecar(visitorSf); err != nil {
+			log.Errorf("refresh sidecar %s met err %v", k, err)
 		}
 		return
 	}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"slime.io/slime/framework/model"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+const (
+	defaultSidecarMaxDelayTimes = 10
+	// a failed sidecar write is retried after sidecarRetryDelay, which doubles on each failure up to
+	// maxSidecarRetryDelay
+	sidecarRetryDelay    = time.Second
+	maxSidecarRetryDelay = 5 * time.Minute
+
+	sidecarWriteApplied    = "applied"
+	sidecarWriteUnchanged  = "unchanged"
+	sidecarWriteSuppressed = "suppressed"
+	sidecarWriteFailed     = "failed"
+)
+
+var sidecarWritesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "lazyload",
+	Subsystem: "sidecar",
+	Name:      "writes_total",
+	Help: "Total number of sidecar refreshes by result. Suppressed ones are merged into a pending write, " +
+		"unchanged ones find the sidecar up to date.",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(sidecarWritesTotal)
+}
+
+// pendingSidecar is a sidecar write waiting for the end of debounce
+type pendingSidecar struct {
+	first time.Time
+	// stop stops the timer of the write
+	stop func() bool
+	// seq tells the timer set by the latest schedule from the stale ones
+	seq int
+}
+
+// sidecarDebouncer delays and merges the sidecar writes of fences, see SidecarUpdate
+type sidecarDebouncer struct {
+	debounce    time.Duration
+	maxDelay    time.Duration
+	minInterval time.Duration
+	// limiter limits the writes of all fences, nil if no limit
+	limiter *rate.Limiter
+	// apply writes the sidecar of a fence
+	apply func(types.NamespacedName) error
+	// now and afterFunc are time.Now and time.AfterFunc, replaced in tests
+	now       func() time.Time
+	afterFunc func(time.Duration, func()) (stop func() bool)
+
+	sync.Mutex
+	pending     map[types.NamespacedName]*pendingSidecar
+	lastApplied map[types.NamespacedName]time.Time
+	// failures counts the successive failed writes of fences
+	failures map[types.NamespacedName]*sidecarFailure
+}
+
+// sidecarFailure is the backoff of a fence whose sidecar write failed
+type sidecarFailure struct {
+	count   int
+	retryAt time.Time
+}
+
+// newSidecarDebouncer returns nil if SidecarUpdate is not configured, which means sidecars are written at once.
+// The durations in cfg should have been validated.
+func newSidecarDebouncer(cfg *lazyloadv1alpha1.SidecarUpdate, apply func(types.NamespacedName) error) *sidecarDebouncer {
+	if cfg == nil {
+		return nil
+	}
+	parse := func(s string) time.Duration {
+		if s == "" {
+			return 0
+		}
+		d, _ := time.ParseDuration(s)
+		return d
+	}
+	d := &sidecarDebouncer{
+		debounce:    parse(cfg.Debounce),
+		maxDelay:    parse(cfg.MaxDelay),
+		minInterval: parse(cfg.MinInterval),
+		apply:       apply,
+		now:         time.Now,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+		pending:     map[types.NamespacedName]*pendingSidecar{},
+		lastApplied: map[types.NamespacedName]time.Time{},
+		failures:    map[types.NamespacedName]*sidecarFailure{},
+	}
+	if d.maxDelay == 0 {
+		d.maxDelay = defaultSidecarMaxDelayTimes * d.debounce
+	}
+	if cfg.Qps > 0 {
+		burst := int(cfg.Burst)
+		if burst == 0 {
+			burst = 1
+		}
+		d.limiter = rate.NewLimiter(rate.Limit(cfg.Qps), burst)
+	}
+	if d.debounce == 0 && d.minInterval == 0 && d.limiter == nil {
+		return nil
+	}
+	return d
+}
+
+// schedule delays the sidecar write of nn to debounce after now, but no later than maxDelay after the first
+// pending change, and no earlier than minInterval after the last write or the backoff of the last failure.
+// A change made while a write of nn is pending is merged into it.
+func (d *sidecarDebouncer) schedule(nn types.NamespacedName, now time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	p := d.pending[nn]
+	if p != nil {
+		sidecarWritesTotal.WithLabelValues(sidecarWriteSuppressed).Inc()
+		p.stop()
+	} else {
+		p = &pendingSidecar{first: now}
+		d.pending[nn] = p
+	}
+
+	at := now.Add(d.debounce)
+	if deadline := p.first.Add(d.maxDelay); at.After(deadline) {
+		at = deadline
+	}
+	if last, ok := d.lastApplied[nn]; ok && at.Before(last.Add(d.minInterval)) {
+		at = last.Add(d.minInterval)
+	}
+	if f := d.failures[nn]; f != nil && at.Before(f.retryAt) {
+		at = f.retryAt
+	}
+
+	p.seq++
+	seq := p.seq
+	p.stop = d.afterFunc(at.Sub(now), func() { d.fire(nn, p, seq) })
+}
+
+func (d *sidecarDebouncer) fire(nn types.NamespacedName, p *pendingSidecar, seq int) {
+	d.Lock()
+	if d.pending[nn] != p || p.seq != seq {
+		// rescheduled or forgotten
+		d.Unlock()
+		return
+	}
+	delete(d.pending, nn)
+	d.Unlock()
+
+	if d.limiter != nil {
+		_ = d.limiter.Wait(context.Background())
+	}
+	err := d.apply(nn)
+
+	now := d.now()
+	d.Lock()
+	d.lastApplied[nn] = now
+	if err == nil || !isRetriableError(err) {
+		delete(d.failures, nn)
+		d.Unlock()
+		if err != nil {
+			log.Errorf("write sidecar of %v met err: %v, not retriable, wait for the next change", nn, err)
+		}
+		return
+	}
+	f := d.failures[nn]
+	if f == nil {
+		f = &sidecarFailure{}
+		d.failures[nn] = f
+	}
+	f.count++
+	backoff := maxSidecarRetryDelay
+	if shift := uint(f.count - 1); shift < 16 && sidecarRetryDelay<<shift < maxSidecarRetryDelay {
+		backoff = sidecarRetryDelay << shift
+	}
+	f.retryAt = now.Add(backoff)
+	d.Unlock()
+
+	log.Errorf("write sidecar of %v met err: %v, retry in %v", nn, err, backoff)
+	d.schedule(nn, now)
+}
+
+// isRetriableError returns false if the write would fail again without a change of the sidecar or the cluster
+func isRetriableError(err error) bool {
+	return !errors.IsForbidden(err) && !errors.IsUnauthorized(err) && !errors.IsInvalid(err) &&
+		!errors.IsBadRequest(err) && !errors.IsMethodNotSupported(err) && !meta.IsNoMatchError(err)
+}
+
+// forget drops the pending write and history of a deleted fence
+func (d *sidecarDebouncer) forget(nn types.NamespacedName) {
+	d.Lock()
+	defer d.Unlock()
+	if p := d.pending[nn]; p != nil {
+		p.stop()
+		delete(d.pending, nn)
+	}
+	delete(d.lastApplied, nn)
+	delete(d.failures, nn)
+}
+
+// applyPendingSidecar writes the sidecar of the latest servicefence nn, it's called when a debounced write fires
+func (r *ServicefenceReconciler) applyPendingSidecar(nn types.NamespacedName) error {
+	r.reconcileLock.Lock()
+	defer r.reconcileLock.Unlock()
+
+	sf := &lazyloadv1alpha1.ServiceFence{}
+	if err := r.Client.Get(context.TODO(), nn, sf); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if rev := model.IstioRevFromLabel(sf.Labels); !r.env.RevInScope(rev) || !sf.Spec.Enable {
+		return nil
+	}
+	return r.applySidecar(sf)
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// fakeClock fires the timers of a debouncer synchronously when it steps
+type fakeClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at   time.Time
+	f    func()
+	done bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.Lock()
+	defer c.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.Lock()
+		defer c.Unlock()
+		active := !t.done
+		t.done = true
+		return active
+	}
+}
+
+// step moves the clock d forward and fires the timers due in order
+func (c *fakeClock) step(d time.Duration) {
+	c.Lock()
+	end := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if !t.done && !t.at.After(end) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		next.done = true
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.Unlock()
+		next.f()
+		c.Lock()
+	}
+	c.now = end
+	c.Unlock()
+}
+
+// sidecarWrites records the writes of a debouncer in time since start, the first len(errs) writes fail
+type sidecarWrites struct {
+	clock *fakeClock
+	start time.Time
+	errs  []error
+
+	sync.Mutex
+	times []time.Duration
+}
+
+func (w *sidecarWrites) apply(types.NamespacedName) error {
+	w.Lock()
+	defer w.Unlock()
+	w.times = append(w.times, w.clock.Now().Sub(w.start))
+	if n := len(w.times); n <= len(w.errs) {
+		return w.errs[n-1]
+	}
+	return nil
+}
+
+func (w *sidecarWrites) written() []time.Duration {
+	w.Lock()
+	defer w.Unlock()
+	return append([]time.Duration(nil), w.times...)
+}
+
+func newTestDebouncer(t *testing.T, cfg *lazyloadv1alpha1.SidecarUpdate, errs ...error) (*sidecarDebouncer, *fakeClock, *sidecarWrites) {
+	t.Helper()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	w := &sidecarWrites{clock: clock, start: clock.now, errs: errs}
+	d := newSidecarDebouncer(cfg, w.apply)
+	if d == nil {
+		t.Fatalf("no debouncer for %+v", cfg)
+	}
+	d.now, d.afterFunc = clock.Now, clock.AfterFunc
+	return d, clock, w
+}
+
+var debouncedFence = types.NamespacedName{Namespace: "default", Name: "reviews"}
+
+func TestSidecarDebouncerDisabled(t *testing.T) {
+	if d := newSidecarDebouncer(nil, nil); d != nil {
+		t.Errorf("got debouncer without config")
+	}
+	if d := newSidecarDebouncer(&lazyloadv1alpha1.SidecarUpdate{Burst: 3}, nil); d != nil {
+		t.Errorf("got debouncer without debounce, minInterval or qps")
+	}
+}
+
+func TestSidecarDebouncerMergesChanges(t *testing.T) {
+	d, clock, w := newTestDebouncer(t, &lazyloadv1alpha1.SidecarUpdate{Debounce: "100ms"})
+	for i := 0; i < 5; i++ {
+		d.schedule(debouncedFence, clock.Now())
+		clock.step(10 * time.Millisecond)
+	}
+	clock.step(time.Second)
+	if got, want := w.written(), []time.Duration{140 * time.Millisecond}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes at %v, want changes merged into %v", got, want)
+	}
+}
+
+func TestSidecarDebouncerMaxDelay(t *testing.T) {
+	d, clock, w := newTestDebouncer(t, &lazyloadv1alpha1.SidecarUpdate{Debounce: "100ms", MaxDelay: "150ms"})
+	for i := 0; i < 20; i++ {
+		d.schedule(debouncedFence, clock.Now())
+		clock.step(20 * time.Millisecond)
+	}
+	// the first pending change of the second write is at 160ms
+	if got, want := w.written(), []time.Duration{150 * time.Millisecond, 310 * time.Millisecond}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes at %v under continuous changes, want %v", got, want)
+	}
+}
+
+func TestSidecarDebouncerMinInterval(t *testing.T) {
+	d, clock, w := newTestDebouncer(t, &lazyloadv1alpha1.SidecarUpdate{MinInterval: "200ms"})
+	d.schedule(debouncedFence, clock.Now())
+	clock.step(50 * time.Millisecond)
+	d.schedule(debouncedFence, clock.Now())
+	clock.step(time.Second)
+	if got, want := w.written(), []time.Duration{0, 200 * time.Millisecond}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes at %v, want %v", got, want)
+	}
+}
+
+func TestSidecarDebouncerRetryBackoff(t *testing.T) {
+	unavailable := errors.NewServiceUnavailable("apiserver is down")
+	d, clock, w := newTestDebouncer(t, &lazyloadv1alpha1.SidecarUpdate{Debounce: "10ms"},
+		unavailable, unavailable, unavailable)
+	d.schedule(debouncedFence, clock.Now())
+	clock.step(10 * time.Second)
+
+	want := []time.Duration{
+		10 * time.Millisecond,
+		10*time.Millisecond + sidecarRetryDelay,
+		10*time.Millisecond + 3*sidecarRetryDelay,
+		10*time.Millisecond + 7*sidecarRetryDelay,
+	}
+	if got := w.written(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes at %v, want %v", got, want)
+	}
+	if len(d.failures) != 0 || len(d.pending) != 0 {
+		t.Errorf("failures %v, pending %v are left after the write succeeds", d.failures, d.pending)
+	}
+}
+
+func TestSidecarDebouncerMaxRetryDelay(t *testing.T) {
+	errs := make([]error, 20)
+	for i := range errs {
+		errs[i] = fmt.Errorf("connection refused")
+	}
+	d, clock, w := newTestDebouncer(t, &lazyloadv1alpha1.SidecarUpdate{Debounce: "10ms"}, errs...)
+	d.schedule(debouncedFence, clock.Now())
+	clock.step(24 * time.Hour)
+
+	times := w.written()
+	if len(times) != len(errs)+1 {
+		t.Fatalf("got %d writes, want %d", len(times), len(errs)+1)
+	}
+	if gap := times[len(times)-1] - times[len(times)-2]; gap != maxSidecarRetryDelay {
+		t.Errorf("got retry delay %v, want it capped at %v", gap, maxSidecarRetryDelay)
+	}
+}
+
+func TestSidecarDebouncerStopsOnNonRetriableError(t *testing.T) {
+	gr := schema.GroupResource{Group: "networking.istio.io", Resource: "sidecars"}
+	for _, err := range []error{
+		errors.NewForbidden(gr, "reviews", fmt.Errorf("rbac")),
+		errors.NewInvalid(schema.GroupKind{Group: "networking.istio.io", Kind: "Sidecar"}, "reviews", nil),
+		errors.NewBadRequest("bad"),
+	} {
+		d, clock, w := newTestDebouncer(t, &lazyloadv1alpha1.SidecarUpdate{Debounce: "10ms"}, err, err)
+		d.schedule(debouncedFence, clock.Now())
+		clock.step(time.Hour)
+		if n := len(w.written()); n != 1 {
+			t.Errorf("%v: got %d writes, want no retry", err, n)
+		}
+		if len(d.failures) != 0 || len(d.pending) != 0 {
+			t.Errorf("%v: failures %v, pending %v are left", err, d.failures, d.pending)
+		}
+
+		// the next change is written again
+		d.schedule(debouncedFence, clock.Now())
+		clock.step(time.Hour)
+		if n := len(w.written()); n != 2 {
+			t.Errorf("%v: got %d writes after the next change, want 2", err, n)
+		}
+	}
+}
+
+func TestSidecarDebouncerForget(t *testing.T) {
+	d, clock, w := newTestDebouncer(t, &lazyloadv1alpha1.SidecarUpdate{Debounce: "10ms"}, fmt.Errorf("connection refused"))
+	d.schedule(debouncedFence, clock.Now())
+	clock.step(20 * time.Millisecond)
+	d.forget(debouncedFence)
+	clock.step(time.Hour)
+	if n := len(w.written()); n != 1 {
+		t.Errorf("got %d writes, want the retry of forgotten fence dropped", n)
+	}
+	if len(d.failures) != 0 || len(d.lastApplied) != 0 {
+		t.Errorf("failures %v, lastApplied %v of forgotten fence are kept", d.failures, d.lastApplied)
+	}
+}
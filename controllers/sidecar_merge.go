@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"slime.io/slime/framework/apis/networking/v1alpha3"
+)
+
+const (
+	SidecarWriteModeReplace = "replace"
+	SidecarWriteModeMerge   = "merge"
+
+	// AnnotationLazyloadManagedHosts records the egress hosts written by lazyload on a sidecar in merge mode,
+	// so that they can be told from the ones added by users
+	AnnotationLazyloadManagedHosts = "slime.io/lazyloadManagedHosts"
+)
+
+// sidecarEgressHosts returns the hosts of the egress listener without port in a sidecar spec, which is
+// the one generated by lazyload, and the index of the listener or -1 if not found
+func sidecarEgressHosts(spec map[string]interface{}) ([]string, int) {
+	listeners, _ := spec["egress"].([]interface{})
+	for i, item := range listeners {
+		listener, ok := item.(map[string]interface{})
+		if !ok || listener["port"] != nil {
+			continue
+		}
+		var hosts []string
+		items, _ := listener["hosts"].([]interface{})
+		for _, h := range items {
+			if s, ok := h.(string); ok {
+				hosts = append(hosts, s)
+			}
+		}
+		return hosts, i
+	}
+	return nil, -1
+}
+
+// setManagedHosts records hosts as the ones written by lazyload on sidecar
+func setManagedHosts(sidecar *v1alpha3.Sidecar, hosts []string) {
+	b, _ := json.Marshal(hosts)
+	if sidecar.Annotations == nil {
+		sidecar.Annotations = map[string]string{}
+	}
+	sidecar.Annotations[AnnotationLazyloadManagedHosts] = string(b)
+}
+
+// managedHosts returns the hosts written by lazyload on sidecar, false if they are not recorded
+func managedHosts(sidecar *v1alpha3.Sidecar) ([]string, bool) {
+	raw, ok := sidecar.Annotations[AnnotationLazyloadManagedHosts]
+	if !ok {
+		return nil, false
+	}
+	var hosts []string
+	if err := json.Unmarshal([]byte(raw), &hosts); err != nil {
+		log.Warningf("invalid %s annotation of sidecar %s/%s, %+v", AnnotationLazyloadManagedHosts,
+			sidecar.Namespace, sidecar.Name, err)
+		return nil, false
+	}
+	return hosts, true
+}
+
+// mergeSidecar merges the generated sidecar into the found one and returns the result, found is not modified.
+// The workload selector and the egress hosts written by lazyload last time are replaced by the generated ones,
+// while the hosts added by users to the egress listener without port, the other egress listeners, ingress,
+// outboundTrafficPolicy and metadata of found are kept. If the hosts written by lazyload are not recorded,
+// which means found was written in replace mode, all hosts of the listener are regarded as written by lazyload.
+func mergeSidecar(found, generated *v1alpha3.Sidecar) *v1alpha3.Sidecar {
+	merged := found.DeepCopy()
+	merged.Spec = runtime.DeepCopyJSON(found.Spec)
+	if merged.Spec == nil {
+		merged.Spec = map[string]interface{}{}
+	}
+
+	genHosts, _ := sidecarEgressHosts(generated.Spec)
+	curHosts, idx := sidecarEgressHosts(merged.Spec)
+	prevHosts, ok := managedHosts(found)
+	if !ok {
+		prevHosts = curHosts
+	}
+	prev := make(map[string]bool, len(prevHosts))
+	for _, h := range prevHosts {
+		prev[h] = true
+	}
+
+	seen := map[string]bool{}
+	var hosts []string
+	for _, h := range genHosts {
+		if !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	for _, h := range curHosts {
+		if !prev[h] && !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	sort.Strings(hosts)
+	hostItems := make([]interface{}, 0, len(hosts))
+	for _, h := range hosts {
+		hostItems = append(hostItems, h)
+	}
+
+	listeners, _ := merged.Spec["egress"].([]interface{})
+	if idx < 0 {
+		listeners = append(listeners, map[string]interface{}{"hosts": hostItems})
+	} else {
+		listeners[idx].(map[string]interface{})["hosts"] = hostItems
+	}
+	merged.Spec["egress"] = listeners
+	merged.Spec["workloadSelector"] = runtime.DeepCopyJSONValue(generated.Spec["workloadSelector"])
+
+	for k, v := range generated.Labels {
+		if merged.Labels == nil {
+			merged.Labels = map[string]string{}
+		}
+		merged.Labels[k] = v
+	}
+	setManagedHosts(merged, genHosts)
+	return merged
+}
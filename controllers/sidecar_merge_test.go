@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"slime.io/slime/framework/apis/networking/v1alpha3"
+)
+
+func sidecarOf(spec map[string]interface{}) *v1alpha3.Sidecar {
+	return &v1alpha3.Sidecar{
+		ObjectMeta: metav1.ObjectMeta{Name: "reviews", Namespace: "default"},
+		Spec:       spec,
+	}
+}
+
+func generatedSidecar(hosts ...interface{}) *v1alpha3.Sidecar {
+	return sidecarOf(map[string]interface{}{
+		"workloadSelector": map[string]interface{}{"labels": map[string]interface{}{"app": "reviews"}},
+		"egress":           []interface{}{map[string]interface{}{"hosts": hosts}},
+	})
+}
+
+func TestMergeSidecar(t *testing.T) {
+	ingress := []interface{}{map[string]interface{}{
+		"port":            map[string]interface{}{"number": float64(9080), "protocol": "HTTP", "name": "http"},
+		"defaultEndpoint": "127.0.0.1:9080",
+	}}
+	extraListener := map[string]interface{}{
+		"port":  map[string]interface{}{"number": float64(3306), "protocol": "TCP", "name": "mysql"},
+		"hosts": []interface{}{"db/*"},
+	}
+	found := sidecarOf(map[string]interface{}{
+		"workloadSelector":      map[string]interface{}{"labels": map[string]interface{}{"app": "reviews"}},
+		"ingress":               ingress,
+		"outboundTrafficPolicy": map[string]interface{}{"mode": "REGISTRY_ONLY"},
+		"egress": []interface{}{
+			extraListener,
+			map[string]interface{}{"hosts": []interface{}{"*/old.default.svc.cluster.local", "istio-system/*", "*/user.example.com"}},
+		},
+	})
+	found.Annotations = map[string]string{
+		AnnotationLazyloadManagedHosts: `["*/old.default.svc.cluster.local","istio-system/*"]`,
+		"team":                         "reviews",
+	}
+
+	merged := mergeSidecar(found, generatedSidecar("*/new.default.svc.cluster.local", "istio-system/*"))
+
+	if !reflect.DeepEqual(merged.Spec["ingress"], ingress) ||
+		!reflect.DeepEqual(merged.Spec["outboundTrafficPolicy"], map[string]interface{}{"mode": "REGISTRY_ONLY"}) {
+		t.Errorf("user managed fields are not kept, got %v", merged.Spec)
+	}
+	egress := merged.Spec["egress"].([]interface{})
+	if len(egress) != 2 || !reflect.DeepEqual(egress[0], extraListener) {
+		t.Fatalf("got egress %v, want the extra listener kept", egress)
+	}
+	wantHosts := []interface{}{"*/new.default.svc.cluster.local", "*/user.example.com", "istio-system/*"}
+	if got := egress[1].(map[string]interface{})["hosts"]; !reflect.DeepEqual(got, wantHosts) {
+		t.Errorf("got hosts %v, want %v", got, wantHosts)
+	}
+	if got := merged.Annotations[AnnotationLazyloadManagedHosts]; got != `["*/new.default.svc.cluster.local","istio-system/*"]` {
+		t.Errorf("got managed hosts %s", got)
+	}
+	if merged.Annotations["team"] != "reviews" {
+		t.Errorf("user annotation is not kept")
+	}
+	if hosts, _ := sidecarEgressHosts(found.Spec); len(hosts) != 3 {
+		t.Errorf("found sidecar is modified, got hosts %v", hosts)
+	}
+}
+
+func TestMergeSidecarWrittenInReplaceMode(t *testing.T) {
+	found := generatedSidecar("*/old.default.svc.cluster.local", "istio-system/*")
+	found.Spec["ingress"] = []interface{}{map[string]interface{}{"defaultEndpoint": "127.0.0.1:9080"}}
+
+	merged := mergeSidecar(found, generatedSidecar("*/new.default.svc.cluster.local"))
+	hosts, _ := sidecarEgressHosts(merged.Spec)
+	if !reflect.DeepEqual(hosts, []string{"*/new.default.svc.cluster.local"}) {
+		t.Errorf("got hosts %v, want the hosts written in replace mode replaced", hosts)
+	}
+	if merged.Spec["ingress"] == nil {
+		t.Errorf("ingress is not kept")
+	}
+}
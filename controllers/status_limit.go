@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+const (
+	defaultMaxStatusEntries = 1000
+
+	// EventReasonStatusTruncated is the reason of events recorded when status of a servicefence is truncated
+	EventReasonStatusTruncated = "StatusTruncated"
+)
+
+// statusLimits is the resolved StatusLimit
+type statusLimits struct {
+	metricDependencies int
+	domains            int
+	visitors           int
+}
+
+func newStatusLimits(cfg *lazyloadv1alpha1.StatusLimit) statusLimits {
+	orDefault := func(v uint32) int {
+		if v == 0 {
+			return defaultMaxStatusEntries
+		}
+		return int(v)
+	}
+	return statusLimits{
+		metricDependencies: orDefault(cfg.GetMaxMetricDependencies()),
+		domains:            orDefault(cfg.GetMaxDomains()),
+		visitors:           orDefault(cfg.GetMaxVisitors()),
+	}
+}
+
+// compactMetricDependencies keeps at most max dependencies. Dependencies of the same host are aggregated
+// into one with port 0 first, then the ones with the smallest counts are dropped. The input is not modified.
+func compactMetricDependencies(deps []*lazyloadv1alpha1.MetricDependency, max int) ([]*lazyloadv1alpha1.MetricDependency, bool) {
+	if len(deps) <= max {
+		return deps, false
+	}
+
+	byHost := map[string]*lazyloadv1alpha1.MetricDependency{}
+	var ret []*lazyloadv1alpha1.MetricDependency
+	for _, dep := range deps {
+		agg := byHost[dep.Host]
+		if agg == nil {
+			agg = dep.DeepCopy()
+			byHost[dep.Host] = agg
+			ret = append(ret, agg)
+			continue
+		}
+		agg.Port = 0
+		agg.Count += dep.Count
+		if agg.Protocol != dep.Protocol {
+			agg.Protocol = ""
+		}
+		if dep.LastSeen != nil && (agg.LastSeen == nil || dep.LastSeen.Seconds > agg.LastSeen.Seconds) {
+			agg.LastSeen = dep.LastSeen
+		}
+		for _, s := range dep.Sources {
+			if !stringsContains(agg.Sources, s) {
+				agg.Sources = append(agg.Sources, s)
+			}
+		}
+	}
+
+	if len(ret) > max {
+		sort.SliceStable(ret, func(i, j int) bool {
+			if ret[i].Count != ret[j].Count {
+				return ret[i].Count > ret[j].Count
+			}
+			return ret[i].GetLastSeen().GetSeconds() > ret[j].GetLastSeen().GetSeconds()
+		})
+		ret = ret[:max]
+	}
+	// mergeMetricDependencies sorts them again
+	return mergeMetricDependencies(ret), true
+}
+
+// compactDomains drops the domains beyond max and returns the dropped keys. Expired domains are dropped
+// first, then the ones waiting to expire, then the active ones from metric with the smallest counts.
+// Domains not from metric, whose keys are not in counts, are kept before the ones from metric.
+func compactDomains(domains map[string]*lazyloadv1alpha1.Destinations, max int, counts map[string]float64) []string {
+	if len(domains) <= max {
+		return nil
+	}
+
+	rank := func(s lazyloadv1alpha1.Destinations_Status) int {
+		switch s {
+		case lazyloadv1alpha1.Destinations_ACTIVE:
+			return 0
+		case lazyloadv1alpha1.Destinations_EXPIREWAIT:
+			return 1
+		default:
+			return 2
+		}
+	}
+	keys := make([]string, 0, len(domains))
+	for k := range domains {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank(domains[keys[i]].Status), rank(domains[keys[j]].Status)
+		if ri != rj {
+			return ri < rj
+		}
+		ci, fromMetricI := counts[keys[i]]
+		cj, fromMetricJ := counts[keys[j]]
+		if fromMetricI != fromMetricJ {
+			return !fromMetricI
+		}
+		if ci != cj {
+			return ci > cj
+		}
+		return keys[i] < keys[j]
+	})
+
+	dropped := keys[max:]
+	for _, k := range dropped {
+		delete(domains, k)
+	}
+	return dropped
+}
+
+// metricDomainCounts returns the counts of domains from the metric dependencies of sf
+func metricDomainCounts(sf *lazyloadv1alpha1.ServiceFence, rules []*domainAliasRule) map[string]float64 {
+	counts := map[string]float64{}
+	for _, dep := range fenceMetricDependencies(sf) {
+		for _, fh := range domainAddAlias(dep.Host, rules) {
+			if c, ok := counts[fh]; !ok || dep.Count > c {
+				counts[fh] = dep.Count
+			}
+		}
+	}
+	return counts
+}
+
+// setFenceMetricDependencies compacts deps with the reported dependencies still alive and sets them to
+// status of sf, see setMetricDependencies
+func (r *ServicefenceReconciler) setFenceMetricDependencies(sf *lazyloadv1alpha1.ServiceFence, deps []*lazyloadv1alpha1.MetricDependency) bool {
+	now := time.Now()
+	deps = keepReportedDependencies(sf, deps, now)
+	compacted, truncated := compactMetricDependencies(deps, r.statusLimits.metricDependencies)
+	var dropped []string
+	if truncated {
+		kept := map[string]bool{}
+		for _, dep := range compacted {
+			kept[net.JoinHostPort(dep.Host, strconv.Itoa(int(dep.Port)))] = true
+		}
+		for _, dep := range deps {
+			if k := net.JoinHostPort(dep.Host, strconv.Itoa(int(dep.Port))); !kept[k] {
+				dropped = append(dropped, k)
+			}
+		}
+	}
+	r.recordTruncated(sf, "metricDependencies", dropped, fmt.Sprintf("%d metric dependencies are compacted to %d, the limit is %d",
+		len(deps), len(compacted), r.statusLimits.metricDependencies))
+	return setMetricDependencies(sf, compacted, now)
+}
+
+// recordTruncated records the entries of field truncated from status of sf, and records an event with msg
+// if they change. Empty truncated means field is not truncated any more.
+func (r *ServicefenceReconciler) recordTruncated(sf *lazyloadv1alpha1.ServiceFence, field string, truncated []string, msg string) {
+	nn := types.NamespacedName{Namespace: sf.Namespace, Name: sf.Name}
+	if !r.truncations.set(nn, field, truncated) || len(truncated) == 0 {
+		return
+	}
+	log.Warningf("status of servicefence %s/%s is truncated, %s", sf.Namespace, sf.Name, msg)
+	if r.recorder != nil {
+		r.recorder.Event(sf, corev1.EventTypeWarning, EventReasonStatusTruncated, msg)
+	}
+}
+
+// truncationCache remembers the entries truncated from each status field of fences, so that an event is
+// recorded when they change instead of on every refresh
+type truncationCache struct {
+	data map[types.NamespacedName]map[string]string
+	sync.Mutex
+}
+
+// set records the truncated entries of field of fence nn and returns whether they change. Empty entries
+// removes the record.
+func (c *truncationCache) set(nn types.NamespacedName, field string, entries []string) bool {
+	sorted := append([]string{}, entries...)
+	sort.Strings(sorted)
+	joined := strings.Join(sorted, ",")
+
+	c.Lock()
+	defer c.Unlock()
+	old, ok := c.data[nn][field]
+	if len(entries) == 0 {
+		if ok {
+			delete(c.data[nn], field)
+			if len(c.data[nn]) == 0 {
+				delete(c.data, nn)
+			}
+		}
+		return ok
+	}
+	if ok && old == joined {
+		return false
+	}
+	if c.data == nil {
+		c.data = map[types.NamespacedName]map[string]string{}
+	}
+	if c.data[nn] == nil {
+		c.data[nn] = map[string]string{}
+	}
+	c.data[nn][field] = joined
+	return true
+}
+
+// forget drops the records of a deleted fence
+func (c *truncationCache) forget(nn types.NamespacedName) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.data, nn)
+}
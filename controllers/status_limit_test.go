@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+// etcdRequestLimit is the default max request size of etcd
+const etcdRequestLimit = 1536 * 1024
+
+func largeMetricDependencies(hosts, portsPerHost int) []*lazyloadv1alpha1.MetricDependency {
+	var deps []*lazyloadv1alpha1.MetricDependency
+	for i := 0; i < hosts; i++ {
+		for p := 0; p < portsPerHost; p++ {
+			deps = append(deps, &lazyloadv1alpha1.MetricDependency{
+				Host:     fmt.Sprintf("callee-%05d.some-long-namespace-name.svc.cluster.local", i),
+				Port:     uint32(8000 + p),
+				Protocol: "http",
+				Count:    float64(i + 1),
+				Sources:  []string{MetricSourceTypePrometheus},
+			})
+		}
+	}
+	return deps
+}
+
+func TestCompactMetricDependenciesWithinLimit(t *testing.T) {
+	deps := largeMetricDependencies(10, 2)
+	got, truncated := compactMetricDependencies(deps, 20)
+	if truncated || len(got) != 20 {
+		t.Errorf("got %d dependencies truncated %v, want 20 untouched", len(got), truncated)
+	}
+}
+
+func TestCompactMetricDependenciesAggregatesPorts(t *testing.T) {
+	deps := largeMetricDependencies(2500, 2)
+	got, truncated := compactMetricDependencies(deps, 3000)
+	if !truncated || len(got) != 2500 {
+		t.Fatalf("got %d dependencies truncated %v, want 2500 truncated", len(got), truncated)
+	}
+	for _, dep := range got {
+		if dep.Port != 0 || dep.Protocol != "http" {
+			t.Fatalf("got dependency %v, want port 0 and protocol http", dep)
+		}
+	}
+	if got[0].Count != 2 {
+		t.Errorf("got count %v of %s, want counts of both ports summed", got[0].Count, got[0].Host)
+	}
+	if deps[0].Port != 8000 || deps[0].Count != 1 {
+		t.Errorf("input dependency %v is modified", deps[0])
+	}
+}
+
+func TestCompactMetricDependenciesDropsSmallestCounts(t *testing.T) {
+	got, truncated := compactMetricDependencies(largeMetricDependencies(20000, 1), 1000)
+	if !truncated || len(got) != 1000 {
+		t.Fatalf("got %d dependencies truncated %v, want 1000 truncated", len(got), truncated)
+	}
+	for _, dep := range got {
+		if dep.Count <= 19000 {
+			t.Fatalf("got dependency %s of count %v, want the ones of the largest counts", dep.Host, dep.Count)
+		}
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i-1].Host > got[i].Host {
+			t.Fatalf("dependencies are not sorted by host")
+		}
+	}
+}
+
+func TestCompactDomains(t *testing.T) {
+	domains := map[string]*lazyloadv1alpha1.Destinations{}
+	counts := map[string]float64{}
+	for i := 0; i < 10000; i++ {
+		h := fmt.Sprintf("metric-%05d.default.svc.cluster.local", i)
+		domains[h] = &lazyloadv1alpha1.Destinations{Hosts: []string{h}}
+		counts[h] = float64(i)
+	}
+	for i := 0; i < 100; i++ {
+		h := fmt.Sprintf("static-%03d.default.svc.cluster.local", i)
+		domains[h] = &lazyloadv1alpha1.Destinations{Hosts: []string{h}}
+		h = fmt.Sprintf("expired-%03d.default.svc.cluster.local", i)
+		domains[h] = &lazyloadv1alpha1.Destinations{Hosts: []string{h}, Status: lazyloadv1alpha1.Destinations_EXPIRE}
+	}
+
+	dropped := compactDomains(domains, 1000, counts)
+	if len(domains) != 1000 || len(dropped) != 9200 {
+		t.Fatalf("got %d domains and %d dropped, want 1000 and 9200", len(domains), len(dropped))
+	}
+	for i := 0; i < 100; i++ {
+		if domains[fmt.Sprintf("static-%03d.default.svc.cluster.local", i)] == nil {
+			t.Fatalf("static domain %d is dropped", i)
+		}
+		if domains[fmt.Sprintf("expired-%03d.default.svc.cluster.local", i)] != nil {
+			t.Fatalf("expired domain %d is kept", i)
+		}
+	}
+	if domains["metric-09999.default.svc.cluster.local"] == nil || domains["metric-09099.default.svc.cluster.local"] != nil {
+		t.Errorf("domains from metric of the largest counts should be kept")
+	}
+}
+
+func TestCompactedStatusSize(t *testing.T) {
+	sf := &lazyloadv1alpha1.ServiceFence{}
+	sf.Status.MetricStatus = map[string]string{}
+	for i := 0; i < 20000; i++ {
+		sf.Status.MetricStatus[fmt.Sprintf(`{destination_service="legacy-%05d.default.svc.cluster.local"}`, i)] = "1"
+	}
+
+	limits := newStatusLimits(nil)
+	deps, _ := compactMetricDependencies(largeMetricDependencies(20000, 3), limits.metricDependencies)
+	setMetricDependencies(sf, deps, time.Now())
+	sf.Status.Domains = map[string]*lazyloadv1alpha1.Destinations{}
+	for _, dep := range sf.Status.MetricDependencies {
+		addToDomains(sf.Status.Domains, dep.Host)
+	}
+	compactDomains(sf.Status.Domains, limits.domains, nil)
+
+	b, err := json.Marshal(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > etcdRequestLimit {
+		t.Errorf("got status of %d bytes, want it below %d", len(b), etcdRequestLimit)
+	}
+	if sf.Status.MetricStatus != nil {
+		t.Errorf("deprecated metricStatus should be cleared")
+	}
+}
+
+func TestTruncationCache(t *testing.T) {
+	c := &truncationCache{}
+	nn := types.NamespacedName{Namespace: "default", Name: "reviews"}
+	steps := []struct {
+		field   string
+		entries []string
+		want    bool
+	}{
+		{"domains", nil, false},
+		{"domains", []string{"b", "a"}, true},
+		{"domains", []string{"a", "b"}, false},
+		{"metricDependencies", []string{"a"}, true},
+		{"domains", []string{"a"}, true},
+		{"domains", nil, true},
+		{"domains", nil, false},
+	}
+	for i, step := range steps {
+		if got := c.set(nn, step.field, step.entries); got != step.want {
+			t.Errorf("step %d: set(%s, %v) = %v, want %v", i, step.field, step.entries, got, step.want)
+		}
+	}
+	c.forget(nn)
+	if len(c.data) != 0 {
+		t.Errorf("records of forgotten fence are kept, %v", c.data)
+	}
+}
+
+func TestRecordTruncatedOnChange(t *testing.T) {
+	r := newTestReconciler(t, &lazyloadv1alpha1.Fence{StatusLimit: &lazyloadv1alpha1.StatusLimit{MaxMetricDependencies: 2}})
+	recorder := record.NewFakeRecorder(10)
+	r.recorder = recorder
+	sf := testFence("default", "reviews")
+	events := func() int {
+		n := len(recorder.Events)
+		for i := 0; i < n; i++ {
+			<-recorder.Events
+		}
+		return n
+	}
+
+	steps := []struct {
+		name       string
+		deps       []*lazyloadv1alpha1.MetricDependency
+		wantEvents int
+	}{
+		{name: "truncated", deps: largeMetricDependencies(3, 1), wantEvents: 1},
+		{name: "same truncated set", deps: largeMetricDependencies(3, 1)},
+		{name: "another truncated set", deps: largeMetricDependencies(4, 1), wantEvents: 1},
+		{name: "within limit", deps: largeMetricDependencies(2, 1)},
+		{name: "truncated again", deps: largeMetricDependencies(3, 1), wantEvents: 1},
+	}
+	for _, step := range steps {
+		r.setFenceMetricDependencies(sf, step.deps)
+		if n := events(); n != step.wantEvents {
+			t.Errorf("%s: %d events, want %d", step.name, n, step.wantEvents)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		r.recordTruncated(sf, "visitor default/productpage", []string{"default/productpage"}, "visitor is not recorded")
+	}
+	if n := events(); n != 1 {
+		t.Errorf("%d events of the same rejected visitor, want 1", n)
+	}
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	WormholePortsPath = "wormholeports"
+
+	PortProtocolUnknown = "unknown"
+
+	// ports of the istio sidecar, like 15001 outbound and 15006 inbound, which are not intercepted
+	istioReservedPortMin = 15000
+	istioReservedPortMax = 15090
+)
+
+var (
+	defaultAutoPortProtocols = []string{"http", "http2", "grpc"}
+
+	// knownPortProtocols are the protocol prefixes of port name recognized by istio
+	knownPortProtocols = map[string]bool{
+		"http": true, "http2": true, "https": true, "grpc": true, "grpc-web": true,
+		"tcp": true, "tls": true, "udp": true, "mongo": true, "mysql": true, "redis": true,
+	}
+)
+
+// globalSidecarWormholePorts exposes the effective wormhole ports of the rendered global-sidecars,
+// which may be derived from services by Fence.AutoPort
+var globalSidecarWormholePorts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "lazyload",
+	Subsystem: "global_sidecar",
+	Name:      "wormhole_port",
+	Help:      "Effective wormhole ports of the global-sidecar rendered in namespace, 1 for each port.",
+}, []string{"namespace", "port"})
+
+func init() {
+	metrics.Registry.MustRegister(globalSidecarWormholePorts)
+}
+
+// portProtocol parses the protocol from service port name like istio, e.g. http-web -> http
+func portProtocol(name string) string {
+	name = strings.ToLower(name)
+	if name == "grpc-web" || strings.HasPrefix(name, "grpc-web-") {
+		return "grpc-web"
+	}
+	if idx := strings.Index(name, "-"); idx >= 0 {
+		name = name[:idx]
+	}
+	if knownPortProtocols[name] {
+		return name
+	}
+	return PortProtocolUnknown
+}
+
+// staticWormholePorts parses ports like Fence.WormholePort
+func staticWormholePorts(wormholePort []string) ([]int32, error) {
+	ports := make([]int32, 0, len(wormholePort))
+	for _, p := range wormholePort {
+		v, err := strconv.Atoi(p)
+		if err != nil || v <= 0 || v > 65535 {
+			return nil, fmt.Errorf("invalid wormholePort %s", p)
+		}
+		ports = append(ports, int32(v))
+	}
+	return ports, nil
+}
+
+// autoWormholePorts returns ports of services matching Fence.AutoPort, nil if auto mode is disabled
+func (r *ServicefenceReconciler) autoWormholePorts() []int32 {
+	ap := r.cfg.AutoPort
+	if ap == nil || !ap.Enable || r.portSvcCache == nil {
+		return nil
+	}
+
+	namespaces := make(map[string]bool, len(ap.Namespaces))
+	for _, ns := range ap.Namespaces {
+		namespaces[ns] = true
+	}
+	protocols := ap.Protocols
+	if len(protocols) == 0 {
+		protocols = defaultAutoPortProtocols
+	}
+	protocolSet := make(map[string]bool, len(protocols))
+	for _, p := range protocols {
+		protocolSet[strings.ToLower(p)] = true
+	}
+
+	probePort := int32(defaultGlobalSidecarProbePort)
+	if p := r.cfg.GetGlobalSidecar().GetProbePort(); p > 0 {
+		probePort = p
+	}
+
+	var ret []int32
+	seen := map[int32]bool{}
+	skipped := map[int32]string{}
+	r.portSvcCache.RLock()
+	defer r.portSvcCache.RUnlock()
+	for svc, ports := range r.portSvcCache.Data {
+		parts := strings.SplitN(svc, "/", 2)
+		ns := parts[0]
+		if len(namespaces) > 0 && !namespaces[ns] {
+			continue
+		}
+		// ports of global-sidecar are derived from wormhole ports, skip them to let stale ports go away
+		if len(parts) == 2 && parts[1] == GlobalSidecarName {
+			continue
+		}
+		if ns == r.env.Config.Global.IstioNamespace || ns == r.env.Config.Global.SlimeNamespace {
+			continue
+		}
+		for _, p := range ports {
+			if seen[p.Port] || !protocolSet[portProtocol(p.Name)] {
+				continue
+			}
+			seen[p.Port] = true
+			if reason := reservedWormholePort(p.Port, probePort); reason != "" {
+				skipped[p.Port] = reason
+				continue
+			}
+			ret = append(ret, p.Port)
+		}
+	}
+	r.skippedAutoPorts.log(skipped)
+	return ret
+}
+
+// reservedWormholePort returns why port can not be a wormhole port of global-sidecar, empty if it can
+func reservedWormholePort(port, probePort int32) string {
+	switch {
+	case port == probePort:
+		return "probe port of global-sidecar"
+	case port >= istioReservedPortMin && port <= istioReservedPortMax:
+		return "reserved by istio"
+	}
+	return ""
+}
+
+// skippedPorts remembers the auto ports skipped last time, so that they are logged only on changes
+type skippedPorts struct {
+	last string
+	sync.Mutex
+}
+
+func (s *skippedPorts) log(skipped map[int32]string) {
+	ports := make([]int32, 0, len(skipped))
+	for p := range skipped {
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	items := make([]string, 0, len(ports))
+	for _, p := range ports {
+		items = append(items, fmt.Sprintf("%d (%s)", p, skipped[p]))
+	}
+	msg := strings.Join(items, ", ")
+
+	s.Lock()
+	defer s.Unlock()
+	if msg == s.last {
+		return
+	}
+	s.last = msg
+	if msg != "" {
+		log.Infof("skip auto wormhole ports %s", msg)
+	}
+}
+
+// effectiveWormholePorts returns the sorted union of static wormhole ports and the ports derived from services
+func (r *ServicefenceReconciler) effectiveWormholePorts(wormholePort []string) ([]int32, error) {
+	ports, err := staticWormholePorts(wormholePort)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int32]bool, len(ports))
+	ret := make([]int32, 0, len(ports))
+	for _, p := range append(ports, r.autoWormholePorts()...) {
+		if !seen[p] {
+			seen[p] = true
+			ret = append(ret, p)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret, nil
+}
+
+type wormholePortsStatus struct {
+	Auto      bool    `json:"auto"`
+	Static    []int32 `json:"static"`
+	Effective []int32 `json:"effective"`
+}
+
+// WormholePortsHandler serves the effective wormhole ports of the module, or of the global-sidecar in the
+// namespace given by the namespace query parameter, which follows the wormholePort override of the namespace
+func (r *ServicefenceReconciler) WormholePortsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		wormholePort := r.cfg.WormholePort
+		if ns := req.URL.Query().Get("namespace"); ns != "" {
+			wormholePort = r.nsSettingsByName(ns).wormholePort
+		}
+		static, err := staticWormholePorts(wormholePort)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		effective, _ := r.effectiveWormholePorts(wormholePort)
+		status := wormholePortsStatus{
+			Auto:      r.cfg.AutoPort != nil && r.cfg.AutoPort.Enable,
+			Static:    static,
+			Effective: effective,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+
+	lazyloadv1alpha1 "slime.io/slime/modules/lazyload/api/v1alpha1"
+)
+
+func TestPortSvcCacheUpdateNotifies(t *testing.T) {
+	http80 := []corev1.ServicePort{{Name: "http", Port: 80}}
+	http8080 := []corev1.ServicePort{{Name: "http", Port: 8080}}
+	cases := []struct {
+		name       string
+		svc        string
+		ports      []corev1.ServicePort
+		wantNotify bool
+	}{
+		{name: "add", svc: "default/a", ports: http80, wantNotify: true},
+		{name: "same ports", svc: "default/a", ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		{name: "change ports", svc: "default/a", ports: http8080, wantNotify: true},
+		{name: "delete", svc: "default/a", wantNotify: true},
+		{name: "delete unknown", svc: "default/b"},
+	}
+
+	c := &PortSvcCache{Data: map[string][]corev1.ServicePort{}, Changed: make(chan struct{}, 1)}
+	for _, tc := range cases {
+		c.update(tc.svc, tc.ports)
+		notified := false
+		select {
+		case <-c.Changed:
+			notified = true
+		default:
+		}
+		if notified != tc.wantNotify {
+			t.Errorf("%s: notified %v, want %v", tc.name, notified, tc.wantNotify)
+		}
+		if got := c.Data[tc.svc]; !reflect.DeepEqual(got, tc.ports) {
+			t.Errorf("%s: cached ports %v, want %v", tc.name, got, tc.ports)
+		}
+	}
+
+	// notifications are merged until the consumer catches up
+	c.update("default/a", http80)
+	c.update("default/a", http8080)
+	<-c.Changed
+	select {
+	case <-c.Changed:
+		t.Errorf("changes are not merged into one notification")
+	default:
+	}
+}
+
+func TestEffectiveWormholePorts(t *testing.T) {
+	cache := map[string][]corev1.ServicePort{
+		"default/reviews":         {{Name: "http", Port: 9080}, {Name: "tcp-db", Port: 3306}},
+		"default/grpc":            {{Name: "grpc-api", Port: 50051}},
+		"default/unnamed":         {{Port: 8000}},
+		"other/web":               {{Name: "http-web", Port: 8080}},
+		"default/global-sidecar":  {{Name: "http-7000", Port: 7000}},
+		"istio-system/istiod":     {{Name: "http-monitoring", Port: 15014}},
+		"mesh-operator/lazyload":  {{Name: "http", Port: 8081}},
+		"default/duplicated-9080": {{Name: "http2", Port: 9080}},
+		// reserved by istio and the probe of global-sidecar
+		"default/envoy-admin": {{Name: "http-admin", Port: 15000}, {Name: "http-metrics", Port: 15090}},
+		"default/probe":       {{Name: "http-probe", Port: 18181}},
+	}
+	cases := []struct {
+		name     string
+		autoPort *lazyloadv1alpha1.AutoPort
+		// probePort of global-sidecar, default 18181
+		probePort int32
+		static    []string
+		want      []int32
+		wantErr   bool
+	}{
+		{name: "static only", static: []string{"9080", "80"}, want: []int32{80, 9080}},
+		{name: "invalid static", static: []string{"http"}, wantErr: true},
+		{
+			name:     "default protocols",
+			autoPort: &lazyloadv1alpha1.AutoPort{Enable: true},
+			static:   []string{"80"},
+			want:     []int32{80, 8080, 9080, 50051},
+		},
+		{
+			name:     "namespaces and protocols",
+			autoPort: &lazyloadv1alpha1.AutoPort{Enable: true, Namespaces: []string{"default"}, Protocols: []string{"TCP"}},
+			want:     []int32{3306},
+		},
+		{
+			name:      "probe port of global-sidecar",
+			autoPort:  &lazyloadv1alpha1.AutoPort{Enable: true, Namespaces: []string{"default"}},
+			probePort: 18182,
+			want:      []int32{9080, 18181, 50051},
+		},
+		{
+			name:     "disabled",
+			autoPort: &lazyloadv1alpha1.AutoPort{Namespaces: []string{"default"}},
+			static:   []string{"80"},
+			want:     []int32{80},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newTestReconciler(t, &lazyloadv1alpha1.Fence{
+				GlobalSidecar: &lazyloadv1alpha1.GlobalSidecar{Render: true, Image: "global-sidecar:v1", ProbePort: c.probePort},
+			})
+			r.cfg.AutoPort = c.autoPort
+			r.portSvcCache.Data = cache
+			got, err := r.effectiveWormholePorts(c.static)
+			if (err != nil) != c.wantErr || !reflect.DeepEqual(got, c.want) {
+				t.Errorf("effectiveWormholePorts(%v) = %v, %v, want %v, err %v", c.static, got, err, c.want, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestWormholePortsHandler(t *testing.T) {
+	r := newTestReconciler(t, &lazyloadv1alpha1.Fence{WormholePort: []string{"9080"}})
+	r.overrides.set("default", `{"wormholePort": ["80", "8080"]}`)
+	handler := r.WormholePortsHandler()
+
+	for target, want := range map[string][]int32{
+		"/wormholeports":                   {9080},
+		"/wormholeports?namespace=default": {80, 8080},
+		"/wormholeports?namespace=other":   {9080},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var got wormholePortsStatus
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		if !reflect.DeepEqual(got.Static, want) || !reflect.DeepEqual(got.Effective, want) {
+			t.Errorf("%s: got %+v, want ports %v", target, got, want)
+		}
+	}
+}
+
+func TestReconcileGlobalSidecarRecordsWormholePorts(t *testing.T) {
+	cfg := &lazyloadv1alpha1.Fence{
+		GlobalSidecarMode: GlobalSidecarModeNamespace,
+		AutoFence:         true,
+		WormholePort:      []string{"9080"},
+		AutoPort:          &lazyloadv1alpha1.AutoPort{Enable: true},
+		GlobalSidecar:     &lazyloadv1alpha1.GlobalSidecar{Render: true, Image: "global-sidecar:v1"},
+	}
+	r := newTestReconciler(t, cfg)
+	r.enabledNamespaces = map[string]bool{"a": true}
+	r.portSvcCache.Data["a/web"] = []corev1.ServicePort{{Name: "http-web", Port: 8080}}
+	if err := r.ReconcileGlobalSidecar(); err != nil {
+		t.Fatal(err)
+	}
+	for _, port := range []string{"8080", "9080"} {
+		if v := testutil.ToFloat64(globalSidecarWormholePorts.WithLabelValues("a", port)); v != 1 {
+			t.Errorf("wormhole port %s of namespace a = %v, want 1", port, v)
+		}
+	}
+
+	r.enabledNamespaces["a"] = false
+	if err := r.ReconcileGlobalSidecar(); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric, 10)
+	globalSidecarWormholePorts.Collect(ch)
+	if n := len(ch); n != 0 {
+		t.Errorf("%d wormhole ports are left after global-sidecar is removed", n)
+	}
+}
@@ -1,9 +1,11 @@
 package module
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/golang/protobuf/proto"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -54,7 +56,15 @@ func (mo *Module) Clone() module.Module {
 func (mo *Module) InitManager(mgr manager.Manager, env bootstrap.Environment, cbs module.InitCallbacks) error {
 	cfg := &mo.config
 
+	if err := controllers.ResolveFenceConfig(cfg, env.Config); err != nil {
+		log.Errorf("%v", err)
+		return err
+	}
+
 	sfReconciler := controllers.NewReconciler(cfg, mgr, env)
+	if sfReconciler == nil {
+		return fmt.Errorf("unable to create lazyload reconciler")
+	}
 
 	var builder basecontroller.ObjectReconcilerBuilder
 
@@ -71,6 +81,13 @@ func (mo *Module) InitManager(mgr manager.Manager, env bootstrap.Environment, cb
 		})
 	}
 
+	// cache the override annotations of namespaces
+	builder = builder.Add(basecontroller.ObjectReconcileItem{
+		Name:    "NamespaceOverride",
+		ApiType: &corev1.Namespace{},
+		R:       reconcile.Func(sfReconciler.ReconcileNamespaceOverride),
+	})
+
 	builder = builder.Add(basecontroller.ObjectReconcileItem{
 		Name: "ServiceFence",
 		R:    sfReconciler,
@@ -83,10 +100,30 @@ func (mo *Module) InitManager(mgr manager.Manager, env bootstrap.Environment, cb
 		},
 	})
 
+	// track readiness of global-sidecar managed in namespace mode
+	if cfg.GlobalSidecarMode == controllers.GlobalSidecarModeNamespace && cfg.GetGlobalSidecar().GetRender() {
+		builder = builder.Add(basecontroller.ObjectReconcileItem{
+			Name:    "GlobalSidecarDeployment",
+			ApiType: &appsv1.Deployment{},
+			R:       reconcile.Func(sfReconciler.ReconcileGlobalSidecarDeployment),
+		})
+	}
+
 	if err := builder.Build(mgr); err != nil {
 		log.Errorf("unable to create controller,%+v", err)
 		os.Exit(1)
 	}
 
+	// render global-sidecar resources from fence config
+	if err := mgr.Add(manager.RunnableFunc(sfReconciler.RunGlobalSidecarRender(mgr.GetCache().WaitForCacheSync))); err != nil {
+		log.Errorf("unable to add global-sidecar render, %+v", err)
+		return err
+	}
+
+	// accept dependency reported by global-sidecar
+	env.HttpPathHandler.Handle(controllers.DependencyReportPath, sfReconciler.DependencyReportHandler())
+	// expose the effective wormhole ports
+	env.HttpPathHandler.Handle(controllers.WormholePortsPath, sfReconciler.WormholePortsHandler())
+
 	return nil
 }
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const maxEjectionTime = 5 * time.Minute
+
+var (
+	errDestinationEjected  = errors.New("destination is ejected")
+	errDestinationOverflow = errors.New("destination reaches max concurrent requests")
+)
+
+// RetryConfig retries idempotent requests without body on connection errors and retriable status codes
+type RetryConfig struct {
+	// Attempts is the max number of retries, 0 means no retry
+	Attempts int `json:"attempts,omitempty"`
+	// Backoff is the interval between retries, doubled on each retry
+	Backoff Duration `json:"backoff,omitempty"`
+	// StatusCodes are the response codes to retry on, default [502, 503, 504]
+	StatusCodes []int `json:"statusCodes,omitempty"`
+}
+
+// CircuitBreakerConfig limits requests to each original destination. The original destination is usually the
+// cluster ip of a service, so ejecting it rejects all requests to the service.
+type CircuitBreakerConfig struct {
+	// MaxRequests is the max concurrent requests to each destination, 0 means no limit
+	MaxRequests int `json:"maxRequests,omitempty"`
+	// ConsecutiveErrors ejects the destination after the number of consecutive failures, 0 means disabled.
+	// Only connect errors and 502, 503 and 504 responses are failures. Default is disabled
+	ConsecutiveErrors int `json:"consecutiveErrors,omitempty"`
+	// BaseEjectionTime is multiplied by the number of times the destination has been ejected, max 5m
+	BaseEjectionTime Duration `json:"baseEjectionTime,omitempty"`
+}
+
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Attempts:    2,
+		Backoff:     Duration{25 * time.Millisecond},
+		StatusCodes: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		BaseEjectionTime: Duration{30 * time.Second},
+	}
+}
+
+// retriable returns true if the request can be sent again safely
+func (c *RetryConfig) retriable(req *http.Request) bool {
+	if c.Attempts <= 0 || req.ContentLength != 0 {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (c *RetryConfig) retryOnStatus(code int) bool {
+	for _, sc := range c.StatusCodes {
+		if sc == code {
+			return true
+		}
+	}
+	return false
+}
+
+type destinationState struct {
+	inFlight          int
+	consecutiveErrors int
+	ejections         int
+	ejectedUntil      time.Time
+}
+
+// circuitBreaker tracks concurrency and consecutive failures of each original destination
+type circuitBreaker struct {
+	cfg CircuitBreakerConfig
+
+	mu    sync.Mutex
+	dests map[string]*destinationState
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		cfg:   cfg,
+		dests: map[string]*destinationState{},
+	}
+}
+
+// setConfig applies cfg to the breaker, the states of destinations are kept
+func (cb *circuitBreaker) setConfig(cfg CircuitBreakerConfig) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.cfg = cfg
+}
+
+// acquire returns error if the destination is ejected or overflowed,
+// otherwise the caller must call release with the result of the request
+func (cb *circuitBreaker) acquire(dest string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	st, ok := cb.dests[dest]
+	if !ok {
+		st = &destinationState{}
+		cb.dests[dest] = st
+	}
+	if !st.ejectedUntil.IsZero() {
+		if time.Now().Before(st.ejectedUntil) {
+			return errDestinationEjected
+		}
+		// ejection expired, give the destination a chance
+		st.ejectedUntil = time.Time{}
+		st.consecutiveErrors = 0
+	}
+	if cb.cfg.MaxRequests > 0 && st.inFlight >= cb.cfg.MaxRequests {
+		return errDestinationOverflow
+	}
+	st.inFlight++
+	return nil
+}
+
+// release records the result of the request, failure means the destination is unhealthy
+func (cb *circuitBreaker) release(dest string, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	st, ok := cb.dests[dest]
+	if !ok {
+		return
+	}
+	st.inFlight--
+	if success {
+		st.consecutiveErrors = 0
+		st.ejections = 0
+	} else {
+		st.consecutiveErrors++
+		if cb.cfg.ConsecutiveErrors > 0 && st.consecutiveErrors >= cb.cfg.ConsecutiveErrors && st.ejectedUntil.IsZero() {
+			st.ejections++
+			d := time.Duration(st.ejections) * cb.cfg.BaseEjectionTime.Duration
+			if d > maxEjectionTime {
+				d = maxEjectionTime
+			}
+			st.ejectedUntil = time.Now().Add(d)
+		}
+	}
+	// forget healthy idle destinations to keep the map small
+	if st.inFlight == 0 && st.consecutiveErrors == 0 && st.ejections == 0 {
+		delete(cb.dests, dest)
+	}
+}
+
+// isDestinationFailure returns true if the result of a request means the destination is unhealthy,
+// which is a connect error or a gateway error response. Other errors, like timeouts of slow requests
+// and 500 of application bugs, are not counted.
+func isDestinationFailure(err error, code int) bool {
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
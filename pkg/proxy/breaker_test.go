@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerEjection(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreakerConfig{
+		MaxRequests:       1,
+		ConsecutiveErrors: 2,
+		BaseEjectionTime:  Duration{50 * time.Millisecond},
+	})
+	const dest = "10.0.0.1:80"
+
+	if err := cb.acquire(dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := cb.acquire(dest); err != errDestinationOverflow {
+		t.Errorf("got %v, want %v", err, errDestinationOverflow)
+	}
+	cb.release(dest, false)
+	if err := cb.acquire(dest); err != nil {
+		t.Fatal(err)
+	}
+	cb.release(dest, false)
+	if err := cb.acquire(dest); err != errDestinationEjected {
+		t.Errorf("got %v, want %v", err, errDestinationEjected)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := cb.acquire(dest); err != nil {
+		t.Fatalf("destination is not recovered after ejection, %v", err)
+	}
+	cb.release(dest, true)
+	if len(cb.dests) != 0 {
+		t.Errorf("healthy destination is not forgotten")
+	}
+}
+
+func TestProxyRetry(t *testing.T) {
+	var count int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.WormholePorts = []PortConfig{{Port: 80}}
+	cfg.Resolver.DisableLookup = true
+	cfg.Retry.Backoff = Duration{time.Millisecond}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxy(80, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method string) int {
+		req := httptest.NewRequest(method, "http://example.com/", strings.NewReader(""))
+		req.Header.Set(HeaderOrigDest, backend.Listener.Addr().String())
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(http.MethodGet); code != http.StatusOK || count != 2 {
+		t.Errorf("get: got code %d after %d attempts, want %d after 2", code, count, http.StatusOK)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	if code := serve(http.MethodPost); code != http.StatusServiceUnavailable || count != 1 {
+		t.Errorf("post: got code %d after %d attempts, want %d after 1", code, count, http.StatusServiceUnavailable)
+	}
+}
+
+func TestIsDestinationFailure(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	cases := []struct {
+		name string
+		err  error
+		code int
+		want bool
+	}{
+		{"ok", nil, http.StatusOK, false},
+		{"application error", nil, http.StatusInternalServerError, false},
+		{"not found", nil, http.StatusNotFound, false},
+		{"bad gateway", nil, http.StatusBadGateway, true},
+		{"unavailable", nil, http.StatusServiceUnavailable, true},
+		{"gateway timeout", nil, http.StatusGatewayTimeout, true},
+		{"connect error", dialErr, 0, true},
+		{"wrapped connect error", fmt.Errorf("get: %w", dialErr), 0, true},
+		{"read error", readErr, 0, false},
+		{"timeout", context.DeadlineExceeded, 0, false},
+	}
+	for _, c := range cases {
+		if got := isDestinationFailure(c.err, c.code); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestProxyBreakerStateKeptOnUpdate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.WormholePorts = []PortConfig{{Port: 80}}
+	if cfg.CircuitBreaker.ConsecutiveErrors != 0 {
+		t.Errorf("ejection is enabled by default")
+	}
+	cfg.CircuitBreaker.ConsecutiveErrors = 1
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxy(80, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const dest = "10.0.0.1:80"
+	if err := p.breaker.acquire(dest); err != nil {
+		t.Fatal(err)
+	}
+	p.breaker.release(dest, false)
+
+	if err := p.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.breaker.acquire(dest); err != errDestinationEjected {
+		t.Errorf("got %v after config update, want %v", err, errDestinationEjected)
+	}
+}
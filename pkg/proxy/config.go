@@ -0,0 +1,298 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ProtocolHTTP  = "http"
+	ProtocolHTTPS = "https"
+
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	// ReadinessDialTargetNone disables the dial check on readiness, like an empty target
+	ReadinessDialTargetNone = "none"
+
+	// DefaultDependencyReportTokenFile is the service account token of the pod, which the lazyload controller
+	// reviews to authenticate dependency reports
+	DefaultDependencyReportTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// DefaultTrustedProxies are the addresses the local istio sidecar forwards inbound requests from,
+// 127.0.0.6 since istio 1.10 and 127.0.0.1 before
+var DefaultTrustedProxies = []string{"127.0.0.1", "127.0.0.6", "::1"}
+
+// Duration is a time.Duration which is unmarshalled from strings like "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Config is the configuration of global-sidecar proxy
+type Config struct {
+	// WormholePorts are the ports proxy listens on
+	WormholePorts []PortConfig `json:"wormholePorts,omitempty"`
+	// ProbePort serves health check and metrics
+	ProbePort int       `json:"probePort,omitempty"`
+	Log       LogConfig `json:"log,omitempty"`
+	// DependencyReportAddr is the lazyload controller url which accepts dependency reports,
+	// like http://lazyload.mesh-operator:8081/lazyload/dependency
+	DependencyReportAddr string `json:"dependencyReportAddr,omitempty"`
+	// DependencyReportTokenFile is sent as bearer token with dependency reports, default the service account
+	// token of the pod. It is read on each report as the token is rotated.
+	DependencyReportTokenFile string `json:"dependencyReportTokenFile,omitempty"`
+	// TrustedProxies are the addresses or cidrs of proxies in front of the proxy, default DefaultTrustedProxies
+	// of the local sidecar. X-Forwarded-For is only trusted when the request comes from them, and the source ip
+	// is the right-most address of it not in TrustedProxies. Empty means the source ip is always the remote address.
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+	// ReadinessDialTarget is dialed on readiness check to make sure upstreams are reachable,
+	// like an upstream every destination is routed through. Empty or "none" disables the dial check, as no address
+	// is reachable from every pod, e.g. the apiserver may be blocked by network policies.
+	ReadinessDialTarget string        `json:"readinessDialTarget,omitempty"`
+	Timeouts            TimeoutConfig `json:"timeouts,omitempty"`
+	Pool                PoolConfig    `json:"pool,omitempty"`
+	// Resolver completes short names in request host
+	Resolver ResolverConfig `json:"resolver,omitempty"`
+	// TLSOrigination originates tls to the matched destinations, the first matched rule is used
+	TLSOrigination []TLSOriginationConfig `json:"tlsOrigination,omitempty"`
+	// Dispatches route requests of matched domains to the specified upstreams
+	Dispatches     []DispatchConfig     `json:"dispatches,omitempty"`
+	Retry          RetryConfig          `json:"retry,omitempty"`
+	CircuitBreaker CircuitBreakerConfig `json:"circuitBreaker,omitempty"`
+}
+
+type PortConfig struct {
+	Port int `json:"port"`
+	// Protocol used to talk with the original destination, http or https, default http
+	Protocol string `json:"protocol,omitempty"`
+}
+
+type LogConfig struct {
+	Level string `json:"level,omitempty"`
+	// Format of proxy log, text or json
+	Format string `json:"format,omitempty"`
+	// AccessLog enables access log in the given format, only json is supported now
+	AccessLog string `json:"accessLog,omitempty"`
+}
+
+type TimeoutConfig struct {
+	// Dial is the timeout of connecting to the original destination
+	Dial Duration `json:"dial,omitempty"`
+	// ResponseHeader is the timeout of waiting for response headers, 0 means no limit
+	ResponseHeader Duration `json:"responseHeader,omitempty"`
+	IdleConn       Duration `json:"idleConn,omitempty"`
+	// DrainDelay is the duration between failing readiness and closing listeners after SIGTERM,
+	// so that the proxy is removed from endpoints before it stops accepting requests
+	DrainDelay Duration `json:"drainDelay,omitempty"`
+	// Drain is the max duration waiting for in-flight requests after listeners are closed
+	Drain Duration `json:"drain,omitempty"`
+}
+
+type PoolConfig struct {
+	MaxIdleConns        int `json:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+	// MaxConnsPerHost limits connections to each destination, 0 means no limit
+	MaxConnsPerHost int `json:"maxConnsPerHost,omitempty"`
+}
+
+// DefaultConfig returns config with default values
+func DefaultConfig() *Config {
+	return &Config{
+		ProbePort:                 18181,
+		DependencyReportTokenFile: DefaultDependencyReportTokenFile,
+		TrustedProxies:            append([]string(nil), DefaultTrustedProxies...),
+		Log: LogConfig{
+			Level:  "info",
+			Format: LogFormatText,
+		},
+		Timeouts: TimeoutConfig{
+			Dial:       Duration{30 * time.Second},
+			IdleConn:   Duration{90 * time.Second},
+			DrainDelay: Duration{5 * time.Second},
+			Drain:      Duration{30 * time.Second},
+		},
+		Pool: PoolConfig{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+		},
+		Resolver:       DefaultResolverConfig(),
+		Retry:          DefaultRetryConfig(),
+		CircuitBreaker: DefaultCircuitBreakerConfig(),
+	}
+}
+
+// LoadConfigFile merges the yaml or json config file into cfg
+func LoadConfigFile(cfg *Config, path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = yaml.UnmarshalStrict(raw, cfg); err != nil {
+		return fmt.Errorf("parse config file %s failed, %v", path, err)
+	}
+	return nil
+}
+
+// ParsePorts parses ports like "80,9080" or "80/http,443/https"
+func ParsePorts(s string) ([]PortConfig, error) {
+	var ports []PortConfig
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pc := PortConfig{}
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			pc.Protocol = item[idx+1:]
+			item = item[:idx]
+		}
+		p, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("wrong wormholePort value %s", item)
+		}
+		pc.Port = p
+		ports = append(ports, pc)
+	}
+	return ports, nil
+}
+
+// Validate checks the config and fills default protocol of ports
+func (c *Config) Validate() error {
+	if c.ProbePort <= 0 || c.ProbePort > 65535 {
+		return fmt.Errorf("probePort %d is out of range", c.ProbePort)
+	}
+	if len(c.WormholePorts) == 0 {
+		return fmt.Errorf("wormholePorts is empty")
+	}
+	seen := make(map[int]bool, len(c.WormholePorts))
+	for i := range c.WormholePorts {
+		pc := &c.WormholePorts[i]
+		if pc.Port <= 0 || pc.Port > 65535 {
+			return fmt.Errorf("wormholePorts[%d]: port %d is out of range", i, pc.Port)
+		}
+		if pc.Port == c.ProbePort {
+			return fmt.Errorf("wormholePorts[%d]: port %d is reserved for health check", i, pc.Port)
+		}
+		if seen[pc.Port] {
+			return fmt.Errorf("wormholePorts[%d]: port %d is duplicated", i, pc.Port)
+		}
+		seen[pc.Port] = true
+
+		switch pc.Protocol {
+		case "":
+			pc.Protocol = ProtocolHTTP
+		case ProtocolHTTP, ProtocolHTTPS:
+		default:
+			return fmt.Errorf("wormholePorts[%d]: unsupported protocol %s", i, pc.Protocol)
+		}
+	}
+
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		return fmt.Errorf("log.level: %v", err)
+	}
+	switch c.Log.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("log.format: unsupported format %s", c.Log.Format)
+	}
+	switch c.Log.AccessLog {
+	case "", LogFormatJSON:
+	default:
+		return fmt.Errorf("log.accessLog: unsupported format %s", c.Log.AccessLog)
+	}
+
+	for name, d := range map[string]Duration{
+		"dial":           c.Timeouts.Dial,
+		"responseHeader": c.Timeouts.ResponseHeader,
+		"idleConn":       c.Timeouts.IdleConn,
+		"drainDelay":     c.Timeouts.DrainDelay,
+		"drain":          c.Timeouts.Drain,
+	} {
+		if d.Duration < 0 {
+			return fmt.Errorf("timeouts.%s: negative duration %s", name, d)
+		}
+	}
+	for i := range c.Dispatches {
+		if err := c.Dispatches[i].Validate(); err != nil {
+			return fmt.Errorf("dispatches[%d]: %v", i, err)
+		}
+	}
+	if c.Retry.Attempts < 0 || c.Retry.Backoff.Duration < 0 {
+		return fmt.Errorf("retry: negative attempts or backoff")
+	}
+	if c.CircuitBreaker.MaxRequests < 0 || c.CircuitBreaker.ConsecutiveErrors < 0 ||
+		c.CircuitBreaker.BaseEjectionTime.Duration < 0 {
+		return fmt.Errorf("circuitBreaker: negative value")
+	}
+	if c.Resolver.ClusterDomain == "" || strings.HasPrefix(c.Resolver.ClusterDomain, ".") ||
+		strings.HasSuffix(c.Resolver.ClusterDomain, ".") {
+		return fmt.Errorf("resolver.clusterDomain: invalid domain %q", c.Resolver.ClusterDomain)
+	}
+	if c.Resolver.Ndots < 0 {
+		return fmt.Errorf("resolver.ndots: negative value %d", c.Resolver.Ndots)
+	}
+	for i := range c.TLSOrigination {
+		if err := c.TLSOrigination[i].validate(); err != nil {
+			return fmt.Errorf("tlsOrigination[%d]: %v", i, err)
+		}
+	}
+	if _, err := parseTrustedProxies(c.TrustedProxies); err != nil {
+		return fmt.Errorf("trustedProxies: %v", err)
+	}
+	if c.Pool.MaxIdleConns < 0 || c.Pool.MaxIdleConnsPerHost < 0 || c.Pool.MaxConnsPerHost < 0 {
+		return fmt.Errorf("pool: negative size")
+	}
+	return nil
+}
+
+// DialTarget returns the address dialed on readiness check, empty means no dial check
+func (c *Config) DialTarget() string {
+	if c.ReadinessDialTarget == ReadinessDialTargetNone {
+		return ""
+	}
+	return c.ReadinessDialTarget
+}
+
+// Ports returns the wormhole port numbers
+func (c *Config) Ports() []int {
+	ports := make([]int, 0, len(c.WormholePorts))
+	for _, pc := range c.WormholePorts {
+		ports = append(ports, pc.Port)
+	}
+	return ports
+}
+
+// PortConfig returns the config of the wormhole port
+func (c *Config) PortConfig(port int) PortConfig {
+	for _, pc := range c.WormholePorts {
+		if pc.Port == port {
+			return pc
+		}
+	}
+	return PortConfig{Port: port, Protocol: ProtocolHTTP}
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePorts(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    []PortConfig
+		wantErr bool
+	}{
+		{"80", []PortConfig{{Port: 80}}, false},
+		{"80, 9080,", []PortConfig{{Port: 80}, {Port: 9080}}, false},
+		{"80/http,443/https", []PortConfig{{Port: 80, Protocol: ProtocolHTTP}, {Port: 443, Protocol: ProtocolHTTPS}}, false},
+		{"", nil, false},
+		{"http", nil, true},
+		{":80", nil, true},
+	}
+	for _, c := range cases {
+		got, err := ParsePorts(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParsePorts(%q) err = %v, want error %v", c.in, err, c.wantErr)
+			continue
+		}
+		if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParsePorts(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr string
+	}{
+		{"valid", func(cfg *Config) {}, ""},
+		{"no ports", func(cfg *Config) { cfg.WormholePorts = nil }, "wormholePorts is empty"},
+		{"port out of range", func(cfg *Config) { cfg.WormholePorts[0].Port = 70000 }, "out of range"},
+		{"probe port", func(cfg *Config) { cfg.WormholePorts[0].Port = cfg.ProbePort }, "reserved for health check"},
+		{"duplicated port", func(cfg *Config) { cfg.WormholePorts = append(cfg.WormholePorts, PortConfig{Port: 80}) }, "duplicated"},
+		{"protocol", func(cfg *Config) { cfg.WormholePorts[0].Protocol = "grpc" }, "unsupported protocol"},
+		{"log level", func(cfg *Config) { cfg.Log.Level = "loud" }, "log.level"},
+		{"log format", func(cfg *Config) { cfg.Log.Format = "xml" }, "log.format"},
+		{"negative timeout", func(cfg *Config) { cfg.Timeouts.Dial = Duration{-time.Second} }, "timeouts.dial"},
+		{"pool", func(cfg *Config) { cfg.Pool.MaxIdleConns = -1 }, "pool"},
+		{"cluster domain", func(cfg *Config) { cfg.Resolver.ClusterDomain = "cluster.local." }, "resolver.clusterDomain"},
+		{"trusted proxies", func(cfg *Config) { cfg.TrustedProxies = []string{"proxy"} }, "trustedProxies"},
+	}
+	for _, c := range cases {
+		cfg := DefaultConfig()
+		cfg.WormholePorts = []PortConfig{{Port: 80}}
+		c.modify(cfg)
+		err := cfg.Validate()
+		if c.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			} else if cfg.WormholePorts[0].Protocol != ProtocolHTTP {
+				t.Errorf("%s: default protocol is not filled", c.name)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("%s: got err %v, want %q", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("wormholePorts:\n- port: 9080\ntimeouts:\n  dial: 5s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	if err := LoadConfigFile(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.WormholePorts) != 1 || cfg.WormholePorts[0].Port != 9080 || cfg.Timeouts.Dial.Duration != 5*time.Second {
+		t.Errorf("got config %+v", cfg)
+	}
+	if cfg.Timeouts.IdleConn.Duration != 90*time.Second {
+		t.Errorf("default values are not kept, got idleConn %s", cfg.Timeouts.IdleConn)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("wormholePort: 9080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfigFile(DefaultConfig(), path); err == nil {
+		t.Errorf("unknown field is not rejected")
+	}
+}
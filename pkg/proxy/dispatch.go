@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DispatchClusterGlobalSidecar forwards the request to its original destination,
+	// the same as "_GLOBAL_SIDECAR" in Fence.Dispatches
+	DispatchClusterGlobalSidecar = "_GLOBAL_SIDECAR"
+	// DispatchClusterPassthrough forwards the request to its original destination
+	DispatchClusterPassthrough = "PassthroughCluster"
+)
+
+// DispatchConfig routes requests of matched domains to the cluster, like Fence.Dispatches
+type DispatchConfig struct {
+	Name string `json:"name"`
+	// Domains are matched like envoy virtual host domains: exact "foo.com", suffix "*.foo.com",
+	// prefix "foo.*" and "*" for all domains
+	Domains []string `json:"domains"`
+	// Cluster is the upstream, which is one of "_GLOBAL_SIDECAR", "PassthroughCluster",
+	// istio cluster name like "outbound|80||istio-egressgateway.istio-system.svc.cluster.local"
+	// or address like "istio-egressgateway.istio-system:80"
+	Cluster string `json:"cluster"`
+	// Namespaces limits the rule to requests from these namespaces, empty means all namespaces.
+	// Rules of the source namespace take precedence over the cluster wide ones.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Validate checks the rule, the cluster must be a special name, an istio cluster name or an address
+func (c *DispatchConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if len(c.Domains) == 0 {
+		return fmt.Errorf("domains is empty")
+	}
+	for _, d := range c.Domains {
+		if d == "" || strings.Count(d, "*") > 1 ||
+			(strings.Contains(d, "*") && !strings.HasPrefix(d, "*") && !strings.HasSuffix(d, "*")) {
+			return fmt.Errorf("invalid domain %q", d)
+		}
+	}
+	if _, err := parseDispatchCluster(c.Cluster); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseDispatchCluster returns the upstream address of cluster, empty means the original destination
+func parseDispatchCluster(cluster string) (string, error) {
+	switch cluster {
+	case "":
+		return "", fmt.Errorf("cluster is empty")
+	case DispatchClusterGlobalSidecar, DispatchClusterPassthrough:
+		return "", nil
+	}
+
+	if parts := strings.Split(cluster, "|"); len(parts) == 4 {
+		// istio cluster name: direction|port|subset|host
+		if _, err := strconv.Atoi(parts[1]); err != nil || parts[3] == "" {
+			return "", fmt.Errorf("invalid cluster %q", cluster)
+		}
+		return net.JoinHostPort(parts[3], parts[1]), nil
+	}
+
+	host, port, err := net.SplitHostPort(cluster)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("invalid cluster %q", cluster)
+	}
+	if _, err = strconv.Atoi(port); err != nil {
+		return "", fmt.Errorf("invalid cluster %q", cluster)
+	}
+	return cluster, nil
+}
+
+// dispatcher is the compiled dispatch rules
+type dispatcher struct {
+	// byNs holds namespace scoped rules, the rules with key "" apply to all namespaces
+	byNs map[string][]*dispatchRule
+}
+
+type dispatchRule struct {
+	name    string
+	domains []string
+	// upstream is the address to dial, empty means the original destination
+	upstream string
+}
+
+func newDispatcher(cfgs []DispatchConfig) *dispatcher {
+	d := &dispatcher{byNs: map[string][]*dispatchRule{}}
+	for _, cfg := range cfgs {
+		// validated already
+		upstream, _ := parseDispatchCluster(cfg.Cluster)
+		rule := &dispatchRule{name: cfg.Name, domains: cfg.Domains, upstream: upstream}
+		if len(cfg.Namespaces) == 0 {
+			d.byNs[""] = append(d.byNs[""], rule)
+			continue
+		}
+		for _, ns := range cfg.Namespaces {
+			d.byNs[ns] = append(d.byNs[ns], rule)
+		}
+	}
+	return d
+}
+
+// match returns the rule for the request from namespace ns, nil if none. hosts are the forms of the
+// request host, like the short name sent by the client and the completed FQDN, a rule matching any of
+// them applies.
+func (d *dispatcher) match(ns string, hosts ...string) *dispatchRule {
+	if len(d.byNs) == 0 {
+		return nil
+	}
+	if ns != "" {
+		if rule := matchDomains(d.byNs[ns], hosts); rule != nil {
+			return rule
+		}
+	}
+	return matchDomains(d.byNs[""], hosts)
+}
+
+// matchDomains selects the rule like envoy virtual hosts: exact match first, then the longest suffix
+// wildcard, then the longest prefix wildcard, at last "*"
+func matchDomains(rules []*dispatchRule, hosts []string) *dispatchRule {
+	var (
+		suffixRule, prefixRule, anyRule *dispatchRule
+		suffixLen, prefixLen            int
+	)
+	for _, rule := range rules {
+		for _, d := range rule.domains {
+			for _, host := range hosts {
+				switch {
+				case d == "*":
+					if anyRule == nil {
+						anyRule = rule
+					}
+				case strings.HasPrefix(d, "*"):
+					if len(d) > suffixLen && len(host) >= len(d) && strings.HasSuffix(host, d[1:]) {
+						suffixRule, suffixLen = rule, len(d)
+					}
+				case strings.HasSuffix(d, "*"):
+					if len(d) > prefixLen && len(host) >= len(d) && strings.HasPrefix(host, d[:len(d)-1]) {
+						prefixRule, prefixLen = rule, len(d)
+					}
+				case d == host:
+					return rule
+				}
+			}
+		}
+	}
+	switch {
+	case suffixRule != nil:
+		return suffixRule
+	case prefixRule != nil:
+		return prefixRule
+	}
+	return anyRule
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDispatcherMatch(t *testing.T) {
+	cfgs := []DispatchConfig{
+		{Name: "any", Domains: []string{"*"}, Cluster: DispatchClusterGlobalSidecar},
+		{Name: "external", Domains: []string{"*.com"}, Cluster: "outbound|443||istio-egressgateway.istio-system.svc.cluster.local"},
+		{Name: "example", Domains: []string{"*.example.com"}, Cluster: "egress.istio-system:80"},
+		{Name: "api", Domains: []string{"api.*"}, Cluster: DispatchClusterPassthrough},
+		{Name: "exact", Domains: []string{"www.example.com"}, Cluster: DispatchClusterPassthrough},
+		{Name: "test-only", Domains: []string{"*.example.com"}, Cluster: "egress.test:80", Namespaces: []string{"test"}},
+	}
+	for i := range cfgs {
+		if err := cfgs[i].Validate(); err != nil {
+			t.Fatalf("dispatches[%d]: %v", i, err)
+		}
+	}
+	d := newDispatcher(cfgs)
+
+	cases := []struct {
+		ns, host     string
+		wantName     string
+		wantUpstream string
+	}{
+		{"default", "www.example.com", "exact", ""},
+		{"default", "foo.example.com", "example", "egress.istio-system:80"},
+		{"default", "foo.com", "external", "istio-egressgateway.istio-system.svc.cluster.local:443"},
+		{"default", "api.internal", "api", ""},
+		{"default", "reviews", "any", ""},
+		{"test", "foo.example.com", "test-only", "egress.test:80"},
+		{"test", "foo.com", "external", "istio-egressgateway.istio-system.svc.cluster.local:443"},
+	}
+	for _, c := range cases {
+		rule := d.match(c.ns, c.host)
+		if rule == nil {
+			t.Errorf("match(%s, %s) = nil, want %s", c.ns, c.host, c.wantName)
+			continue
+		}
+		if rule.name != c.wantName || rule.upstream != c.wantUpstream {
+			t.Errorf("match(%s, %s) = %s/%s, want %s/%s", c.ns, c.host, rule.name, rule.upstream, c.wantName, c.wantUpstream)
+		}
+	}
+
+	if rule := newDispatcher(nil).match("default", "foo.com"); rule != nil {
+		t.Errorf("empty dispatcher matches %s", rule.name)
+	}
+}
+
+func TestDispatcherMatchShortName(t *testing.T) {
+	d := newDispatcher([]DispatchConfig{
+		{Name: "any", Domains: []string{"*"}, Cluster: DispatchClusterGlobalSidecar},
+		{Name: "reviews", Domains: []string{"reviews"}, Cluster: "reviews-canary.default:9080"},
+		{Name: "default-ns", Domains: []string{"*.default.svc.cluster.local"}, Cluster: DispatchClusterPassthrough},
+	})
+	cases := []struct {
+		hosts    []string
+		wantName string
+	}{
+		// short name sent by the client, completed by the proxy
+		{[]string{"reviews", "reviews.default.svc.cluster.local"}, "reviews"},
+		{[]string{"ratings", "ratings.default.svc.cluster.local"}, "default-ns"},
+		{[]string{"reviews.default.svc.cluster.local", "reviews.default.svc.cluster.local"}, "default-ns"},
+		{[]string{"www.example.com", "www.example.com"}, "any"},
+	}
+	for _, c := range cases {
+		if rule := d.match("default", c.hosts...); rule == nil || rule.name != c.wantName {
+			t.Errorf("match(%v) = %v, want %s", c.hosts, rule, c.wantName)
+		}
+	}
+}
+
+func TestProxyDispatchShortName(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		}))
+	}
+	origDest, canary := newBackend("orig"), newBackend("canary")
+	defer origDest.Close()
+	defer canary.Close()
+
+	cfg := DefaultConfig()
+	cfg.WormholePorts = []PortConfig{{Port: 80}}
+	cfg.Resolver.DisableLookup = true
+	cfg.Dispatches = []DispatchConfig{{Name: "reviews", Domains: []string{"reviews"}, Cluster: canary.Listener.Addr().String()}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxy(80, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for host, want := range map[string]string{"reviews": "canary", "reviews:80": "canary", "ratings": "orig"} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+		req.Header.Set(HeaderSourceNs, "default")
+		req.Header.Set(HeaderOrigDest, origDest.Listener.Addr().String())
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		if body, _ := ioutil.ReadAll(rec.Body); string(body) != want {
+			t.Errorf("request to %s: got response %q, want %q", host, body, want)
+		}
+	}
+}
+
+func TestDispatchConfigValidate(t *testing.T) {
+	for _, c := range []DispatchConfig{
+		{Name: "", Domains: []string{"*"}, Cluster: DispatchClusterPassthrough},
+		{Name: "a", Cluster: DispatchClusterPassthrough},
+		{Name: "a", Domains: []string{"foo.*.com"}, Cluster: DispatchClusterPassthrough},
+		{Name: "a", Domains: []string{"*"}, Cluster: "outbound|http||foo"},
+		{Name: "a", Domains: []string{"*"}, Cluster: "foo"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v is expected to be invalid", c)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defaultDialTimeout = time.Second
+
+// HealthzProxy serves liveness, readiness and metrics of the proxy.
+// It is ready only when all wormhole listeners are bound, the optional
+// upstream dial target is reachable and the proxy is not shutting down.
+type HealthzProxy struct {
+	DialTimeout time.Duration
+
+	mu sync.RWMutex
+	// dialTarget is dialed on readiness check to make sure upstreams are reachable, optional
+	dialTarget   string
+	listeners    map[int]bool
+	shuttingDown bool
+}
+
+func NewHealthzProxy(wormholePorts []int) *HealthzProxy {
+	listeners := make(map[int]bool, len(wormholePorts))
+	for _, p := range wormholePorts {
+		listeners[p] = false
+	}
+	return &HealthzProxy{listeners: listeners}
+}
+
+// SetListenerBound records whether listener of the wormhole port is bound or not
+func (p *HealthzProxy) SetListenerBound(port int, bound bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listeners == nil {
+		p.listeners = map[int]bool{}
+	}
+	p.listeners[port] = bound
+}
+
+// RemoveListener stops checking the listener of the wormhole port, which is removed on purpose
+func (p *HealthzProxy) RemoveListener(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.listeners, port)
+}
+
+// SetDialTarget sets the address dialed on readiness check, empty means no dial check
+func (p *HealthzProxy) SetDialTarget(target string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialTarget = target
+}
+
+// SetShuttingDown makes readiness fail, so no new traffic will be sent to us
+func (p *HealthzProxy) SetShuttingDown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shuttingDown = true
+}
+
+// Ready returns nil if proxy is able to serve requests
+func (p *HealthzProxy) Ready() error {
+	p.mu.RLock()
+	if p.shuttingDown {
+		p.mu.RUnlock()
+		return errors.New("shutting down")
+	}
+	for port, bound := range p.listeners {
+		if !bound {
+			p.mu.RUnlock()
+			return fmt.Errorf("listener of port %d is not bound", port)
+		}
+	}
+	dialTarget := p.dialTarget
+	p.mu.RUnlock()
+
+	if dialTarget != "" {
+		timeout := p.DialTimeout
+		if timeout <= 0 {
+			timeout = defaultDialTimeout
+		}
+		conn, err := net.DialTimeout("tcp", dialTarget, timeout)
+		if err != nil {
+			return fmt.Errorf("dial upstream %s failed, %v", dialTarget, err)
+		}
+		_ = conn.Close()
+	}
+	return nil
+}
+
+func (p *HealthzProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/healthz/live":
+		_, _ = w.Write([]byte("Healthy!"))
+	case "/healthz/ready":
+		if err := p.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("Healthy!"))
+	case "/metrics":
+		promhttp.Handler().ServeHTTP(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthzProxyReady(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	p := NewHealthzProxy([]int{80, 9080})
+	p.DialTimeout = 100 * time.Millisecond
+	check := func(name string, wantReady bool) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz/ready", nil))
+		if ready := rec.Code == http.StatusOK; ready != wantReady {
+			t.Errorf("%s: got code %d, body %s", name, rec.Code, rec.Body.String())
+		}
+	}
+
+	check("listeners not bound", false)
+	p.SetListenerBound(80, true)
+	check("one listener not bound", false)
+	p.SetListenerBound(9080, true)
+	check("all listeners bound", true)
+
+	p.SetDialTarget(closedAddr)
+	check("dial target unreachable", false)
+	p.SetDialTarget(ln.Addr().String())
+	check("dial target reachable", true)
+
+	p.SetShuttingDown()
+	check("shutting down", false)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("live: got code %d while shutting down", rec.Code)
+	}
+}
+
+func TestConfigDialTarget(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := cfg.DialTarget(); got != "" {
+		t.Errorf("got default dial target %q, want disabled", got)
+	}
+	cfg.ReadinessDialTarget = "egress.istio-system:80"
+	if got := cfg.DialTarget(); got != "egress.istio-system:80" {
+		t.Errorf("got dial target %q", got)
+	}
+	cfg.ReadinessDialTarget = ReadinessDialTargetNone
+	if got := cfg.DialTarget(); got != "" {
+		t.Errorf("got dial target %q, want disabled", got)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -18,44 +21,180 @@ const (
 	HeaderOrigDest = "Slime-Orig-Dest"
 )
 
-type HealthzProxy struct{}
+type origDestKey struct{}
 
-func (p *HealthzProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// health check
-	if req.RequestURI == "/healthz/live" || req.RequestURI == "/healthz/ready" {
-		w.Write([]byte("Healthy!"))
-		return
+type Proxy struct {
+	WormholePort int
+	// Reporter reports first-call dependencies to the lazyload controller, optional
+	Reporter *DependencyReporter
+
+	mu        sync.RWMutex
+	scheme    string
+	client    *http.Client
+	transport *transportPool
+	// accessLog writes one entry for each request, optional
+	accessLog *log.Logger
+	resolver  *Resolver
+	// tlsOriginations are tried in order, the first matched one originates tls to the destination
+	tlsOriginations []*tlsOrigination
+	retry           RetryConfig
+	breaker         *circuitBreaker
+	dispatcher      *dispatcher
+	trustedProxies  []*net.IPNet
+}
+
+func NewProxy(port int, cfg *Config, reporter *DependencyReporter) (*Proxy, error) {
+	p := &Proxy{
+		WormholePort: port,
+		Reporter:     reporter,
+	}
+	if err := p.UpdateConfig(cfg); err != nil {
+		return nil, err
 	}
+	return p, nil
 }
 
-type Proxy struct {
-	WormholePort int
+// UpdateConfig applies config to the proxy, it is safe to be called when serving.
+// The previous config is kept if the tls files can not be loaded.
+func (p *Proxy) UpdateConfig(cfg *Config) error {
+	var tlsOriginations []*tlsOrigination
+	for i := range cfg.TLSOrigination {
+		rule := cfg.TLSOrigination[i]
+		tlsConfig, err := rule.tlsConfig()
+		if err != nil {
+			return fmt.Errorf("tlsOrigination[%d]: %v", i, err)
+		}
+		transport := newTransportPool(cfg, tlsConfig)
+		tlsOriginations = append(tlsOriginations, &tlsOrigination{
+			rule:      rule,
+			client:    &http.Client{Transport: transport},
+			transport: transport,
+		})
+	}
+	transport := newTransportPool(cfg, nil)
+	// validated already
+	trustedProxies, _ := parseTrustedProxies(cfg.TrustedProxies)
+
+	var accessLog *log.Logger
+	if cfg.Log.AccessLog == LogFormatJSON {
+		accessLog = NewAccessLogger()
+	}
+
+	p.mu.Lock()
+	oldTransport, oldTLSOriginations := p.transport, p.tlsOriginations
+	p.scheme = cfg.PortConfig(p.WormholePort).Protocol
+	p.transport = transport
+	p.client = &http.Client{Transport: transport}
+	p.tlsOriginations = tlsOriginations
+	p.accessLog = accessLog
+	p.resolver = NewResolver(cfg.Resolver)
+	p.retry = cfg.Retry
+	if p.breaker == nil {
+		p.breaker = newCircuitBreaker(cfg.CircuitBreaker)
+	} else {
+		// keep the ejections and in-flight requests of destinations
+		p.breaker.setConfig(cfg.CircuitBreaker)
+	}
+	p.dispatcher = newDispatcher(cfg.Dispatches)
+	p.trustedProxies = trustedProxies
+	p.mu.Unlock()
+
+	if oldTransport != nil {
+		oldTransport.CloseIdleConnections()
+	}
+	for _, o := range oldTLSOriginations {
+		o.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// NewAccessLogger returns a logger writing access log entries in json format to stdout
+func NewAccessLogger() *log.Logger {
+	l := log.New()
+	// logrus writes to stderr by default, which is mixed with the logs of proxy
+	l.SetOutput(os.Stdout)
+	l.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	return l
 }
 
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.mu.RLock()
+	scheme, client, accessLog, resolver := p.scheme, p.client, p.accessLog, p.resolver
+	tlsOriginations, retry, breaker, dispatcher := p.tlsOriginations, p.retry, p.breaker, p.dispatcher
+	trustedProxies := p.trustedProxies
+	p.mu.RUnlock()
+
 	var (
 		reqCtx               = req.Context()
 		reqHost              = req.Host
 		origDest, origDestIp string
 		origDestPort         = p.WormholePort
+		sourceNs             string
+		dispatch             string
 	)
 	log.Debugf("proxy received request, reqHost: %s", reqHost)
 
-	// try to complete short name
 	if values := req.Header[HeaderSourceNs]; len(values) > 0 && values[0] != "" {
 		req.Header.Del(HeaderSourceNs)
-		if !strings.Contains(reqHost, ".") {
-			// short name
-			ns := values[0]
-			if idx := strings.LastIndex(reqHost, ":"); idx >= 0 {
-				reqHost = fmt.Sprintf("%s.%s%s", reqHost[:idx], ns, reqHost[idx:])
-			} else {
-				reqHost = fmt.Sprintf("%s.%s", reqHost, ns)
-			}
-		}
+		sourceNs = values[0]
 		log.Debugf("handle request header [Slime-Source-Ns]: %s", values[0])
 	}
 
+	// the host sent by the client, which dispatch rules of short names match
+	origHost := hostWithoutPort(reqHost)
+
+	// try to complete short name to FQDN
+	var service bool
+	if idx := strings.LastIndex(reqHost, ":"); idx >= 0 {
+		var host string
+		host, service = resolver.Resolve(reqCtx, reqHost[:idx], sourceNs)
+		reqHost = host + reqHost[idx:]
+	} else {
+		reqHost, service = resolver.Resolve(reqCtx, reqHost, sourceNs)
+	}
+
+	var (
+		start        = time.Now()
+		destHost     = hostWithoutPort(reqHost)
+		code         = http.StatusInternalServerError
+		written      int64
+		upstreamErr  error
+		method, path = req.Method, req.URL.Path
+		srcIp        = sourceIp(req, trustedProxies)
+		// the request host is set by clients, only known services are used as label to bound the cardinality
+		metricHost = destinationLabel(destHost, service)
+	)
+	inFlight := requestInFlight.WithLabelValues(sourceNs, metricHost)
+	inFlight.Inc()
+	defer func() {
+		inFlight.Dec()
+		duration := time.Since(start)
+		requestTotal.WithLabelValues(sourceNs, metricHost, strconv.Itoa(code)).Inc()
+		requestDuration.WithLabelValues(sourceNs, metricHost).Observe(duration.Seconds())
+		if upstreamErr != nil {
+			upstreamErrorTotal.WithLabelValues(sourceNs, metricHost).Inc()
+		}
+		if accessLog != nil {
+			entry := accessLog.WithFields(log.Fields{
+				"source_namespace": sourceNs,
+				"source_ip":        srcIp,
+				"destination_host": destHost,
+				"destination":      fmt.Sprintf("%s:%d", origDestIp, origDestPort),
+				"scheme":           req.URL.Scheme,
+				"dispatch":         dispatch,
+				"method":           method,
+				"path":             path,
+				"code":             code,
+				"bytes":            written,
+				"duration_ms":      duration.Milliseconds(),
+			})
+			if upstreamErr != nil {
+				entry = entry.WithField("error", upstreamErr.Error())
+			}
+			entry.Info("access")
+		}
+	}()
+
 	if values := req.Header[HeaderOrigDest]; len(values) > 0 {
 		origDest = values[0]
 		req.Header.Del(HeaderOrigDest)
@@ -63,7 +202,8 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		if idx := strings.LastIndex(origDest, ":"); idx >= 0 {
 			origDestIp = origDest[:idx]
 			if v, err := strconv.Atoi(origDest[idx+1:]); err != nil {
-				http.Error(w, fmt.Sprintf("invalid header %s value: %s", HeaderOrigDest, origDest), http.StatusBadRequest)
+				code = http.StatusBadRequest
+				http.Error(w, fmt.Sprintf("invalid header %s value: %s", HeaderOrigDest, origDest), code)
 				return
 			} else {
 				origDestPort = v
@@ -75,58 +215,192 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if origDest == "" {
-		if idx := strings.LastIndex(reqHost, ":"); idx >= 0 {
-			origDestIp = reqHost[:idx]
-		} else {
-			origDestIp = reqHost
+		origDestIp = destHost
+	}
+
+	// the port requested by the source, which is reported even if a dispatch routes the request elsewhere
+	destPort := origDestPort
+	if rule := dispatcher.match(sourceNs, origHost, destHost); rule != nil {
+		dispatch = rule.name
+		if rule.upstream != "" {
+			// upstream is validated already
+			host, port, _ := net.SplitHostPort(rule.upstream)
+			origDestIp = host
+			origDestPort, _ = strconv.Atoi(port)
 		}
+		log.Debugf("request to %s from namespace %s matches dispatch %s", destHost, sourceNs, rule.name)
 	}
 	log.Debugf("proxy forward request to: %s:%d", origDestIp, origDestPort)
 
-	if req.URL.Scheme == "" {
-		req.URL.Scheme = "http"
+	if o := matchTLSOrigination(tlsOriginations, destHost, origDestPort); o != nil {
+		// sni is the request host unless overridden, as req.URL.Host is set to it
+		log.Debugf("originate tls to %s:%d", destHost, origDestPort)
+		client = o.client
+		req.URL.Scheme = ProtocolHTTPS
+	} else if req.URL.Scheme == "" {
+		req.URL.Scheme = scheme
 	}
 	req.URL.Host = reqHost
 	req.Host = reqHost
 	req.RequestURI = ""
-	newCtx, _ := context.WithCancel(reqCtx)
+	newCtx, cancel := context.WithCancel(context.WithValue(reqCtx, origDestKey{}, fmt.Sprintf("%s:%d", origDestIp, origDestPort)))
+	defer cancel()
 	req = req.WithContext(newCtx)
 
-	dialer := &net.Dialer{
-		// Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
-	}
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			addr = fmt.Sprintf("%s:%d", origDestIp, origDestPort)
-			return dialer.DialContext(ctx, network, addr)
-		},
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-	client := &http.Client{
-		Transport: transport,
+	dest := fmt.Sprintf("%s:%d", origDestIp, origDestPort)
+	if err := breaker.acquire(dest); err != nil {
+		upstreamErr = err
+		code = http.StatusServiceUnavailable
+		upstreamRejectedTotal.WithLabelValues(sourceNs, metricHost).Inc()
+		http.Error(w, err.Error(), code)
+		return
 	}
 
-	resp, err := client.Do(req)
+	resp, err := p.do(client, req, retry, sourceNs, metricHost)
 	if err != nil {
+		upstreamErr = err
 		select {
 		case <-reqCtx.Done():
+			// client closed request, not the fault of destination
+			breaker.release(dest, true)
+			code = 499
 		default:
+			breaker.release(dest, !isDestinationFailure(err, 0))
 			log.Infof("do req get err %v", err)
-			http.Error(w, "", http.StatusInternalServerError)
+			http.Error(w, "", code)
 		}
 		return
 	}
+	breaker.release(dest, !isDestinationFailure(nil, resp.StatusCode))
+	defer resp.Body.Close()
 
 	for k, vv := range resp.Header {
 		for _, v := range vv {
 			w.Header().Add(k, v)
 		}
 	}
-	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
+	code = resp.StatusCode
+	w.WriteHeader(code)
+	written, _ = io.Copy(w, resp.Body)
+
+	if p.Reporter != nil && sourceNs != "" {
+		p.Reporter.Report(DependencyEvent{
+			SourceNs:  sourceNs,
+			SourceIp:  srcIp,
+			Host:      destHost,
+			Port:      destPort,
+			Timestamp: time.Now().Unix(),
+		})
+	}
+}
+
+// do sends the request and retries on failures according to the retry policy
+func (p *Proxy) do(client *http.Client, req *http.Request, retry RetryConfig, sourceNs, metricHost string) (*http.Response, error) {
+	canRetry := retry.retriable(req)
+	if canRetry {
+		// the body is empty, make it safe to be sent again
+		req.Body = http.NoBody
+	}
+	backoff := retry.Backoff.Duration
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if !canRetry || attempt >= retry.Attempts || req.Context().Err() != nil {
+			return resp, err
+		}
+		if err == nil {
+			if !retry.retryOnStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			log.Debugf("retry request to %s for status %d", req.Host, resp.StatusCode)
+		} else {
+			log.Debugf("retry request to %s for error %v", req.Host, err)
+		}
+		upstreamRetryTotal.WithLabelValues(sourceNs, metricHost).Inc()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func hostWithoutPort(host string) string {
+	if idx := strings.LastIndex(host, ":"); idx >= 0 {
+		return host[:idx]
+	}
+	return host
+}
+
+// sourceIp returns the address of the client. X-Forwarded-For is only trusted if the request comes from
+// trusted proxies, then the right-most address not of trusted proxies is returned, which is appended by the
+// closest trusted proxy and can not be forged by the client.
+func sourceIp(req *http.Request, trustedProxies []*net.IPNet) string {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !ipInNets(remote, trustedProxies) {
+		return remote
+	}
+
+	var xff []string
+	for _, v := range req.Header["X-Forwarded-For"] {
+		xff = append(xff, strings.Split(v, ",")...)
+	}
+	for i := len(xff) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(xff[i])
+		if net.ParseIP(addr) == nil {
+			// garbage, the addresses before it can not be trusted
+			break
+		}
+		remote = addr
+		if !ipInNets(addr, trustedProxies) {
+			break
+		}
+	}
+	return remote
+}
+
+// parseTrustedProxies parses addresses like "127.0.0.1" or cidrs like "10.0.0.0/8"
+func parseTrustedProxies(items []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", item)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func ipInNets(addr string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricNamespace = "lazyload_proxy"
+
+	// destinationExternal is the destination_host label of hosts which are not kubernetes services
+	destinationExternal = "external"
+)
+
+var (
+	requestTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Name:      "requests_total",
+		Help:      "Total number of requests forwarded by the proxy.",
+	}, []string{"source_namespace", "destination_host", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricNamespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests forwarded by the proxy.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source_namespace", "destination_host"})
+
+	upstreamErrorTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Name:      "upstream_errors_total",
+		Help:      "Total number of requests failed to reach the original destination.",
+	}, []string{"source_namespace", "destination_host"})
+
+	upstreamRetryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Name:      "upstream_retries_total",
+		Help:      "Total number of retries to the original destination.",
+	}, []string{"source_namespace", "destination_host"})
+
+	upstreamRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Name:      "upstream_rejected_total",
+		Help:      "Total number of requests rejected by the circuit breaker.",
+	}, []string{"source_namespace", "destination_host"})
+
+	requestInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricNamespace,
+		Name:      "requests_in_flight",
+		Help:      "Number of requests being forwarded by the proxy.",
+	}, []string{"source_namespace", "destination_host"})
+)
+
+func init() {
+	prometheus.MustRegister(requestTotal, requestDuration, upstreamErrorTotal, upstreamRetryTotal,
+		upstreamRejectedTotal, requestInFlight)
+}
+
+// destinationLabel returns the destination_host label of host. Hosts not verified as kubernetes services are
+// set by clients at will, so they are bucketed into one label.
+func destinationLabel(host string, service bool) string {
+	if service {
+		return host
+	}
+	return destinationExternal
+}
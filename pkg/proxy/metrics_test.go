@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProxyMetricsDestinationLabel(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.WormholePorts = []PortConfig{{Port: 80}}
+	cfg.Resolver.DisableLookup = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxy(80, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const ns = "metrics-test"
+	for _, host := range []string{"reviews", "random-1.example.com", "random-2.example.com"} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+		req.Header.Set(HeaderSourceNs, ns)
+		req.Header.Set(HeaderOrigDest, backend.Listener.Addr().String())
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	cases := []struct {
+		host string
+		want float64
+	}{
+		{"reviews.metrics-test.svc.cluster.local", 1},
+		{destinationExternal, 2},
+		{"random-1.example.com", 0},
+	}
+	for _, c := range cases {
+		if got := testutil.ToFloat64(requestTotal.WithLabelValues(ns, c.host, "200")); got != c.want {
+			t.Errorf("requests of %s: got %v, want %v", c.host, got, c.want)
+		}
+	}
+}
+
+func TestAccessLoggerOutput(t *testing.T) {
+	if l := NewAccessLogger(); l.Out != os.Stdout {
+		t.Errorf("access log is not written to stdout")
+	}
+}
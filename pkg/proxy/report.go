@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	reportBatchSize     = 100
+	reportFlushInterval = time.Second
+	reportQueueSize     = 1024
+	reportSeenCapacity  = 65536
+)
+
+// DependencyEvent records the first call from a source to a destination seen by the proxy
+type DependencyEvent struct {
+	SourceNs  string `json:"sourceNs"`
+	SourceIp  string `json:"sourceIp,omitempty"`
+	Host      string `json:"host"`
+	Port      int    `json:"port"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (e DependencyEvent) key() string {
+	return e.SourceNs + "|" + e.SourceIp + "|" + e.Host + ":" + strconv.Itoa(e.Port)
+}
+
+// DependencyReport is the body posted to the lazyload controller
+type DependencyReport struct {
+	Events []DependencyEvent `json:"events"`
+}
+
+// DependencyReporter sends first-call dependency events to the lazyload controller.
+// Events already reported are deduplicated, so each source/destination pair is sent once.
+type DependencyReporter struct {
+	addr string
+	// tokenFile holds the bearer token of reports, empty means reports are not authenticated
+	tokenFile string
+	client    *http.Client
+	events    chan DependencyEvent
+
+	sync.Mutex
+	seen map[string]struct{}
+}
+
+func NewDependencyReporter(addr, tokenFile string) *DependencyReporter {
+	return &DependencyReporter{
+		addr:      addr,
+		tokenFile: tokenFile,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		events:    make(chan DependencyEvent, reportQueueSize),
+		seen:      map[string]struct{}{},
+	}
+}
+
+// Report queues the event if it has not been reported yet. It never blocks the caller.
+func (r *DependencyReporter) Report(event DependencyEvent) {
+	k := event.key()
+
+	r.Lock()
+	if _, ok := r.seen[k]; ok {
+		r.Unlock()
+		return
+	}
+	if len(r.seen) >= reportSeenCapacity {
+		// bound memory, the controller tolerates duplicated events
+		r.seen = map[string]struct{}{}
+	}
+	r.seen[k] = struct{}{}
+	r.Unlock()
+
+	select {
+	case r.events <- event:
+	default:
+		log.Warnf("dependency report queue is full, drop event %+v", event)
+		r.forget([]DependencyEvent{event})
+	}
+}
+
+// Run flushes queued events in batches until stop is closed
+func (r *DependencyReporter) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(reportFlushInterval)
+	defer ticker.Stop()
+
+	var batch []DependencyEvent
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.send(batch); err != nil {
+			log.Errorf("report %d dependency events to %s failed, %v", len(batch), r.addr, err)
+			// forget them so that the next call will report again
+			r.forget(batch)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case <-stop:
+			flush()
+			return
+		case event := <-r.events:
+			batch = append(batch, event)
+			if len(batch) >= reportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (r *DependencyReporter) send(events []DependencyEvent) error {
+	body, err := json.Marshal(DependencyReport{Events: events})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.addr, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.tokenFile != "" {
+		// read on each report, the projected token is rotated
+		token, err := ioutil.ReadFile(r.tokenFile)
+		if err != nil {
+			return fmt.Errorf("read token failed, %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	log.Debugf("reported %d dependency events", len(events))
+	return nil
+}
+
+func (r *DependencyReporter) forget(events []DependencyEvent) {
+	r.Lock()
+	defer r.Unlock()
+	for _, e := range events {
+		delete(r.seen, e.key())
+	}
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDependencyReporter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		fail     = true
+		received []DependencyEvent
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if got := req.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("got authorization %q", got)
+		}
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var report DependencyReport
+		if err := json.NewDecoder(req.Body).Decode(&report); err != nil {
+			t.Errorf("decode report: %v", err)
+		}
+		received = append(received, report.Events...)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(tokenFile, []byte("token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewDependencyReporter(server.URL, tokenFile)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(stop)
+		close(done)
+	}()
+
+	event := DependencyEvent{SourceNs: "default", SourceIp: "10.0.0.1", Host: "reviews.default.svc.cluster.local", Port: 9080}
+	r.Report(event)
+	waitFor(t, func() bool {
+		// forgotten after the failed send
+		r.Lock()
+		defer r.Unlock()
+		return len(r.seen) == 0
+	})
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	r.Report(event)
+	r.Report(event)
+	close(stop)
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0] != event {
+		t.Errorf("got events %v, want %v reported once", received, event)
+	}
+}
+
+func TestSourceIp(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name    string
+		remote  string
+		xff     []string
+		trusted bool
+		want    string
+	}{
+		{"no xff", "192.168.0.1:1234", nil, true, "192.168.0.1"},
+		{"untrusted remote", "192.168.0.1:1234", []string{"1.1.1.1"}, true, "192.168.0.1"},
+		{"no trusted proxies", "127.0.0.1:1234", []string{"1.1.1.1"}, false, "127.0.0.1"},
+		{"trusted remote", "127.0.0.1:1234", []string{"1.1.1.1"}, true, "1.1.1.1"},
+		{"forged by client", "127.0.0.1:1234", []string{"6.6.6.6, 1.1.1.1, 10.0.0.2"}, true, "1.1.1.1"},
+		{"multiple headers", "127.0.0.1:1234", []string{"6.6.6.6", "1.1.1.1"}, true, "1.1.1.1"},
+		{"all trusted", "127.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, true, "10.0.0.3"},
+		{"garbage", "127.0.0.1:1234", []string{"1.1.1.1, unknown, 10.0.0.2"}, true, "10.0.0.2"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://reviews/", nil)
+		req.RemoteAddr = c.remote
+		for _, v := range c.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		var nets = trusted
+		if !c.trusted {
+			nets = nil
+		}
+		if got := sourceIp(req, nets); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, item := range []string{"10.0.0.1", "::1", "10.0.0.0/8", "fd00::/8"} {
+		if _, err := parseTrustedProxies([]string{item}); err != nil {
+			t.Errorf("parse %s: %v", item, err)
+		}
+	}
+	for _, item := range []string{"", "10.0.0", "10.0.0.0/33", "localhost"} {
+		if _, err := parseTrustedProxies([]string{item}); err == nil {
+			t.Errorf("parse %q: want error", item)
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	searchPathNamespace     = "$ns"
+	searchPathClusterDomain = "$clusterDomain"
+
+	resolveCacheTTL      = 30 * time.Second
+	resolveCacheCapacity = 4096
+	resolveTimeout       = time.Second
+)
+
+// ResolverConfig configures how proxy completes the request host, like the search paths of kubernetes dns
+type ResolverConfig struct {
+	// ClusterDomain is the domain suffix of the cluster, default cluster.local
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+	// SearchPaths are suffixes tried in order, "$ns" is replaced by the source namespace and
+	// "$clusterDomain" by the cluster domain.
+	// Default is ["$ns.svc.$clusterDomain", "svc.$clusterDomain", "$clusterDomain"]
+	SearchPaths []string `json:"searchPaths,omitempty"`
+	// Ndots is the threshold of dots before which search paths are tried first, default 5
+	Ndots int `json:"ndots,omitempty"`
+	// DisableLookup disables dns lookup to verify candidates, only kubernetes service names are completed then
+	DisableLookup bool `json:"disableLookup,omitempty"`
+}
+
+func DefaultResolverConfig() ResolverConfig {
+	return ResolverConfig{
+		ClusterDomain: "cluster.local",
+		SearchPaths: []string{
+			searchPathNamespace + ".svc." + searchPathClusterDomain,
+			"svc." + searchPathClusterDomain,
+			searchPathClusterDomain,
+		},
+		Ndots: 5,
+	}
+}
+
+type resolveResult struct {
+	host    string
+	service bool
+	expires time.Time
+}
+
+// Resolver completes host to the canonical FQDN
+type Resolver struct {
+	clusterDomain string
+	searchPaths   []string
+	ndots         int
+	lookup        func(ctx context.Context, host string) ([]string, error)
+
+	mu    sync.Mutex
+	cache map[string]resolveResult
+}
+
+func NewResolver(cfg ResolverConfig) *Resolver {
+	r := &Resolver{
+		clusterDomain: cfg.ClusterDomain,
+		searchPaths:   cfg.SearchPaths,
+		ndots:         cfg.Ndots,
+		cache:         map[string]resolveResult{},
+	}
+	if !cfg.DisableLookup {
+		r.lookup = net.DefaultResolver.LookupHost
+	}
+	return r
+}
+
+// Complete returns the FQDN of host requested by a workload in namespace ns.
+// Host without port is expected.
+func (r *Resolver) Complete(ctx context.Context, host, ns string) string {
+	ret, _ := r.Resolve(ctx, host, ns)
+	return ret
+}
+
+// Resolve is like Complete, and also tells whether the FQDN is a kubernetes service verified by dns lookup,
+// or by naming rules only if lookup is disabled.
+func (r *Resolver) Resolve(ctx context.Context, host, ns string) (string, bool) {
+	if host == "" || net.ParseIP(host) != nil {
+		return host, false
+	}
+
+	key := ns + "/" + host
+	now := time.Now()
+	r.mu.Lock()
+	if ret, ok := r.cache[key]; ok && now.Before(ret.expires) {
+		r.mu.Unlock()
+		return ret.host, ret.service
+	}
+	r.mu.Unlock()
+
+	ret, service := r.complete(ctx, host, ns)
+	log.Debugf("resolver completes host %s from namespace %s to %s", host, ns, ret)
+
+	r.mu.Lock()
+	if len(r.cache) >= resolveCacheCapacity {
+		r.cache = map[string]resolveResult{}
+	}
+	r.cache[key] = resolveResult{host: ret, service: service, expires: now.Add(resolveCacheTTL)}
+	r.mu.Unlock()
+	return ret, service
+}
+
+func (r *Resolver) complete(ctx context.Context, host, ns string) (string, bool) {
+	if strings.HasSuffix(host, ".") {
+		// absolute name, search paths do not apply
+		host = strings.TrimSuffix(host, ".")
+		if r.lookup == nil {
+			return host, r.isServiceFQDN(host)
+		}
+		ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+		defer cancel()
+		addrs, err := r.lookup(ctx, host+".")
+		return host, err == nil && len(addrs) > 0 && r.isServiceFQDN(host)
+	}
+
+	if r.lookup != nil {
+		ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+		defer cancel()
+		for _, c := range r.candidates(host, ns) {
+			// candidates are fully qualified, the trailing dot stops the search list of resolv.conf from
+			// being applied again
+			if addrs, err := r.lookup(ctx, c+"."); err == nil && len(addrs) > 0 {
+				return c, r.isServiceFQDN(c)
+			}
+		}
+		// not found, but still completed by the naming rules below to keep the request host canonical
+	}
+
+	// fallback to naming rules of kubernetes service
+	verified := r.lookup == nil
+	if r.isServiceFQDN(host) {
+		return host, verified
+	}
+	for _, c := range r.candidates(host, ns) {
+		if c != host && r.isServiceFQDN(c) && r.unambiguous(host) {
+			return c, verified
+		}
+	}
+	return host, false
+}
+
+// candidates returns names to try in order, like resolv.conf with search paths and ndots
+func (r *Resolver) candidates(host, ns string) []string {
+	var searched []string
+	for _, sp := range r.searchPaths {
+		if strings.Contains(sp, searchPathNamespace) {
+			if ns == "" {
+				continue
+			}
+			sp = strings.ReplaceAll(sp, searchPathNamespace, ns)
+		}
+		sp = strings.ReplaceAll(sp, searchPathClusterDomain, r.clusterDomain)
+		searched = append(searched, host+"."+sp)
+	}
+
+	if strings.Count(host, ".") >= r.ndots {
+		return append([]string{host}, searched...)
+	}
+	return append(searched, host)
+}
+
+// isServiceFQDN returns true for names like name.ns.svc.cluster.local
+func (r *Resolver) isServiceFQDN(host string) bool {
+	suffix := ".svc." + r.clusterDomain
+	if !strings.HasSuffix(host, suffix) {
+		return false
+	}
+	return strings.Count(strings.TrimSuffix(host, suffix), ".") == 1
+}
+
+// unambiguous returns true if host can only be a kubernetes service name without dns lookup,
+// which is short name or name.ns.svc. Two labels like name.ns may be an external domain.
+func (r *Resolver) unambiguous(host string) bool {
+	parts := strings.Split(host, ".")
+	return len(parts) == 1 || (len(parts) == 3 && parts[2] == "svc")
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestResolverComplete(t *testing.T) {
+	known := map[string]bool{
+		"reviews.default.svc.cluster.local.": true,
+		"ratings.test.svc.cluster.local.":    true,
+		"www.example.com.":                   true,
+	}
+	lookup := func(_ context.Context, host string) ([]string, error) {
+		if known[host] {
+			return []string{"10.0.0.1"}, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	cases := []struct {
+		name, host, ns string
+		disableLookup  bool
+		want           string
+	}{
+		{"short name", "reviews", "default", false, "reviews.default.svc.cluster.local"},
+		{"name.ns", "ratings.test", "default", false, "ratings.test.svc.cluster.local"},
+		{"name.ns.svc", "ratings.test.svc", "default", false, "ratings.test.svc.cluster.local"},
+		{"fqdn", "reviews.default.svc.cluster.local", "default", false, "reviews.default.svc.cluster.local"},
+		{"external", "www.example.com", "default", false, "www.example.com"},
+		{"absolute", "reviews.", "default", false, "reviews"},
+		{"absolute fqdn", "reviews.default.svc.cluster.local.", "default", false, "reviews.default.svc.cluster.local"},
+		{"ip", "10.0.0.1", "default", false, "10.0.0.1"},
+		{"unknown", "nope", "default", false, "nope.default.svc.cluster.local"},
+		{"no lookup short name", "reviews", "default", true, "reviews.default.svc.cluster.local"},
+		{"no lookup name.ns.svc", "ratings.test.svc", "default", true, "ratings.test.svc.cluster.local"},
+		{"no lookup ambiguous", "ratings.test", "default", true, "ratings.test"},
+		{"no namespace", "reviews", "", true, "reviews"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultResolverConfig()
+			cfg.DisableLookup = c.disableLookup
+			r := NewResolver(cfg)
+			if !c.disableLookup {
+				r.lookup = lookup
+			}
+			if got := r.Complete(context.Background(), c.host, c.ns); got != c.want {
+				t.Errorf("Complete(%q, %q) = %q, want %q", c.host, c.ns, got, c.want)
+			}
+		})
+	}
+}
+
+func TestResolverResolveService(t *testing.T) {
+	cfg := DefaultResolverConfig()
+	r := NewResolver(cfg)
+	r.lookup = func(_ context.Context, host string) ([]string, error) {
+		if host == "reviews.default.svc.cluster.local." || host == "www.example.com." {
+			return []string{"10.0.0.1"}, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	cases := []struct {
+		host        string
+		wantService bool
+	}{
+		{"reviews", true},
+		{"www.example.com", false},
+		// completed by the naming rules, but not found
+		{"nope", false},
+		{"10.0.0.1", false},
+	}
+	for _, c := range cases {
+		if _, service := r.Resolve(context.Background(), c.host, "default"); service != c.wantService {
+			t.Errorf("Resolve(%q) service = %v, want %v", c.host, service, c.wantService)
+		}
+	}
+
+	cfg.DisableLookup = true
+	r = NewResolver(cfg)
+	if _, service := r.Resolve(context.Background(), "nope", "default"); !service {
+		t.Errorf("service names are not trusted without lookup")
+	}
+}
+
+func TestResolverCustomDomain(t *testing.T) {
+	cfg := DefaultResolverConfig()
+	cfg.ClusterDomain = "k8s.example"
+	cfg.DisableLookup = true
+	r := NewResolver(cfg)
+
+	if got, want := r.Complete(context.Background(), "reviews", "default"), "reviews.default.svc.k8s.example"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
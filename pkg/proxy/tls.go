@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// TLSOriginationConfig enables tls to the original destinations matching the hosts and ports
+type TLSOriginationConfig struct {
+	// Hosts are patterns of the destination host, like "reviews.default.svc.cluster.local",
+	// "*.example.com" or "*" for all hosts
+	Hosts []string `json:"hosts"`
+	// Ports limits the destination ports, empty means all ports
+	Ports []int `json:"ports,omitempty"`
+	// SNI overrides the server name, default is the request host
+	SNI string `json:"sni,omitempty"`
+	// CAFile is the pem bundle verifying the server certificate, default is the system roots
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are the client certificate presented for mutual tls, optional
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// InsecureSkipVerify skips verifying the server certificate, for test only
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+func (c *TLSOriginationConfig) validate() error {
+	if len(c.Hosts) == 0 {
+		return fmt.Errorf("hosts is empty")
+	}
+	for _, h := range c.Hosts {
+		if h == "" || (strings.Contains(h, "*") && h != "*" && !strings.HasPrefix(h, "*.")) ||
+			strings.Count(h, "*") > 1 {
+			return fmt.Errorf("invalid host pattern %q", h)
+		}
+	}
+	for _, p := range c.Ports {
+		if p <= 0 || p > 65535 {
+			return fmt.Errorf("port %d is out of range", p)
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile must be set together")
+	}
+	return nil
+}
+
+// tlsConfig loads the ca bundle and client certificate from files
+func (c *TLSOriginationConfig) tlsConfig() (*tls.Config, error) {
+	ret := &tls.Config{
+		ServerName:         c.SNI,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		raw, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read caFile failed, %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificate found in caFile %s", c.CAFile)
+		}
+		ret.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed, %v", err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+	return ret, nil
+}
+
+func (c *TLSOriginationConfig) match(host string, port int) bool {
+	if len(c.Ports) > 0 {
+		found := false
+		for _, p := range c.Ports {
+			if p == port {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, h := range c.Hosts {
+		switch {
+		case h == "*":
+			return true
+		case strings.HasPrefix(h, "*."):
+			if strings.HasSuffix(host, h[1:]) {
+				return true
+			}
+		case h == host:
+			return true
+		}
+	}
+	return false
+}
+
+// tlsOrigination is a compiled TLSOriginationConfig with its own client
+type tlsOrigination struct {
+	rule      TLSOriginationConfig
+	client    *http.Client
+	transport *transportPool
+}
+
+// matchTLSOrigination returns the first rule matching the destination, nil if none
+func matchTLSOrigination(rules []*tlsOrigination, host string, port int) *tlsOrigination {
+	for _, r := range rules {
+		if r.rule.match(host, port) {
+			return r
+		}
+	}
+	return nil
+}
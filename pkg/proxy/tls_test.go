@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSOriginationMatch(t *testing.T) {
+	rule := TLSOriginationConfig{Hosts: []string{"reviews.default.svc.cluster.local", "*.example.com"}, Ports: []int{443}}
+	cases := []struct {
+		host string
+		port int
+		want bool
+	}{
+		{"reviews.default.svc.cluster.local", 443, true},
+		{"www.example.com", 443, true},
+		{"example.com", 443, false},
+		{"www.example.com", 80, false},
+		{"ratings.default.svc.cluster.local", 443, false},
+	}
+	for _, c := range cases {
+		if got := rule.match(c.host, c.port); got != c.want {
+			t.Errorf("match(%s, %d) = %v, want %v", c.host, c.port, got, c.want)
+		}
+	}
+}
+
+func TestProxyTLSOrigination(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || r.TLS.ServerName != "example.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	dir, err := ioutil.TempDir("", "proxy-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+	if err = ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.WormholePorts = []PortConfig{{Port: 80}}
+	cfg.Resolver.DisableLookup = true
+	cfg.TLSOrigination = []TLSOriginationConfig{{Hosts: []string{"example.com"}, CAFile: caFile}}
+	if err = cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxy(80, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set(HeaderOrigDest, backend.Listener.Addr().String())
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got code %d, want %d", rec.Code, http.StatusOK)
+	}
+}
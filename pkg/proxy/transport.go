@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// transportPoolCapacity bounds the number of destinations holding their own connections
+const transportPoolCapacity = 1024
+
+// transportPool is a round tripper keeping one transport for each original destination. A shared transport
+// pools connections by the request host, so requests of the same host to different original destinations
+// would reuse the connections to the wrong one.
+type transportPool struct {
+	cfg       *Config
+	tlsConfig *tls.Config
+	capacity  int
+
+	mu         sync.Mutex
+	transports map[string]*list.Element
+	// lru holds the destinations, the most recently used first
+	lru *list.List
+}
+
+type destTransport struct {
+	dest      string
+	transport *http.Transport
+}
+
+func newTransportPool(cfg *Config, tlsConfig *tls.Config) *transportPool {
+	return &transportPool{
+		cfg:        cfg,
+		tlsConfig:  tlsConfig,
+		capacity:   transportPoolCapacity,
+		transports: map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+func (p *transportPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	dest, ok := req.Context().Value(origDestKey{}).(string)
+	if !ok {
+		dest = canonicalAddr(req)
+	}
+	return p.get(dest).RoundTrip(req)
+}
+
+// get returns the transport of dest, the least recently used one is evicted if the pool is full
+func (p *transportPool) get(dest string) *http.Transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.transports[dest]; ok {
+		p.lru.MoveToFront(e)
+		return e.Value.(*destTransport).transport
+	}
+
+	if p.lru.Len() >= p.capacity {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		dt := oldest.Value.(*destTransport)
+		delete(p.transports, dt.dest)
+		// connections in use are closed once idle, as IdleConnTimeout applies
+		dt.transport.CloseIdleConnections()
+	}
+	t := newTransport(p.cfg, dest)
+	t.TLSClientConfig = p.tlsConfig
+	p.transports[dest] = p.lru.PushFront(&destTransport{dest: dest, transport: t})
+	return t
+}
+
+// CloseIdleConnections closes idle connections of all destinations
+func (p *transportPool) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for e := p.lru.Front(); e != nil; e = e.Next() {
+		e.Value.(*destTransport).transport.CloseIdleConnections()
+	}
+}
+
+// newTransport returns a transport which always dials dest instead of the request host
+func newTransport(cfg *Config, dest string) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   cfg.Timeouts.Dial.Duration,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, dest)
+		},
+		MaxIdleConns:          cfg.Pool.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.Pool.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.Pool.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.Timeouts.IdleConn.Duration,
+		ResponseHeaderTimeout: cfg.Timeouts.ResponseHeader.Duration,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// canonicalAddr returns host:port of the request url, with the default port of the scheme
+func canonicalAddr(req *http.Request) string {
+	if port := req.URL.Port(); port != "" {
+		return req.URL.Host
+	}
+	port := "80"
+	if req.URL.Scheme == ProtocolHTTPS {
+		port = "443"
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
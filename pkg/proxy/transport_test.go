@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyOrigDestWithSameHost(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		}))
+	}
+	v1, v2 := newBackend("v1"), newBackend("v2")
+	defer v1.Close()
+	defer v2.Close()
+
+	cfg := DefaultConfig()
+	cfg.WormholePorts = []PortConfig{{Port: 80}}
+	cfg.Resolver.DisableLookup = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxy(80, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keep-alive connections to v1 must not be reused for requests to v2
+	for i := 0; i < 3; i++ {
+		for _, backend := range []struct {
+			name string
+			srv  *httptest.Server
+		}{{"v1", v1}, {"v2", v2}} {
+			req := httptest.NewRequest(http.MethodGet, "http://reviews.default.svc.cluster.local/", nil)
+			req.Header.Set(HeaderOrigDest, backend.srv.Listener.Addr().String())
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+			if body, _ := ioutil.ReadAll(rec.Body); string(body) != backend.name {
+				t.Fatalf("round %d: got response %q from orig dest %s", i, body, backend.name)
+			}
+		}
+	}
+}
+
+func TestTransportPoolEviction(t *testing.T) {
+	pool := newTransportPool(DefaultConfig(), nil)
+	pool.capacity = 2
+
+	a := pool.get("10.0.0.1:80")
+	pool.get("10.0.0.2:80")
+	if pool.get("10.0.0.1:80") != a {
+		t.Fatal("transport of the same destination is not reused")
+	}
+	// 10.0.0.2 is the least recently used
+	pool.get("10.0.0.3:80")
+	if len(pool.transports) != 2 {
+		t.Errorf("got %d transports, want 2", len(pool.transports))
+	}
+	if _, ok := pool.transports["10.0.0.2:80"]; ok {
+		t.Errorf("least recently used destination is not evicted")
+	}
+	if pool.get("10.0.0.1:80") != a {
+		t.Errorf("recently used destination is evicted")
+	}
+}